@@ -0,0 +1,224 @@
+// Package accounts manages staff accounts in Firebase Auth and keeps the
+// users collection in step with them. Every Manager operation requires the
+// user.manage permission. Cashiers switches cashiers on a terminal by PIN.
+package accounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"kasirnest/firebase"
+	"kasirnest/models"
+	"kasirnest/repository"
+	"kasirnest/utils"
+)
+
+// Page is one page of accounts
+type Page struct {
+	Users         []models.User
+	NextPageToken string // empty on the last page
+}
+
+// Invite is a newly created account
+type Invite struct {
+	User models.User
+	// Link lets the user choose their own password, set when the account
+	// was created without one
+	Link string
+}
+
+// Manager manages accounts on behalf of an admin
+type Manager struct {
+	auth  *firebase.AuthService
+	users repository.UserRepository
+	actor *models.User // the signed in admin
+}
+
+// NewManager creates a manager acting for actor
+func NewManager(authService *firebase.AuthService, users repository.UserRepository, actor *models.User) *Manager {
+	return &Manager{auth: authService, users: users, actor: actor}
+}
+
+// List returns a page of the accounts matching query. Profiles in the
+// users collection that differ from Firebase Auth are updated on the way.
+func (m *Manager) List(ctx context.Context, query firebase.UserQuery) (*Page, error) {
+	if err := m.actor.Require(models.PermUserManage); err != nil {
+		return nil, err
+	}
+
+	result, err := m.auth.ListUsers(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Users: make([]models.User, 0, len(result.Users)), NextPageToken: result.NextPageToken}
+	for _, record := range result.Users {
+		user := firebase.UserFromRecord(record)
+		m.syncProfile(ctx, user)
+		page.Users = append(page.Users, user)
+	}
+	return page, nil
+}
+
+// Create creates an account with role. Without a password the account gets
+// a random one and the returned invite carries a link to choose a new one.
+func (m *Manager) Create(ctx context.Context, email, name, password, role string) (*Invite, error) {
+	if err := m.actor.Require(models.PermUserManage); err != nil {
+		return nil, err
+	}
+	email = strings.TrimSpace(email)
+	if !utils.ValidateEmail(email) || !models.ValidRole(role) {
+		return nil, models.ErrInvalidUser
+	}
+
+	invite := password == ""
+	if invite {
+		random, err := utils.GenerateRandomKey(24)
+		if err != nil {
+			return nil, err
+		}
+		password = random
+	}
+
+	record, err := m.auth.CreateUser(ctx, email, password, strings.TrimSpace(name))
+	if err != nil {
+		return nil, err
+	}
+	if err := m.auth.SetRole(ctx, record.UID, role); err != nil {
+		return nil, fmt.Errorf("account %s created without role: %w", email, err)
+	}
+
+	user := firebase.UserFromRecord(record)
+	user.Role = role
+	if err := m.users.Save(ctx, &user); err != nil {
+		log.Printf("Failed to save profile of %s: %v", user.UserID, err)
+	}
+
+	result := &Invite{User: user}
+	if invite {
+		result.Link, err = m.auth.PasswordResetLink(ctx, email)
+		if err != nil {
+			return result, fmt.Errorf("account %s created, invite link failed: %w", email, err)
+		}
+	}
+	return result, nil
+}
+
+// ResetPassword sets a new password and logs the user out everywhere
+func (m *Manager) ResetPassword(ctx context.Context, uid, password string) error {
+	if err := m.actor.Require(models.PermUserManage); err != nil {
+		return err
+	}
+	if err := m.auth.SetPassword(ctx, uid, password); err != nil {
+		return err
+	}
+	return m.auth.RevokeRefreshTokens(ctx, uid)
+}
+
+// SetDisabled disables or enables an account. Disabled users are logged out
+// when their session is next refreshed.
+func (m *Manager) SetDisabled(ctx context.Context, uid string, disabled bool) error {
+	if err := m.checkOther(uid); err != nil {
+		return err
+	}
+	if err := m.auth.SetDisabled(ctx, uid, disabled); err != nil {
+		return err
+	}
+	if disabled {
+		if err := m.auth.RevokeRefreshTokens(ctx, uid); err != nil {
+			return err
+		}
+	}
+	return m.updateProfile(ctx, uid, func(user *models.User) {
+		user.Disabled = disabled
+	})
+}
+
+// SetRole changes the role of an account. It takes effect when the user's
+// session is next refreshed.
+func (m *Manager) SetRole(ctx context.Context, uid, role string) error {
+	if err := m.checkOther(uid); err != nil {
+		return err
+	}
+	if err := m.auth.SetRole(ctx, uid, role); err != nil {
+		return err
+	}
+	return m.updateProfile(ctx, uid, func(user *models.User) {
+		user.Role = role
+	})
+}
+
+// ForceLogout revokes the sessions of a user, who is logged out on every
+// terminal when their session is next refreshed
+func (m *Manager) ForceLogout(ctx context.Context, uid string) error {
+	if err := m.checkOther(uid); err != nil {
+		return err
+	}
+	return m.auth.RevokeRefreshTokens(ctx, uid)
+}
+
+// checkOther checks the actor may manage users and uid is someone else
+func (m *Manager) checkOther(uid string) error {
+	if err := m.actor.Require(models.PermUserManage); err != nil {
+		return err
+	}
+	if uid == m.actor.UserID {
+		return models.ErrOwnAccount
+	}
+	return nil
+}
+
+// updateProfile applies change to the account as Firebase Auth now has it
+// and stores it in the users collection
+func (m *Manager) updateProfile(ctx context.Context, uid string, change func(*models.User)) error {
+	record, err := m.auth.GetUser(ctx, uid)
+	if err != nil {
+		return err
+	}
+	user := firebase.UserFromRecord(record)
+	change(&user)
+	return m.saveProfile(ctx, user)
+}
+
+// syncProfile stores user like saveProfile, failures only mean the
+// collection lags behind Firebase Auth
+func (m *Manager) syncProfile(ctx context.Context, user models.User) {
+	if err := m.saveProfile(ctx, user); err != nil {
+		log.Printf("Failed to sync profile of %s: %v", user.UserID, err)
+	}
+}
+
+// saveProfile stores the fields Firebase Auth keeps of user in the users
+// collection when the stored profile is missing or out of date. Fields
+// only kept in the collection are left alone.
+func (m *Manager) saveProfile(ctx context.Context, user models.User) error {
+	stored, err := m.users.Get(ctx, user.UserID)
+	switch {
+	case errors.Is(err, models.ErrUserNotFound):
+		stored = &user
+	case err != nil:
+		return err
+	case sameProfile(*stored, user):
+		return nil
+	default:
+		stored.Email = user.Email
+		stored.Name = user.Name
+		stored.Role = user.Role
+		stored.Disabled = user.Disabled
+		stored.LastLogin = user.LastLogin
+		if stored.CreatedAt.IsZero() {
+			stored.CreatedAt = user.CreatedAt
+		}
+	}
+	return m.users.Save(ctx, stored)
+}
+
+// sameProfile reports whether two profiles agree on the fields kept by
+// Firebase Auth
+func sameProfile(a, b models.User) bool {
+	return a.Email == b.Email && a.Name == b.Name && a.Role == b.Role &&
+		a.Disabled == b.Disabled && a.LastLogin.Equal(b.LastLogin)
+}
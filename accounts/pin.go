@@ -0,0 +1,316 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"kasirnest/firebase"
+	"kasirnest/models"
+	"kasirnest/repository"
+	"kasirnest/utils"
+)
+
+// Wrong PINs allowed before a user has to wait pinLockout
+const (
+	maxPINFailures = 5
+	pinLockout     = time.Minute
+)
+
+// SetPIN sets the PIN of a user, or removes it when pin is empty
+func (m *Manager) SetPIN(ctx context.Context, uid, pin string) error {
+	if err := m.actor.Require(models.PermUserManage); err != nil {
+		return err
+	}
+
+	profile, err := m.users.Get(ctx, uid)
+	if errors.Is(err, models.ErrUserNotFound) {
+		// Accounts made outside the app have no profile yet
+		record, err := m.auth.GetUser(ctx, uid)
+		if err != nil {
+			return err
+		}
+		user := firebase.UserFromRecord(record)
+		profile = &user
+	} else if err != nil {
+		return err
+	}
+	return savePIN(ctx, m.users, profile, pin)
+}
+
+// savePIN stores the hash of pin in profile, or removes the PIN when pin is
+// empty
+func savePIN(ctx context.Context, users repository.UserRepository, profile *models.User, pin string) error {
+	if pin != "" && !models.ValidPIN(pin) {
+		return models.ErrInvalidPIN
+	}
+
+	profile.PINHash = ""
+	if pin != "" {
+		hash, err := utils.HashPassword(pin)
+		if err != nil {
+			return err
+		}
+		profile.PINHash = hash
+	}
+	return users.Save(ctx, profile)
+}
+
+// Cashiers lets users with a PIN take over a terminal signed in by someone
+// else without entering their password. The Firebase session of the
+// terminal stays signed in; the PIN only decides who is working on it.
+type Cashiers struct {
+	users repository.UserRepository
+	store FailureStore // nil keeps failures in memory only
+
+	mu       sync.Mutex
+	cached   []models.User           // users with a PIN as last loaded
+	failures map[string]*pinFailures // by user ID, loaded from store on use
+	rehashed map[string]rehashedPIN  // by user ID, waiting to be saved
+}
+
+// rehashedPIN is a new hash of a PIN that matched an outdated hash in a
+// cached profile. It is saved once the profile can be loaded again, unless
+// the PIN was changed in the meantime.
+type rehashedPIN struct {
+	old  string // the hash it replaces
+	hash string
+}
+
+// FailureStore keeps the wrong PINs counted for each user, so restarting
+// the application does not give a user new attempts
+type FailureStore interface {
+	PINFailures(uid string) (count int, until time.Time, err error)
+	PutPINFailures(uid string, count int, until time.Time) error
+}
+
+// pinFailures counts wrong PINs entered for a user
+type pinFailures struct {
+	count int
+	until time.Time // when the user may try again after too many failures
+}
+
+// NewCashiers creates cashier switching backed by the users collection.
+// users must not check permissions, cashiers switch in before their role
+// is known. store may be nil when there is no local database.
+func NewCashiers(users repository.UserRepository, store FailureStore) *Cashiers {
+	return &Cashiers{
+		users:    users,
+		store:    store,
+		failures: make(map[string]*pinFailures),
+		rehashed: make(map[string]rehashedPIN),
+	}
+}
+
+// List returns the enabled users with a PIN sorted by name. When the users
+// cannot be loaded, e.g. while offline, the users last loaded are returned
+// along with the error.
+func (c *Cashiers) List(ctx context.Context) ([]models.User, error) {
+	users, err := c.users.List(ctx)
+	if err != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return append([]models.User(nil), c.cached...), err
+	}
+
+	cashiers := make([]models.User, 0, len(users))
+	for _, user := range users {
+		if user.HasPIN() && !user.Disabled {
+			cashiers = append(cashiers, user)
+		}
+	}
+	sort.Slice(cashiers, func(i, j int) bool {
+		return cashiers[i].Name < cashiers[j].Name
+	})
+
+	c.mu.Lock()
+	c.cached = cashiers
+	c.mu.Unlock()
+	c.saveRehashed(ctx, users)
+	return append([]models.User(nil), cashiers...), nil
+}
+
+// saveRehashed saves the PINs rehashed while only cached profiles were
+// available, now that users holds the stored profiles
+func (c *Cashiers) saveRehashed(ctx context.Context, users []models.User) {
+	c.mu.Lock()
+	pending := make(map[string]rehashedPIN, len(c.rehashed))
+	for uid, rehashed := range c.rehashed {
+		pending[uid] = rehashed
+	}
+	c.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	for i := range users {
+		user := &users[i]
+		rehashed, ok := pending[user.UserID]
+		if !ok {
+			continue
+		}
+		if user.PINHash == rehashed.old {
+			user.PINHash = rehashed.hash
+			if err := c.users.Save(ctx, user); err != nil {
+				log.Printf("Failed to save rehashed PIN of %s: %v", user.UserID, err)
+				continue
+			}
+		}
+		c.mu.Lock()
+		if c.rehashed[user.UserID] == rehashed {
+			delete(c.rehashed, user.UserID)
+		}
+		c.mu.Unlock()
+	}
+}
+
+// Verify checks the PIN of a user and returns their profile. Wrong PINs
+// return models.ErrWrongPIN, and after maxPINFailures of them
+// models.ErrTooManyAttempts until pinLockout has passed. A PIN stored with
+// an outdated hash is hashed again once it matched; when the profile came
+// from the cache the new hash is saved by the next List that reaches the
+// users collection.
+func (c *Cashiers) Verify(ctx context.Context, uid, pin string) (*models.User, error) {
+	c.mu.Lock()
+	failures := c.failuresOf(uid)
+	if time.Now().Before(failures.until) {
+		c.mu.Unlock()
+		return nil, models.ErrTooManyAttempts
+	}
+	c.mu.Unlock()
+
+	user, cached, err := c.profile(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, models.ErrUserDisabled
+	}
+
+	match, rehash := false, false
+	if user.HasPIN() {
+		match, rehash = utils.VerifyPassword(pin, user.PINHash)
+	}
+
+	if !match {
+		return nil, c.fail(uid)
+	}
+
+	c.mu.Lock()
+	if failures := c.failuresOf(uid); failures.count > 0 || !failures.until.IsZero() {
+		*failures = pinFailures{}
+		c.saveFailures(uid, failures)
+	}
+	c.mu.Unlock()
+
+	switch {
+	case rehash && cached:
+		// A stale cached profile must not overwrite the stored one, only
+		// its PIN hash is replaced later
+		hash, err := utils.HashPassword(pin)
+		if err != nil {
+			log.Printf("Failed to rehash PIN of %s: %v", uid, err)
+			break
+		}
+		c.mu.Lock()
+		c.rehashed[uid] = rehashedPIN{old: user.PINHash, hash: hash}
+		c.mu.Unlock()
+	case rehash:
+		if err := savePIN(ctx, c.users, user, pin); err != nil {
+			log.Printf("Failed to rehash PIN of %s: %v", uid, err)
+		}
+	}
+	return user, nil
+}
+
+// fail counts a wrong PIN for uid and returns the error to show
+func (c *Cashiers) fail(uid string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	failures := c.failuresOf(uid)
+	failures.count++
+	err := models.ErrWrongPIN
+	if failures.count >= maxPINFailures {
+		failures.count = 0
+		failures.until = time.Now().Add(pinLockout)
+		err = models.ErrTooManyAttempts
+	}
+	c.saveFailures(uid, failures)
+	return err
+}
+
+// failuresOf returns the failures counted for uid, loading them from the
+// store the first time. c.mu must be held.
+func (c *Cashiers) failuresOf(uid string) *pinFailures {
+	if failures, ok := c.failures[uid]; ok {
+		return failures
+	}
+
+	failures := &pinFailures{}
+	if c.store != nil {
+		count, until, err := c.store.PINFailures(uid)
+		if err != nil {
+			log.Printf("Failed to read PIN failures of %s: %v", uid, err)
+		}
+		failures.count, failures.until = count, until
+	}
+	c.failures[uid] = failures
+	return failures
+}
+
+// saveFailures writes the failures counted for uid to the store. c.mu must
+// be held.
+func (c *Cashiers) saveFailures(uid string, failures *pinFailures) {
+	if c.store == nil {
+		return
+	}
+	if err := c.store.PutPINFailures(uid, failures.count, failures.until); err != nil {
+		log.Printf("Failed to store PIN failures of %s: %v", uid, err)
+	}
+}
+
+// profile loads the profile of uid. The profile last listed is used when
+// the users collection cannot be reached, cached reports when it was.
+func (c *Cashiers) profile(ctx context.Context, uid string) (user *models.User, cached bool, err error) {
+	user, err = c.users.Get(ctx, uid)
+	if err == nil || !errors.Is(err, models.ErrUnavailable) && !errors.Is(err, models.ErrTimeout) {
+		return user, false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, listed := range c.cached {
+		if listed.UserID == uid {
+			return &listed, true, nil
+		}
+	}
+	return nil, false, err
+}
+
+// ChangePIN changes the PIN of user after checking their current one,
+// which is empty for users without a PIN. An empty pin removes the PIN.
+func (c *Cashiers) ChangePIN(ctx context.Context, user *models.User, current, pin string) error {
+	profile, err := c.users.Get(ctx, user.UserID)
+	if errors.Is(err, models.ErrUserNotFound) {
+		profile = &models.User{
+			UserID:    user.UserID,
+			Email:     user.Email,
+			Name:      user.Name,
+			Role:      user.Role,
+			CreatedAt: time.Now(),
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if profile.HasPIN() {
+		if _, err := c.Verify(ctx, user.UserID, current); err != nil {
+			return err
+		}
+	}
+	return savePIN(ctx, c.users, profile, pin)
+}
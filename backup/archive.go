@@ -0,0 +1,295 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"kasirnest/firebase"
+	"kasirnest/utils"
+)
+
+// Collections are the Firestore collections included in every backup
+var Collections = []string{"products", "categories", "users", "transactions", "shifts"}
+
+// archiveMagic starts every backup file, followed by the format version
+var archiveMagic = []byte("KNBK")
+
+// archiveVersion is the format written. Version 1 files, encrypted
+// without a key derivation function, can still be read.
+const archiveVersion = 2
+
+// ErrInvalidArchive is returned for files that are not KasirNest backups
+var ErrInvalidArchive = errors.New("not a KasirNest backup archive")
+
+// Archive is the content of a backup file
+type Archive struct {
+	Version     int                            `json:"version"`
+	CreatedAt   time.Time                      `json:"created_at"`
+	ProjectID   string                         `json:"project_id"`
+	Collections map[string][]firebase.Document `json:"collections"`
+}
+
+// Counts returns the number of documents per collection
+func (a *Archive) Counts() map[string]int {
+	counts := make(map[string]int, len(a.Collections))
+	for name, documents := range a.Collections {
+		counts[name] = len(documents)
+	}
+	return counts
+}
+
+// Write encodes the archive as gzip-compressed JSON, encrypts it with key
+// and writes it to w
+func (a *Archive) Write(w io.Writer, key string) error {
+	collections := make(map[string][]archiveDocument, len(a.Collections))
+	for name, documents := range a.Collections {
+		encoded := make([]archiveDocument, len(documents))
+		for i, doc := range documents {
+			fields, err := encodeValue(doc.Data)
+			if err != nil {
+				return fmt.Errorf("%s/%s: %w", name, doc.ID, err)
+			}
+			encoded[i] = archiveDocument{ID: doc.ID, Fields: fields}
+		}
+		collections[name] = encoded
+	}
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	err := json.NewEncoder(zw).Encode(archiveFile{
+		Version:     archiveVersion,
+		CreatedAt:   a.CreatedAt,
+		ProjectID:   a.ProjectID,
+		Collections: collections,
+	})
+	if err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	header := make([]byte, 0, len(archiveMagic)+1)
+	header = append(append(header, archiveMagic...), archiveVersion)
+
+	// The header is authenticated, so the version cannot be changed
+	ciphertext, err := utils.EncryptBytesWithAAD(compressed.Bytes(), key, header)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err = w.Write(ciphertext)
+	return err
+}
+
+// ReadArchive decrypts and decodes a backup written by Archive.Write
+func ReadArchive(r io.Reader, key string) (*Archive, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	header := len(archiveMagic) + 1
+	if len(data) < header || !bytes.Equal(data[:len(archiveMagic)], archiveMagic) {
+		return nil, ErrInvalidArchive
+	}
+	if version := int(data[len(archiveMagic)]); version < 1 || version > archiveVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", version)
+	}
+
+	compressed, err := utils.DecryptBytesWithAAD(data[header:], key, data[:header])
+	if err != nil {
+		return nil, fmt.Errorf("decrypt backup, check security.encryption_key: %w", err)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var file archiveFile
+	decoder := json.NewDecoder(zr)
+	decoder.UseNumber()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, err
+	}
+
+	archive := &Archive{
+		Version:     file.Version,
+		CreatedAt:   file.CreatedAt,
+		ProjectID:   file.ProjectID,
+		Collections: make(map[string][]firebase.Document, len(file.Collections)),
+	}
+	for name, encoded := range file.Collections {
+		documents := make([]firebase.Document, len(encoded))
+		for i, doc := range encoded {
+			value, err := decodeValue(doc.Fields)
+			if err != nil {
+				return nil, fmt.Errorf("%s/%s: %w", name, doc.ID, err)
+			}
+			data, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s/%s: %w", name, doc.ID, ErrInvalidArchive)
+			}
+			documents[i] = firebase.Document{ID: doc.ID, Data: data}
+		}
+		archive.Collections[name] = documents
+	}
+
+	return archive, nil
+}
+
+// archiveFile is the JSON layout of a backup
+type archiveFile struct {
+	Version     int                          `json:"version"`
+	CreatedAt   time.Time                    `json:"created_at"`
+	ProjectID   string                       `json:"project_id"`
+	Collections map[string][]archiveDocument `json:"collections"`
+}
+
+// archiveDocument is a document whose fields are tagged with their
+// Firestore types
+type archiveDocument struct {
+	ID     string      `json:"id"`
+	Fields interface{} `json:"fields"`
+}
+
+// Keys of the objects that carry Firestore types JSON cannot express
+const (
+	intKey   = "$int"
+	timeKey  = "$time"
+	bytesKey = "$bytes"
+	mapKey   = "$map" // a map that would otherwise look like a typed value
+)
+
+// encodeValue converts a Firestore value into plain JSON. Integers,
+// timestamps and bytes are wrapped so they come back with the same type.
+func encodeValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil, bool, string, float64:
+		return v, nil
+	case int64:
+		return map[string]string{intKey: strconv.FormatInt(v, 10)}, nil
+	case time.Time:
+		return map[string]string{timeKey: v.UTC().Format(time.RFC3339Nano)}, nil
+	case []byte:
+		return map[string]string{bytesKey: base64.StdEncoding.EncodeToString(v)}, nil
+	case []interface{}:
+		encoded := make([]interface{}, len(v))
+		for i, item := range v {
+			item, err := encodeValue(item)
+			if err != nil {
+				return nil, err
+			}
+			encoded[i] = item
+		}
+		return encoded, nil
+	case map[string]interface{}:
+		encoded := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			item, err := encodeValue(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			encoded[key] = item
+		}
+		if len(encoded) == 1 {
+			for key := range encoded {
+				if strings.HasPrefix(key, "$") {
+					return map[string]interface{}{mapKey: encoded}, nil
+				}
+			}
+		}
+		return encoded, nil
+	default:
+		return nil, fmt.Errorf("unsupported field type %T", value)
+	}
+}
+
+// decodeValue reverses encodeValue
+func decodeValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil, bool, string:
+		return v, nil
+	case json.Number:
+		return v.Float64()
+	case []interface{}:
+		decoded := make([]interface{}, len(v))
+		for i, item := range v {
+			item, err := decodeValue(item)
+			if err != nil {
+				return nil, err
+			}
+			decoded[i] = item
+		}
+		return decoded, nil
+	case map[string]interface{}:
+		if len(v) == 1 {
+			if typed, ok, err := decodeTyped(v); ok {
+				return typed, err
+			}
+		}
+		decoded := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			item, err := decodeValue(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			decoded[key] = item
+		}
+		return decoded, nil
+	default:
+		return nil, fmt.Errorf("unexpected JSON value %T", value)
+	}
+}
+
+// decodeTyped decodes a value wrapped by encodeValue. ok is false when v
+// is an ordinary map.
+func decodeTyped(v map[string]interface{}) (value interface{}, ok bool, err error) {
+	for key, raw := range v {
+		if key == mapKey {
+			inner, isMap := raw.(map[string]interface{})
+			if !isMap {
+				return nil, false, nil
+			}
+			decoded := make(map[string]interface{}, len(inner))
+			for innerKey, item := range inner {
+				item, err := decodeValue(item)
+				if err != nil {
+					return nil, true, fmt.Errorf("%s: %w", innerKey, err)
+				}
+				decoded[innerKey] = item
+			}
+			return decoded, true, nil
+		}
+
+		text, isString := raw.(string)
+		if !isString {
+			return nil, false, nil
+		}
+
+		switch key {
+		case intKey:
+			value, err = strconv.ParseInt(text, 10, 64)
+		case timeKey:
+			value, err = time.Parse(time.RFC3339Nano, text)
+		case bytesKey:
+			value, err = base64.StdEncoding.DecodeString(text)
+		default:
+			return nil, false, nil
+		}
+	}
+	return value, true, err
+}
@@ -0,0 +1,104 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"kasirnest/firebase"
+)
+
+// testDocument has a field of every type a Firestore document can hold
+func testDocument() map[string]interface{} {
+	return map[string]interface{}{
+		"name":    "Kopi Susu",
+		"active":  true,
+		"note":    nil,
+		"price":   18500.5,
+		"stock":   int64(1) << 53,
+		"minus":   int64(-7),
+		"created": time.Date(2024, 3, 9, 14, 30, 15, 123456789, time.UTC),
+		"photo":   []byte{0x00, 0xFF, 0x10},
+		"tags":    []interface{}{"minuman", int64(3), 2.25, []interface{}{"nested"}},
+		"supplier": map[string]interface{}{
+			"name":    "CV Sumber",
+			"since":   time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+			"address": map[string]interface{}{"city": "Bandung", "zip": int64(40115)},
+		},
+		// Maps that would pass for a typed value must stay maps
+		"lookalike": map[string]interface{}{"$int": "12"},
+		"escaped":   map[string]interface{}{"$map": map[string]interface{}{"a": int64(1)}},
+	}
+}
+
+func TestEncodeValueRoundTrip(t *testing.T) {
+	original := testDocument()
+
+	encoded, err := encodeValue(original)
+	if err != nil {
+		t.Fatalf("encodeValue: %v", err)
+	}
+	data, err := json.Marshal(encoded)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+
+	// Read back the way ReadArchive does
+	var raw interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		t.Fatalf("json.Decode: %v", err)
+	}
+	decoded, err := decodeValue(raw)
+	if err != nil {
+		t.Fatalf("decodeValue: %v", err)
+	}
+
+	if !reflect.DeepEqual(decoded, original) {
+		t.Errorf("decode(encode(x)) = %#v\nwant %#v", decoded, original)
+	}
+}
+
+func TestEncodeValueUnsupported(t *testing.T) {
+	if _, err := encodeValue(map[string]interface{}{"count": 3}); err == nil {
+		t.Error("encodeValue(int) succeeded, want an error")
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	archive := &Archive{
+		CreatedAt: time.Date(2024, 3, 9, 20, 0, 0, 0, time.UTC),
+		ProjectID: "kasirnest-test",
+		Collections: map[string][]firebase.Document{
+			"products": {{ID: "kopi", Data: testDocument()}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := archive.Write(&buf, "kunci"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	read, err := ReadArchive(bytes.NewReader(buf.Bytes()), "kunci")
+	if err != nil {
+		t.Fatalf("ReadArchive: %v", err)
+	}
+	if read.Version != archiveVersion || read.ProjectID != archive.ProjectID ||
+		!read.CreatedAt.Equal(archive.CreatedAt) {
+		t.Errorf("header = %d, %s, %v", read.Version, read.ProjectID, read.CreatedAt)
+	}
+	if !reflect.DeepEqual(read.Collections, archive.Collections) {
+		t.Errorf("collections = %#v\nwant %#v", read.Collections, archive.Collections)
+	}
+
+	if _, err := ReadArchive(bytes.NewReader(buf.Bytes()), "kunci lain"); err == nil {
+		t.Error("ReadArchive with the wrong key succeeded")
+	}
+	if _, err := ReadArchive(bytes.NewReader([]byte("not a backup")), "kunci"); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("ReadArchive(garbage) = %v, want ErrInvalidArchive", err)
+	}
+}
@@ -0,0 +1,357 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"kasirnest/firebase"
+)
+
+// Backup file names are filePrefix + creation time + fileExt
+const (
+	filePrefix     = "kasirnest-"
+	fileExt        = ".knb"
+	fileTimeFormat = "20060102-150405"
+)
+
+// Options configures a Manager
+type Options struct {
+	Dir       string        // directory holding the backup files
+	Key       string        // encryption key, security.encryption_key
+	ProjectID string        // recorded in every archive
+	Interval  time.Duration // time between automatic backups
+	Retention int           // number of backups to keep, 0 keeps all
+}
+
+// Entry describes a backup file on disk
+type Entry struct {
+	Name      string
+	Path      string
+	CreatedAt time.Time
+	Size      int64
+}
+
+// Status describes the last backup run
+type Status struct {
+	Running   bool
+	LastRun   time.Time
+	LastError string
+}
+
+// Manager exports Firestore into encrypted backup files, either on demand
+// or on a schedule
+type Manager struct {
+	firestore *firebase.FirestoreService
+	options   Options
+
+	// ctx is cancelled by Stop, aborting any backup in progress
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// runMu makes sure only one backup is written at a time
+	runMu sync.Mutex
+
+	mu        sync.Mutex
+	started   bool
+	status    Status
+	listeners []func(Status)
+}
+
+// NewManager creates a backup manager writing to options.Dir
+func NewManager(firestore *firebase.FirestoreService, options Options) (*Manager, error) {
+	if options.Key == "" {
+		return nil, errors.New("backups need an encryption key")
+	}
+	if options.Interval <= 0 {
+		options.Interval = 24 * time.Hour
+	}
+	if err := os.MkdirAll(options.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		firestore: firestore,
+		options:   options,
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// Interval returns the time between automatic backups
+func (m *Manager) Interval() time.Duration {
+	return m.options.Interval
+}
+
+// Start starts taking backups on schedule. The first backup is due one
+// interval after the newest backup on disk.
+func (m *Manager) Start() {
+	m.mu.Lock()
+	m.started = true
+	m.mu.Unlock()
+
+	go m.run()
+}
+
+// Scheduled reports whether automatic backups are running
+func (m *Manager) Scheduled() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.started
+}
+
+// Stop stops the schedule and waits for a running backup to be aborted
+func (m *Manager) Stop() {
+	m.cancel()
+
+	m.mu.Lock()
+	started := m.started
+	m.mu.Unlock()
+	if started {
+		<-m.done
+	}
+
+	// Wait for a backup started from the UI as well
+	m.runMu.Lock()
+	m.runMu.Unlock()
+}
+
+// Status returns the state of the last backup run
+func (m *Manager) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// OnStatusChange registers a callback for backup status updates.
+// Callbacks run on the goroutine taking the backup.
+func (m *Manager) OnStatusChange(callback func(Status)) {
+	m.mu.Lock()
+	m.listeners = append(m.listeners, callback)
+	status := m.status
+	m.mu.Unlock()
+
+	callback(status)
+}
+
+// run is the schedule loop
+func (m *Manager) run() {
+	defer close(m.done)
+
+	timer := time.NewTimer(m.untilNext())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		if _, err := m.Backup(m.ctx); err != nil {
+			log.Printf("Automatic backup failed: %v", err)
+		}
+		timer.Reset(m.options.Interval)
+	}
+}
+
+// untilNext returns how long to wait for the next scheduled backup
+func (m *Manager) untilNext() time.Duration {
+	entries, err := m.History()
+	if err != nil || len(entries) == 0 {
+		return 0
+	}
+
+	wait := time.Until(entries[0].CreatedAt.Add(m.options.Interval))
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// Backup exports every collection into a new backup file and removes the
+// backups beyond the retention limit
+func (m *Manager) Backup(ctx context.Context) (*Entry, error) {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+
+	// A backup started from the UI is aborted by Stop as well
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stopWithManager := context.AfterFunc(m.ctx, cancel)
+	defer stopWithManager()
+
+	m.setStatus(func(status *Status) { status.Running = true })
+
+	entry, err := m.write(ctx)
+	if err == nil {
+		if pruneErr := m.prune(); pruneErr != nil {
+			log.Printf("Failed to remove old backups: %v", pruneErr)
+		}
+	}
+
+	m.setStatus(func(status *Status) {
+		status.Running = false
+		status.LastRun = time.Now()
+		status.LastError = ""
+		if err != nil {
+			status.LastError = err.Error()
+		}
+	})
+	return entry, err
+}
+
+// write exports Firestore into a new backup file
+func (m *Manager) write(ctx context.Context) (*Entry, error) {
+	createdAt := time.Now()
+	archive := &Archive{
+		CreatedAt:   createdAt,
+		ProjectID:   m.options.ProjectID,
+		Collections: make(map[string][]firebase.Document, len(Collections)),
+	}
+	for _, collection := range Collections {
+		documents, err := m.firestore.Documents(ctx, collection)
+		if err != nil {
+			return nil, fmt.Errorf("export %s: %w", collection, err)
+		}
+		archive.Collections[collection] = documents
+	}
+
+	name := filePrefix + createdAt.Format(fileTimeFormat) + fileExt
+	path := filepath.Join(m.options.Dir, name)
+
+	// Write to a temporary file first so a crash never leaves a truncated
+	// backup that looks complete
+	tmp, err := os.CreateTemp(m.options.Dir, name+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := archive.Write(tmp, m.options.Key); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Backup written to %s", path)
+	return &Entry{Name: name, Path: path, CreatedAt: createdAt, Size: info.Size()}, nil
+}
+
+// History returns the backups on disk, newest first
+func (m *Manager) History() ([]Entry, error) {
+	files, err := os.ReadDir(m.options.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileExt) {
+			continue
+		}
+
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileExt)
+		createdAt, err := time.ParseInLocation(fileTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, Entry{
+			Name:      name,
+			Path:      filepath.Join(m.options.Dir, name),
+			CreatedAt: createdAt,
+			Size:      info.Size(),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.After(entries[j].CreatedAt)
+	})
+	return entries, nil
+}
+
+// prune removes the oldest backups beyond the retention limit
+func (m *Manager) prune() error {
+	if m.options.Retention <= 0 {
+		return nil
+	}
+
+	entries, err := m.History()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i := m.options.Retention; i < len(entries); i++ {
+		if err := os.Remove(entries[i].Path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		log.Printf("Removed old backup %s", entries[i].Name)
+	}
+	return errors.Join(errs...)
+}
+
+// Open reads a backup file from the history
+func (m *Manager) Open(entry Entry) (*Archive, error) {
+	return OpenArchive(entry.Path, m.options.Key)
+}
+
+// PlanRestore compares archive with the current Firestore contents
+func (m *Manager) PlanRestore(ctx context.Context, archive *Archive) (*Plan, error) {
+	return PlanRestore(ctx, m.firestore, archive)
+}
+
+// Restore backs up the current contents of Firestore and then applies
+// plan, so a mistaken restore can itself be undone
+func (m *Manager) Restore(ctx context.Context, plan *Plan, progress func(done, total int)) error {
+	if _, err := m.Backup(ctx); err != nil {
+		return fmt.Errorf("backup before restore: %w", err)
+	}
+	return Restore(ctx, m.firestore, plan, progress)
+}
+
+// setStatus updates the status and notifies the listeners
+func (m *Manager) setStatus(update func(*Status)) {
+	m.mu.Lock()
+	update(&m.status)
+	status := m.status
+	listeners := make([]func(Status), len(m.listeners))
+	copy(listeners, m.listeners)
+	m.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(status)
+	}
+}
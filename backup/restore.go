@@ -0,0 +1,160 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+
+	"kasirnest/firebase"
+)
+
+// restoreBatchSize is the number of writes per batch, Firestore allows 500
+const restoreBatchSize = 500
+
+// CollectionPlan lists what a restore changes in one collection
+type CollectionPlan struct {
+	Name      string
+	Create    []string // documents only in the backup
+	Overwrite []string // documents that differ from the backup
+	Delete    []string // documents missing from the backup
+	Unchanged int
+}
+
+// Changes returns the number of writes needed for the collection
+func (c *CollectionPlan) Changes() int {
+	return len(c.Create) + len(c.Overwrite) + len(c.Delete)
+}
+
+// Plan is the dry-run result of restoring an archive
+type Plan struct {
+	Archive     *Archive
+	Collections []CollectionPlan
+}
+
+// Changes returns the total number of writes the restore performs
+func (p *Plan) Changes() int {
+	total := 0
+	for i := range p.Collections {
+		total += p.Collections[i].Changes()
+	}
+	return total
+}
+
+// OpenArchive reads a backup file encrypted with key
+func OpenArchive(path, key string) (*Archive, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadArchive(file, key)
+}
+
+// PlanRestore compares the archive with the current contents of Firestore
+// without changing anything
+func PlanRestore(ctx context.Context, fs *firebase.FirestoreService, archive *Archive) (*Plan, error) {
+	names := make([]string, 0, len(archive.Collections))
+	for name := range archive.Collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	plan := &Plan{Archive: archive}
+	for _, name := range names {
+		current, err := fs.Documents(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", name, err)
+		}
+
+		existing := make(map[string]map[string]interface{}, len(current))
+		for _, doc := range current {
+			existing[doc.ID] = doc.Data
+		}
+
+		collection := CollectionPlan{Name: name}
+		for _, doc := range archive.Collections[name] {
+			data, found := existing[doc.ID]
+			delete(existing, doc.ID)
+
+			switch {
+			case !found:
+				collection.Create = append(collection.Create, doc.ID)
+			case sameData(data, doc.Data):
+				collection.Unchanged++
+			default:
+				collection.Overwrite = append(collection.Overwrite, doc.ID)
+			}
+		}
+		for id := range existing {
+			collection.Delete = append(collection.Delete, id)
+		}
+		sort.Strings(collection.Delete)
+
+		plan.Collections = append(plan.Collections, collection)
+	}
+
+	return plan, nil
+}
+
+// sameData reports whether two documents hold the same fields. Both are
+// compared in their archive encoding so timestamps in different locations
+// still match.
+func sameData(a, b map[string]interface{}) bool {
+	encodedA, errA := encodeValue(a)
+	encodedB, errB := encodeValue(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return reflect.DeepEqual(encodedA, encodedB)
+}
+
+// Restore applies plan in batches of at most restoreBatchSize writes.
+// progress, when set, is called after every batch with the number of
+// writes done so far. A failed batch stops the restore; the batches before
+// it stay applied.
+func Restore(ctx context.Context, fs *firebase.FirestoreService, plan *Plan, progress func(done, total int)) error {
+	operations := make([]firebase.BatchOperation, 0, plan.Changes())
+	for _, collection := range plan.Collections {
+		documents := make(map[string]map[string]interface{}, len(plan.Archive.Collections[collection.Name]))
+		for _, doc := range plan.Archive.Collections[collection.Name] {
+			documents[doc.ID] = doc.Data
+		}
+
+		for _, ids := range [][]string{collection.Create, collection.Overwrite} {
+			for _, id := range ids {
+				operations = append(operations, firebase.BatchOperation{
+					Operation:  "set",
+					Collection: collection.Name,
+					DocumentID: id,
+					Data:       documents[id],
+				})
+			}
+		}
+		for _, id := range collection.Delete {
+			operations = append(operations, firebase.BatchOperation{
+				Operation:  "delete",
+				Collection: collection.Name,
+				DocumentID: id,
+			})
+		}
+	}
+
+	for start := 0; start < len(operations); start += restoreBatchSize {
+		end := start + restoreBatchSize
+		if end > len(operations) {
+			end = len(operations)
+		}
+
+		if err := fs.BatchWrite(ctx, operations[start:end]); err != nil {
+			return fmt.Errorf("restore stopped after %d of %d writes: %w", start, len(operations), err)
+		}
+		if progress != nil {
+			progress(end, len(operations))
+		}
+	}
+
+	return nil
+}
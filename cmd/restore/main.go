@@ -0,0 +1,111 @@
+// Command restore restores a KasirNest backup archive into Firestore.
+// Without -apply it only prints what the restore would change.
+//
+// Usage:
+//
+//	go run ./cmd/restore -file data/backups/kasirnest-20240101-020000.knb
+//	go run ./cmd/restore -file backup.knb -apply
+//	go run ./cmd/restore -file backup.knb -target dr.ini -apply
+//
+// The archive is decrypted with security.encryption_key from app.ini. Use
+// -target to restore into the Firebase project configured in another ini
+// file, for example a disaster recovery project.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"kasirnest/backup"
+	"kasirnest/config"
+	"kasirnest/firebase"
+)
+
+func main() {
+	file := flag.String("file", "", "backup archive to restore")
+	target := flag.String("target", "", "ini file of the Firebase project to restore into (defaults to app.ini)")
+	apply := flag.Bool("apply", false, "write the changes, otherwise only show them")
+	flag.Parse()
+
+	if *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	archive, err := backup.OpenArchive(*file, cfg.Security.EncryptionKey)
+	if err != nil {
+		log.Fatalf("Failed to read backup: %v", err)
+	}
+
+	fbConfig := cfg.Firebase
+	if *target != "" {
+		targetCfg, err := config.LoadFile(*target)
+		if err != nil {
+			log.Fatalf("Failed to load target configuration: %v", err)
+		}
+		fbConfig = targetCfg.Firebase
+	}
+
+	ctx := context.Background()
+	client, err := firebase.Initialize(ctx, fbConfig)
+	if err != nil {
+		log.Fatalf("Failed to initialize Firebase: %v", err)
+	}
+	defer client.Close()
+
+	firestoreService := firebase.NewFirestoreService(client)
+	plan, err := backup.PlanRestore(ctx, firestoreService, archive)
+	if err != nil {
+		log.Fatalf("Failed to compare backup with Firestore: %v", err)
+	}
+
+	fmt.Printf("Backup of %s taken %s, restoring into %s\n\n",
+		archive.ProjectID, archive.CreatedAt.Local().Format("2006-01-02 15:04:05"), projectName(fbConfig))
+	printPlan(plan)
+
+	if !*apply {
+		fmt.Println("\nDry run, nothing was changed. Run again with -apply to restore.")
+		return
+	}
+	if plan.Changes() == 0 {
+		fmt.Println("\nFirestore already matches the backup.")
+		return
+	}
+
+	err = backup.Restore(ctx, firestoreService, plan, func(done, total int) {
+		fmt.Printf("\rWritten %d/%d", done, total)
+	})
+	fmt.Println()
+	if err != nil {
+		log.Fatalf("Restore failed: %v", err)
+	}
+	fmt.Println("Restore completed.")
+}
+
+// printPlan prints the changes per collection
+func printPlan(plan *backup.Plan) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Collection\tCreate\tOverwrite\tDelete\tUnchanged\t")
+	for _, collection := range plan.Collections {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t\n", collection.Name,
+			len(collection.Create), len(collection.Overwrite), len(collection.Delete), collection.Unchanged)
+	}
+	w.Flush()
+}
+
+// projectName describes the project a config points at
+func projectName(fbConfig *firebase.FirebaseConfig) string {
+	if fbConfig.EmulatorEnabled() {
+		return "the Firestore emulator"
+	}
+	return fbConfig.ProjectID
+}
@@ -0,0 +1,109 @@
+// Command seed loads the default categories and sample products into the
+// Firestore emulator so the app can be run and tested offline.
+//
+// Usage:
+//
+//	FIRESTORE_EMULATOR_HOST=localhost:8080 go run ./cmd/seed
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"kasirnest/config"
+	"kasirnest/firebase"
+	"kasirnest/models"
+)
+
+func main() {
+	projectID := flag.String("project", "", "Firebase project ID (defaults to app.ini, then demo-kasirnest)")
+	flag.Parse()
+
+	fbConfig := loadFirebaseConfig()
+	if *projectID != "" {
+		fbConfig.ProjectID = *projectID
+	}
+
+	// Seeding is only ever meant for local emulators
+	if !fbConfig.EmulatorEnabled() {
+		log.Fatalf("Refusing to seed: emulator mode is off. Set %s or [emulator] enabled = true", firebase.FirestoreEmulatorEnv)
+	}
+
+	ctx := context.Background()
+	client, err := firebase.Initialize(ctx, fbConfig)
+	if err != nil {
+		log.Fatalf("Failed to initialize Firebase emulator client: %v", err)
+	}
+	defer client.Close()
+
+	firestoreService := firebase.NewFirestoreService(client)
+
+	var operations []firebase.BatchOperation
+	for _, category := range models.DefaultCategories() {
+		operations = append(operations, firebase.BatchOperation{
+			Operation:  "set",
+			Collection: "categories",
+			DocumentID: category.CategoryID,
+			Data:       category,
+		})
+	}
+
+	for _, product := range sampleProducts() {
+		operations = append(operations, firebase.BatchOperation{
+			Operation:  "set",
+			Collection: "products",
+			DocumentID: product.ProductID,
+			Data:       product,
+		})
+	}
+
+	if err := firestoreService.BatchWrite(ctx, operations); err != nil {
+		log.Fatalf("Failed to seed emulator: %v", err)
+	}
+
+	fmt.Printf("Seeded %d categories and %d products into the emulator at %s\n",
+		len(models.DefaultCategories()), len(sampleProducts()), os.Getenv(firebase.FirestoreEmulatorEnv))
+}
+
+// loadFirebaseConfig reads app.ini, falling back to a bare emulator config
+// when no config file exists but FIRESTORE_EMULATOR_HOST is set
+func loadFirebaseConfig() *firebase.FirebaseConfig {
+	cfg, err := config.Load()
+	if err == nil {
+		return cfg.Firebase
+	}
+
+	if os.Getenv(firebase.FirestoreEmulatorEnv) == "" {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	return &firebase.FirebaseConfig{UseEmulator: true}
+}
+
+// sampleProducts returns a small product catalogue for development
+func sampleProducts() []models.Product {
+	now := time.Now()
+	products := []models.Product{
+		{ProductID: "prod_indomie_goreng", Name: "Indomie Goreng", Price: 3500, Stock: 120, Category: "Makanan", Barcode: "089686010947"},
+		{ProductID: "prod_aqua_600", Name: "Aqua 600ml", Price: 4000, Stock: 96, Category: "Makanan", Barcode: "8886008101053"},
+		{ProductID: "prod_teh_botol", Name: "Teh Botol Sosro 450ml", Price: 5500, Stock: 48, Category: "Makanan", Barcode: "8993240000016"},
+		{ProductID: "prod_baterai_aa", Name: "Baterai AA (2 pcs)", Price: 12000, Stock: 30, Category: "Elektronik", Barcode: "8888021200188"},
+		{ProductID: "prod_kaos_kaki", Name: "Kaos Kaki Katun", Price: 15000, Stock: 25, Category: "Fashion"},
+		{ProductID: "prod_minyak_kayu_putih", Name: "Minyak Kayu Putih 60ml", Price: 22000, Stock: 18, Category: "Kesehatan", Barcode: "8993176110070"},
+		{ProductID: "prod_sabun_cuci", Name: "Sabun Cuci Piring 780ml", Price: 14500, Stock: 40, Category: "Rumah Tangga", Barcode: "8999999002527"},
+		{ProductID: "prod_pulpen_hitam", Name: "Pulpen Hitam", Price: 3000, Stock: 200, Category: "Alat Tulis", Barcode: "8993988060020"},
+		{ProductID: "prod_buku_tulis", Name: "Buku Tulis 38 Lembar", Price: 4500, Stock: 3, Category: "Alat Tulis"},
+		{ProductID: "prod_korek_api", Name: "Korek Api", Price: 2000, Stock: 0, Category: "Lainnya"},
+	}
+
+	for i := range products {
+		products[i].CreatedAt = now
+		products[i].UpdatedAt = now
+	}
+
+	return products
+}
@@ -0,0 +1,73 @@
+// Command setrole gives a Firebase Auth user the admin or kasir role. The
+// role is stored as a custom claim, so it reaches a signed in app when its
+// ID token is next refreshed, at most an hour later.
+//
+// Usage:
+//
+//	go run ./cmd/setrole -email owner@example.com -role admin
+//	go run ./cmd/setrole -email kasir1@example.com -role kasir
+//
+// Use it to make the first admin; later admins can manage users in the app.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"kasirnest/config"
+	"kasirnest/firebase"
+	"kasirnest/models"
+	"kasirnest/repository"
+)
+
+func main() {
+	email := flag.String("email", "", "email address of the user")
+	role := flag.String("role", "", "role to give: admin or kasir")
+	flag.Parse()
+
+	if *email == "" || !models.ValidRole(*role) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	ctx := context.Background()
+	client, err := firebase.Initialize(ctx, cfg.Firebase)
+	if err != nil {
+		log.Fatalf("Failed to initialize Firebase: %v", err)
+	}
+	defer client.Close()
+
+	authService := firebase.NewAuthService(client)
+	user, err := authService.GetUserByEmail(ctx, *email)
+	if err != nil {
+		log.Fatalf("Failed to find user %s: %v", *email, err)
+	}
+	if err := authService.SetRole(ctx, user.UID, *role); err != nil {
+		log.Fatalf("Failed to set role: %v", err)
+	}
+
+	// Keep the role shown in the users collection in step with the claim
+	users := repository.NewFirestoreRepositories(client).Users
+	profile, err := users.Get(ctx, user.UID)
+	switch {
+	case errors.Is(err, models.ErrUserNotFound):
+	case err != nil:
+		log.Printf("Role set, but the user profile could not be read: %v", err)
+	default:
+		profile.Role = *role
+		if err := users.Save(ctx, profile); err != nil {
+			log.Printf("Role set, but the user profile could not be updated: %v", err)
+		}
+	}
+
+	fmt.Printf("%s (%s) is now %s\n", *email, user.UID, *role)
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"kasirnest/firebase"
 
@@ -18,6 +19,7 @@ type Config struct {
 	App      *AppConfig
 	Security *SecurityConfig
 	Database *DatabaseConfig
+	Storage  *firebase.StorageConfig
 	filePath string
 }
 
@@ -34,13 +36,18 @@ type AppConfig struct {
 // SecurityConfig holds security-related configuration
 type SecurityConfig struct {
 	EncryptionKey  string
-	SessionTimeout int
+	SessionTimeout int // seconds from login until the password is asked again, 0 for never
+	IdleTimeout    int // seconds without activity until the screen locks, 0 for never
 }
 
 // DatabaseConfig holds database-related configuration
 type DatabaseConfig struct {
-	AutoBackup     bool
-	BackupInterval int
+	AutoBackup      bool
+	BackupInterval  int    // hours between automatic backups
+	BackupDir       string // directory holding the encrypted backups
+	BackupRetention int    // number of backups to keep, 0 keeps all
+	LocalPath       string // embedded offline database
+	SyncInterval    int    // seconds between background syncs
 }
 
 // Load loads configuration from app.ini file
@@ -74,6 +81,11 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("configuration file not found. Please create app.ini from app.ini.example")
 	}
 
+	return LoadFile(configFile)
+}
+
+// LoadFile loads configuration from the given ini file
+func LoadFile(configFile string) (*Config, error) {
 	cfg, err := ini.Load(configFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load config file: %v", err)
@@ -95,6 +107,23 @@ func Load() (*Config, error) {
 		AuthProviderX509: cfg.Section("firebase").Key("auth_provider_x509_cert_url").String(),
 		ClientX509:       cfg.Section("firebase").Key("client_x509_cert_url").String(),
 		StorageBucket:    cfg.Section("firebase").Key("storage_bucket").String(),
+		APIKey:           cfg.Section("firebase").Key("api_key").String(),
+
+		UseEmulator:           cfg.Section("emulator").Key("enabled").MustBool(false),
+		FirestoreEmulatorHost: cfg.Section("emulator").Key("firestore_host").String(),
+		AuthEmulatorHost:      cfg.Section("emulator").Key("auth_host").String(),
+		StorageEmulatorHost:   cfg.Section("emulator").Key("storage_host").String(),
+	}
+
+	// Load per-operation timeouts
+	defaults := firebase.DefaultTimeouts()
+	timeouts := cfg.Section("timeouts")
+	config.Firebase.Timeouts = firebase.Timeouts{
+		Read:    seconds(timeouts.Key("read"), defaults.Read),
+		Query:   seconds(timeouts.Key("query"), defaults.Query),
+		Write:   seconds(timeouts.Key("write"), defaults.Write),
+		Auth:    seconds(timeouts.Key("auth"), defaults.Auth),
+		Storage: seconds(timeouts.Key("storage"), defaults.Storage),
 	}
 
 	// Load App configuration
@@ -111,19 +140,46 @@ func Load() (*Config, error) {
 	config.Security = &SecurityConfig{
 		EncryptionKey:  cfg.Section("security").Key("encryption_key").String(),
 		SessionTimeout: cfg.Section("security").Key("session_timeout").MustInt(3600),
+		IdleTimeout:    cfg.Section("security").Key("idle_timeout").MustInt(300),
 	}
 
 	// Load Database configuration
 	config.Database = &DatabaseConfig{
-		AutoBackup:     cfg.Section("database").Key("auto_backup").MustBool(true),
-		BackupInterval: cfg.Section("database").Key("backup_interval").MustInt(24),
+		AutoBackup:      cfg.Section("database").Key("auto_backup").MustBool(true),
+		BackupInterval:  cfg.Section("database").Key("backup_interval").MustInt(24),
+		BackupDir:       cfg.Section("database").Key("backup_dir").MustString(filepath.Join("data", "backups")),
+		BackupRetention: cfg.Section("database").Key("backup_retention").MustInt(7),
+		LocalPath:       cfg.Section("database").Key("local_path").MustString(filepath.Join("data", "kasirnest.db")),
+		SyncInterval:    cfg.Section("database").Key("sync_interval").MustInt(30),
+	}
+
+	// Load Storage configuration
+	config.Storage = &firebase.StorageConfig{
+		Backend:   cfg.Section("storage").Key("backend").In(firebase.StorageBackendFirebase, []string{firebase.StorageBackendFirebase, firebase.StorageBackendLocal}),
+		LocalDir:  cfg.Section("storage").Key("local_dir").MustString(filepath.Join("data", "storage")),
+		CacheDir:  cfg.Section("storage").Key("cache_dir").MustString(filepath.Join("data", "cache", "images")),
+		CacheSize: cfg.Section("storage").Key("cache_size").MustInt(200),
 	}
 
 	return config, nil
 }
 
+// seconds reads a duration given in whole seconds
+func seconds(key *ini.Key, def time.Duration) time.Duration {
+	return time.Duration(key.MustInt(int(def/time.Second))) * time.Second
+}
+
 // Validate validates the configuration
 func (c *Config) Validate() error {
+	if c.Security.EncryptionKey == "" || strings.Contains(c.Security.EncryptionKey, "your-") {
+		return fmt.Errorf("security encryption_key is not configured")
+	}
+
+	// Emulators need no service account credentials
+	if c.Firebase.EmulatorEnabled() {
+		return nil
+	}
+
 	// Validate Firebase config
 	if c.Firebase.ProjectID == "" || strings.Contains(c.Firebase.ProjectID, "your-") {
 		return fmt.Errorf("firebase project_id is not configured")
@@ -137,8 +193,8 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("firebase private_key is not configured")
 	}
 
-	if c.Security.EncryptionKey == "" || strings.Contains(c.Security.EncryptionKey, "your-") {
-		return fmt.Errorf("security encryption_key is not configured")
+	if c.Firebase.APIKey == "" || strings.Contains(c.Firebase.APIKey, "your-") {
+		return fmt.Errorf("firebase api_key is not configured")
 	}
 
 	return nil
@@ -160,6 +216,22 @@ func (c *Config) Save() error {
 	firebaseSection.NewKey("auth_provider_x509_cert_url", c.Firebase.AuthProviderX509)
 	firebaseSection.NewKey("client_x509_cert_url", c.Firebase.ClientX509)
 	firebaseSection.NewKey("storage_bucket", c.Firebase.StorageBucket)
+	firebaseSection.NewKey("api_key", c.Firebase.APIKey)
+
+	// Emulator section
+	emulatorSection, _ := cfg.NewSection("emulator")
+	emulatorSection.NewKey("enabled", strconv.FormatBool(c.Firebase.UseEmulator))
+	emulatorSection.NewKey("firestore_host", c.Firebase.FirestoreEmulatorHost)
+	emulatorSection.NewKey("auth_host", c.Firebase.AuthEmulatorHost)
+	emulatorSection.NewKey("storage_host", c.Firebase.StorageEmulatorHost)
+
+	// Timeouts section
+	timeoutsSection, _ := cfg.NewSection("timeouts")
+	timeoutsSection.NewKey("read", strconv.Itoa(int(c.Firebase.Timeouts.Read/time.Second)))
+	timeoutsSection.NewKey("query", strconv.Itoa(int(c.Firebase.Timeouts.Query/time.Second)))
+	timeoutsSection.NewKey("write", strconv.Itoa(int(c.Firebase.Timeouts.Write/time.Second)))
+	timeoutsSection.NewKey("auth", strconv.Itoa(int(c.Firebase.Timeouts.Auth/time.Second)))
+	timeoutsSection.NewKey("storage", strconv.Itoa(int(c.Firebase.Timeouts.Storage/time.Second)))
 
 	// App section
 	appSection, _ := cfg.NewSection("app")
@@ -174,11 +246,23 @@ func (c *Config) Save() error {
 	securitySection, _ := cfg.NewSection("security")
 	securitySection.NewKey("encryption_key", c.Security.EncryptionKey)
 	securitySection.NewKey("session_timeout", strconv.Itoa(c.Security.SessionTimeout))
+	securitySection.NewKey("idle_timeout", strconv.Itoa(c.Security.IdleTimeout))
 
 	// Database section
 	databaseSection, _ := cfg.NewSection("database")
 	databaseSection.NewKey("auto_backup", strconv.FormatBool(c.Database.AutoBackup))
 	databaseSection.NewKey("backup_interval", strconv.Itoa(c.Database.BackupInterval))
+	databaseSection.NewKey("backup_dir", c.Database.BackupDir)
+	databaseSection.NewKey("backup_retention", strconv.Itoa(c.Database.BackupRetention))
+	databaseSection.NewKey("local_path", c.Database.LocalPath)
+	databaseSection.NewKey("sync_interval", strconv.Itoa(c.Database.SyncInterval))
+
+	// Storage section
+	storageSection, _ := cfg.NewSection("storage")
+	storageSection.NewKey("backend", c.Storage.Backend)
+	storageSection.NewKey("local_dir", c.Storage.LocalDir)
+	storageSection.NewKey("cache_dir", c.Storage.CacheDir)
+	storageSection.NewKey("cache_size", strconv.Itoa(c.Storage.CacheSize))
 
 	return cfg.SaveTo(c.filePath)
 }
@@ -2,65 +2,65 @@ package firebase
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	"firebase.google.com/go/v4/auth"
+	"google.golang.org/api/iterator"
+
+	"kasirnest/models"
 )
 
+// RoleClaim is the custom claim holding the role of a user
+const RoleClaim = "role"
+
 // AuthService handles Firebase Authentication operations
 type AuthService struct {
-	client *auth.Client
-	ctx    context.Context
+	client      *auth.Client
+	timeouts    Timeouts
+	retry       RetryPolicy
+	apiKey      string // Web API key for the sign-in REST APIs
+	identityURL string
 }
 
 // NewAuthService creates a new auth service
 func NewAuthService(client *Client) *AuthService {
 	return &AuthService{
-		client: client.Auth,
-		ctx:    client.GetContext(),
-	}
-}
-
-// LoginWithEmailPassword authenticates user with email and password
-// Note: This is server-side authentication, client-side auth should use Firebase SDK
-func (a *AuthService) LoginWithEmailPassword(email, password string) (*auth.UserRecord, error) {
-	if a.client == nil {
-		return nil, errors.New("auth client not initialized")
-	}
-
-	// Get user by email
-	user, err := a.client.GetUserByEmail(a.ctx, email)
-	if err != nil {
-		return nil, err
+		client:      client.Auth,
+		timeouts:    client.timeouts,
+		retry:       client.retry,
+		apiKey:      client.apiKey,
+		identityURL: identityBaseURL(client.emulator),
 	}
-
-	// Note: Server-side password verification is not directly supported
-	// This would typically be done on the client-side using Firebase Auth SDK
-	// For now, we'll just return the user record
-	return user, nil
 }
 
 // GetUser gets user by UID
-func (a *AuthService) GetUser(uid string) (*auth.UserRecord, error) {
+func (a *AuthService) GetUser(ctx context.Context, uid string) (*auth.UserRecord, error) {
 	if a.client == nil {
 		return nil, errors.New("auth client not initialized")
 	}
 
-	return a.client.GetUser(a.ctx, uid)
+	return runValue(a.retry, ctx, a.timeouts.Auth, func(ctx context.Context) (*auth.UserRecord, error) {
+		return a.client.GetUser(ctx, uid)
+	})
 }
 
 // GetUserByEmail gets user by email
-func (a *AuthService) GetUserByEmail(email string) (*auth.UserRecord, error) {
+func (a *AuthService) GetUserByEmail(ctx context.Context, email string) (*auth.UserRecord, error) {
 	if a.client == nil {
 		return nil, errors.New("auth client not initialized")
 	}
 
-	return a.client.GetUserByEmail(a.ctx, email)
+	return runValue(a.retry, ctx, a.timeouts.Auth, func(ctx context.Context) (*auth.UserRecord, error) {
+		return a.client.GetUserByEmail(ctx, email)
+	})
 }
 
 // CreateUser creates a new user
-func (a *AuthService) CreateUser(email, password, displayName string) (*auth.UserRecord, error) {
+func (a *AuthService) CreateUser(ctx context.Context, email, password, displayName string) (*auth.UserRecord, error) {
 	if a.client == nil {
 		return nil, errors.New("auth client not initialized")
 	}
@@ -71,94 +71,289 @@ func (a *AuthService) CreateUser(email, password, displayName string) (*auth.Use
 		DisplayName(displayName).
 		EmailVerified(false)
 
-	return a.client.CreateUser(a.ctx, params)
+	// A retried create could fail with a duplicate email after all
+	return runValue(noRetry, ctx, a.timeouts.Auth, func(ctx context.Context) (*auth.UserRecord, error) {
+		return a.client.CreateUser(ctx, params)
+	})
 }
 
 // UpdateUser updates user information
-func (a *AuthService) UpdateUser(uid string, displayName string) (*auth.UserRecord, error) {
+func (a *AuthService) UpdateUser(ctx context.Context, uid string, displayName string) (*auth.UserRecord, error) {
 	if a.client == nil {
 		return nil, errors.New("auth client not initialized")
 	}
 
 	params := (&auth.UserToUpdate{}).DisplayName(displayName)
-	return a.client.UpdateUser(a.ctx, uid, params)
+	return runValue(a.retry, ctx, a.timeouts.Auth, func(ctx context.Context) (*auth.UserRecord, error) {
+		return a.client.UpdateUser(ctx, uid, params)
+	})
+}
+
+// SetPassword replaces the password of a user
+func (a *AuthService) SetPassword(ctx context.Context, uid, password string) error {
+	if a.client == nil {
+		return errors.New("auth client not initialized")
+	}
+
+	params := (&auth.UserToUpdate{}).Password(password)
+	return a.retry.run(ctx, a.timeouts.Auth, func(ctx context.Context) error {
+		_, err := a.client.UpdateUser(ctx, uid, params)
+		return err
+	})
+}
+
+// SetDisabled disables or enables a user. Disabled users cannot sign in or
+// refresh their session.
+func (a *AuthService) SetDisabled(ctx context.Context, uid string, disabled bool) error {
+	if a.client == nil {
+		return errors.New("auth client not initialized")
+	}
+
+	params := (&auth.UserToUpdate{}).Disabled(disabled)
+	return a.retry.run(ctx, a.timeouts.Auth, func(ctx context.Context) error {
+		_, err := a.client.UpdateUser(ctx, uid, params)
+		return err
+	})
+}
+
+// PasswordResetLink creates a link that lets the user with email choose a
+// new password, for inviting users without telling them a password
+func (a *AuthService) PasswordResetLink(ctx context.Context, email string) (string, error) {
+	if a.client == nil {
+		return "", errors.New("auth client not initialized")
+	}
+
+	return runValue(a.retry, ctx, a.timeouts.Auth, func(ctx context.Context) (string, error) {
+		return a.client.PasswordResetLink(ctx, email)
+	})
 }
 
 // DeleteUser deletes a user
-func (a *AuthService) DeleteUser(uid string) error {
+func (a *AuthService) DeleteUser(ctx context.Context, uid string) error {
 	if a.client == nil {
 		return errors.New("auth client not initialized")
 	}
 
-	return a.client.DeleteUser(a.ctx, uid)
+	return a.retry.run(ctx, a.timeouts.Auth, func(ctx context.Context) error {
+		return a.client.DeleteUser(ctx, uid)
+	})
 }
 
 // VerifyIDToken verifies Firebase ID token
-func (a *AuthService) VerifyIDToken(idToken string) (*auth.Token, error) {
+func (a *AuthService) VerifyIDToken(ctx context.Context, idToken string) (*auth.Token, error) {
 	if a.client == nil {
 		return nil, errors.New("auth client not initialized")
 	}
 
-	return a.client.VerifyIDToken(a.ctx, idToken)
+	return runValue(a.retry, ctx, a.timeouts.Auth, func(ctx context.Context) (*auth.Token, error) {
+		return a.client.VerifyIDToken(ctx, idToken)
+	})
 }
 
 // CreateCustomToken creates a custom token for authentication
-func (a *AuthService) CreateCustomToken(uid string) (string, error) {
+func (a *AuthService) CreateCustomToken(ctx context.Context, uid string) (string, error) {
 	if a.client == nil {
 		return "", errors.New("auth client not initialized")
 	}
 
-	return a.client.CustomToken(a.ctx, uid)
+	return runValue(a.retry, ctx, a.timeouts.Auth, func(ctx context.Context) (string, error) {
+		return a.client.CustomToken(ctx, uid)
+	})
 }
 
 // SetCustomUserClaims sets custom claims for a user
-func (a *AuthService) SetCustomUserClaims(uid string, claims map[string]interface{}) error {
+func (a *AuthService) SetCustomUserClaims(ctx context.Context, uid string, claims map[string]interface{}) error {
 	if a.client == nil {
 		return errors.New("auth client not initialized")
 	}
 
-	return a.client.SetCustomUserClaims(a.ctx, uid, claims)
+	return a.retry.run(ctx, a.timeouts.Auth, func(ctx context.Context) error {
+		return a.client.SetCustomUserClaims(ctx, uid, claims)
+	})
 }
 
-// ListUsers lists all users with pagination
-func (a *AuthService) ListUsers(maxResults int, pageToken string) ([]*auth.UserRecord, string, error) {
+// SetRole stores role in the RoleClaim custom claim of a user, keeping its
+// other claims. It takes effect when the user's ID token is next refreshed.
+func (a *AuthService) SetRole(ctx context.Context, uid, role string) error {
+	if !models.ValidRole(role) {
+		return fmt.Errorf("unknown role %q", role)
+	}
+
+	user, err := a.GetUser(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	claims := make(map[string]interface{}, len(user.CustomClaims)+1)
+	for key, value := range user.CustomClaims {
+		claims[key] = value
+	}
+	claims[RoleClaim] = role
+	return a.SetCustomUserClaims(ctx, uid, claims)
+}
+
+// maxUsersPerRequest is the largest page Firebase Auth returns
+const maxUsersPerRequest = 1000
+
+// UserStatus filters users by whether they are disabled
+type UserStatus int
+
+// User statuses for UserQuery
+const (
+	AnyStatus UserStatus = iota
+	ActiveUsers
+	DisabledUsers
+)
+
+// UserQuery describes a page of Firebase Auth users. Firebase Auth cannot
+// filter, so filtered pages are built by reading users in batches of
+// maxUsersPerRequest and keeping the matching ones.
+type UserQuery struct {
+	Role      string     // only users with this role, empty for all
+	Status    UserStatus // only active or only disabled users
+	Limit     int        // zero for all matching users
+	PageToken string     // opaque cursor from a previous page
+}
+
+// UserPage is a single page of users
+type UserPage struct {
+	Users         []*auth.UserRecord
+	NextPageToken string // empty when there are no more results
+}
+
+// filtered reports whether q drops any users
+func (q UserQuery) filtered() bool {
+	return q.Role != "" || q.Status != AnyStatus
+}
+
+// matches reports whether user passes the filters of q
+func (q UserQuery) matches(user *auth.UserRecord) bool {
+	if q.Role != "" && roleFromClaims(user.CustomClaims) != q.Role {
+		return false
+	}
+	switch q.Status {
+	case ActiveUsers:
+		return !user.Disabled
+	case DisabledUsers:
+		return user.Disabled
+	}
+	return true
+}
+
+// userCursor is the position of a page in the Firebase Auth user list: the
+// users after skipping Skip users of the batch of Size users at Token
+type userCursor struct {
+	Token string `json:"t,omitempty"`
+	Size  int    `json:"n,omitempty"`
+	Skip  int    `json:"s,omitempty"`
+}
+
+// encode returns the cursor as a page token
+func (c userCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeUserCursor parses a page token returned by ListUsers
+func decodeUserCursor(pageToken string) (userCursor, error) {
+	var cursor userCursor
+	if pageToken == "" {
+		return cursor, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(pageToken)
+	if err == nil {
+		err = json.Unmarshal(data, &cursor)
+	}
+	if err != nil || cursor.Size < 0 || cursor.Size > maxUsersPerRequest || cursor.Skip < 0 {
+		return cursor, errors.New("invalid page token")
+	}
+	return cursor, nil
+}
+
+// ListUsers returns a page of users matching query in the order Firebase
+// Auth keeps them. Failures are returned rather than ending the page early.
+func (a *AuthService) ListUsers(ctx context.Context, query UserQuery) (*UserPage, error) {
 	if a.client == nil {
-		return nil, "", errors.New("auth client not initialized")
+		return nil, errors.New("auth client not initialized")
 	}
 
-	iter := a.client.Users(a.ctx, pageToken)
-	iter.PageInfo().MaxSize = maxResults
+	cursor, err := decodeUserCursor(query.PageToken)
+	if err != nil {
+		return nil, err
+	}
 
-	var users []*auth.UserRecord
-	nextPageToken := ""
+	// Unfiltered pages are read in one batch, filtered ones scan as many
+	// users per request as possible
+	batchSize := maxUsersPerRequest
+	if !query.filtered() && query.Limit > 0 && query.Limit < batchSize {
+		batchSize = query.Limit
+	}
+	if cursor.Size == 0 {
+		cursor.Size = batchSize
+	}
 
+	page := &UserPage{}
 	for {
-		user, err := iter.Next()
+		batch, next, err := a.listUsersBatch(ctx, cursor.Size, cursor.Token)
 		if err != nil {
-			break
+			return nil, err
 		}
-		// Convert ExportedUserRecord to UserRecord if needed
-		userRecord := &auth.UserRecord{
-			UserInfo:               user.UserInfo,
-			CustomClaims:           user.CustomClaims,
-			Disabled:               user.Disabled,
-			EmailVerified:          user.EmailVerified,
-			ProviderUserInfo:       user.ProviderUserInfo,
-			TokensValidAfterMillis: user.TokensValidAfterMillis,
+
+		for i := cursor.Skip; i < len(batch); i++ {
+			if !query.matches(batch[i]) {
+				continue
+			}
+			page.Users = append(page.Users, batch[i])
+			if query.Limit <= 0 || len(page.Users) < query.Limit {
+				continue
+			}
+
+			switch {
+			case i+1 < len(batch):
+				page.NextPageToken = userCursor{Token: cursor.Token, Size: cursor.Size, Skip: i + 1}.encode()
+			case next != "":
+				page.NextPageToken = userCursor{Token: next, Size: batchSize}.encode()
+			}
+			return page, nil
 		}
-		users = append(users, userRecord)
+
+		if next == "" {
+			return page, nil
+		}
+		cursor = userCursor{Token: next, Size: batchSize}
 	}
+}
 
-	return users, nextPageToken, nil
+// listUsersBatch reads up to size users starting at pageToken
+func (a *AuthService) listUsersBatch(ctx context.Context, size int, pageToken string) ([]*auth.UserRecord, string, error) {
+	var users []*auth.UserRecord
+	var next string
+	err := a.retry.run(ctx, a.timeouts.Auth, func(ctx context.Context) error {
+		var exported []*auth.ExportedUserRecord
+		var err error
+		next, err = iterator.NewPager(a.client.Users(ctx, ""), size, pageToken).NextPage(&exported)
+		if err != nil {
+			return err
+		}
+
+		users = make([]*auth.UserRecord, len(exported))
+		for i, user := range exported {
+			users[i] = user.UserRecord
+		}
+		return nil
+	})
+	return users, next, err
 }
 
 // RevokeRefreshTokens revokes all refresh tokens for a user
-func (a *AuthService) RevokeRefreshTokens(uid string) error {
+func (a *AuthService) RevokeRefreshTokens(ctx context.Context, uid string) error {
 	if a.client == nil {
 		return errors.New("auth client not initialized")
 	}
 
-	return a.client.RevokeRefreshTokens(a.ctx, uid)
+	return a.retry.run(ctx, a.timeouts.Auth, func(ctx context.Context) error {
+		return a.client.RevokeRefreshTokens(ctx, uid)
+	})
 }
 
 // UserInfo represents simplified user information
@@ -171,6 +366,34 @@ type UserInfo struct {
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+// UserFromRecord returns the profile of an Auth user as stored in the users
+// collection, with the role from its custom claims
+func UserFromRecord(record *auth.UserRecord) models.User {
+	user := models.User{
+		UserID:   record.UID,
+		Email:    record.Email,
+		Name:     record.DisplayName,
+		Role:     roleFromClaims(record.CustomClaims),
+		Disabled: record.Disabled,
+	}
+	if record.UserMetadata != nil {
+		user.CreatedAt = time.UnixMilli(record.UserMetadata.CreationTimestamp)
+		if record.UserMetadata.LastLogInTimestamp > 0 {
+			user.LastLogin = time.UnixMilli(record.UserMetadata.LastLogInTimestamp)
+		}
+	}
+	return user
+}
+
+// roleFromClaims returns the role in the RoleClaim claim. Users without a
+// known role get the least privileged one.
+func roleFromClaims(claims map[string]interface{}) string {
+	if role, _ := claims[RoleClaim].(string); models.ValidRole(role) {
+		return role
+	}
+	return models.RoleKasir
+}
+
 // ConvertUserRecord converts auth.UserRecord to UserInfo
 func ConvertUserRecord(user *auth.UserRecord) *UserInfo {
 	return &UserInfo{
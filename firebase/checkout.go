@@ -0,0 +1,141 @@
+package firebase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"cloud.google.com/go/firestore"
+
+	"kasirnest/models"
+)
+
+// CheckoutService handles atomic sale checkout
+type CheckoutService struct {
+	client   *firestore.Client
+	timeouts Timeouts
+}
+
+// NewCheckoutService creates a new checkout service
+func NewCheckoutService(client *Client) *CheckoutService {
+	return &CheckoutService{
+		client:   client.Firestore,
+		timeouts: client.timeouts,
+	}
+}
+
+// Checkout decrements product stock and writes the transaction document
+// in a single Firestore transaction. Every product in the cart is re-read
+// inside the transaction so concurrent terminals cannot oversell. A sale
+// that was already committed, e.g. by an attempt whose response was lost,
+// returns models.ErrAlreadyExists without checking stock again. Another
+// sale stored under the same ID returns models.ErrTransactionConflict.
+func (cs *CheckoutService) Checkout(ctx context.Context, transaction *models.Transaction) error {
+	if cs.client == nil {
+		return errors.New("firestore client not initialized")
+	}
+
+	if transaction == nil || len(transaction.Items) == 0 {
+		return models.ErrInvalidQuantity
+	}
+
+	// Sum quantities per product, the cart may list a product more than once
+	quantities := make(map[string]int)
+	var productIDs []string
+	for _, item := range transaction.Items {
+		if item.Quantity <= 0 {
+			return models.ErrInvalidQuantity
+		}
+		if _, exists := quantities[item.ProductID]; !exists {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		quantities[item.ProductID] += item.Quantity
+	}
+
+	products := cs.client.Collection("products")
+	transRef := cs.client.Collection("transactions").Doc(transaction.TransID)
+
+	// RunTransaction already retries aborted transactions, anything else is
+	// left to the caller since the sale may have been committed
+	err := noRetry.run(ctx, cs.timeouts.Write, func(ctx context.Context) error {
+		return cs.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			refs := make([]*firestore.DocumentRef, len(productIDs))
+			for i, productID := range productIDs {
+				refs[i] = products.Doc(productID)
+			}
+
+			// All reads must happen before any writes. The transaction is
+			// read last, its stock was already taken if it exists.
+			docs, err := tx.GetAll(append(refs[:len(refs):len(refs)], transRef))
+			if err != nil {
+				return err
+			}
+			if stored := docs[len(docs)-1]; stored.Exists() {
+				return existingSale(stored, transaction)
+			}
+			docs = docs[:len(docs)-1]
+
+			stocked := make([]models.Product, len(docs))
+			var insufficient []string
+			for i, doc := range docs {
+				if !doc.Exists() {
+					return fmt.Errorf("%w: %s", models.ErrProductNotFound, productIDs[i])
+				}
+				if err := doc.DataTo(&stocked[i]); err != nil {
+					return err
+				}
+				if !stocked[i].CanSell(quantities[productIDs[i]]) {
+					insufficient = append(insufficient, productIDs[i])
+				}
+			}
+
+			if len(insufficient) > 0 {
+				return &models.StockError{ProductIDs: insufficient}
+			}
+
+			for i, ref := range refs {
+				product := &stocked[i]
+				if err := product.UpdateStock(quantities[productIDs[i]]); err != nil {
+					return err
+				}
+
+				err := tx.Update(ref, []firestore.Update{
+					{Path: "stock", Value: product.Stock},
+					{Path: "updated_at", Value: product.UpdatedAt},
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			return tx.Create(transRef, *transaction)
+		})
+	})
+	var backendErr *BackendError
+	if errors.As(err, &backendErr) && errors.Is(err, models.ErrAlreadyExists) {
+		// Created by another checkout between the read and the commit
+		return noRetry.run(ctx, cs.timeouts.Read, func(ctx context.Context) error {
+			doc, err := transRef.Get(ctx)
+			if err != nil {
+				return err
+			}
+			return existingSale(doc, transaction)
+		})
+	}
+	return err
+}
+
+// existingSale returns the error for a checkout whose transaction document
+// already exists: ErrAlreadyExists when it holds the same sale, otherwise
+// ErrTransactionConflict
+func existingSale(doc *firestore.DocumentSnapshot, transaction *models.Transaction) error {
+	var stored models.Transaction
+	if err := doc.DataTo(&stored); err != nil {
+		return err
+	}
+	stored.SetID(doc.Ref.ID)
+	if !stored.SameSale(transaction) {
+		return fmt.Errorf("%w: %s", models.ErrTransactionConflict, transaction.TransID)
+	}
+	return fmt.Errorf("%w: transaction %s", models.ErrAlreadyExists, transaction.TransID)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"os"
 
 	"cloud.google.com/go/firestore"
 	"cloud.google.com/go/storage"
@@ -19,7 +20,11 @@ type Client struct {
 	Auth      *auth.Client
 	Firestore *firestore.Client
 	Storage   *storage.Client
-	ctx       context.Context
+	emulator  bool
+	apiKey    string
+	timeouts  Timeouts
+	retry     RetryPolicy
+	listeners *listenerGroup
 }
 
 // FirebaseConfig holds Firebase configuration
@@ -34,11 +39,37 @@ type FirebaseConfig struct {
 	AuthProviderX509 string
 	ClientX509       string
 	StorageBucket    string
+	APIKey           string // Web API key, needed to sign users in
+
+	// Local emulator settings, used for offline development and tests
+	UseEmulator           bool
+	FirestoreEmulatorHost string
+	AuthEmulatorHost      string
+	StorageEmulatorHost   string
+
+	// Per-operation limits, unset values fall back to DefaultTimeouts
+	Timeouts Timeouts
 }
 
-// Initialize creates and initializes Firebase clients
-func Initialize(config *FirebaseConfig) (*Client, error) {
-	ctx := context.Background()
+// Emulator host environment variables honoured by the Google client libraries
+const (
+	FirestoreEmulatorEnv = "FIRESTORE_EMULATOR_HOST"
+	AuthEmulatorEnv      = "FIREBASE_AUTH_EMULATOR_HOST"
+	StorageEmulatorEnv   = "STORAGE_EMULATOR_HOST"
+)
+
+// EmulatorEnabled reports whether the client should talk to local emulators,
+// either because the config asks for it or FIRESTORE_EMULATOR_HOST is set
+func (c *FirebaseConfig) EmulatorEnabled() bool {
+	return c.UseEmulator || os.Getenv(FirestoreEmulatorEnv) != ""
+}
+
+// Initialize creates and initializes Firebase clients.
+// ctx only bounds the setup, service calls take their own context.
+func Initialize(ctx context.Context, config *FirebaseConfig) (*Client, error) {
+	if config.EmulatorEnabled() {
+		return initializeEmulator(ctx, config)
+	}
 
 	// Create credentials JSON
 	credentialsJSON := createCredentialsJSON(config)
@@ -79,17 +110,114 @@ func Initialize(config *FirebaseConfig) (*Client, error) {
 		Auth:      authClient,
 		Firestore: firestoreClient,
 		Storage:   rawStorageClient,
-		ctx:       ctx,
+		apiKey:    config.APIKey,
+		timeouts:  config.Timeouts.withDefaults(),
+		retry:     DefaultRetryPolicy(),
+		listeners: newListenerGroup(context.Background()),
+	}, nil
+}
+
+// initializeEmulator creates clients that talk to the local Firebase emulators
+// without any credentials. Hosts from the config are only used when the
+// matching environment variable is not already set.
+func initializeEmulator(ctx context.Context, config *FirebaseConfig) (*Client, error) {
+	hosts := map[string]string{
+		FirestoreEmulatorEnv: config.FirestoreEmulatorHost,
+		AuthEmulatorEnv:      config.AuthEmulatorHost,
+		StorageEmulatorEnv:   config.StorageEmulatorHost,
+	}
+	for env, host := range hosts {
+		if os.Getenv(env) == "" && host != "" {
+			if err := os.Setenv(env, host); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if os.Getenv(FirestoreEmulatorEnv) == "" {
+		return nil, fmt.Errorf("emulator mode requires %s or firestore_host to be set", FirestoreEmulatorEnv)
+	}
+
+	projectID := config.ProjectID
+	if projectID == "" {
+		projectID = "demo-kasirnest"
+	}
+
+	opt := option.WithoutAuthentication()
+	app, err := firebase.NewApp(ctx, &firebase.Config{
+		ProjectID:     projectID,
+		StorageBucket: config.StorageBucket,
+	}, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Auth needs the Auth emulator, there are no credentials to fall back on
+	var authClient *auth.Client
+	if os.Getenv(AuthEmulatorEnv) != "" {
+		authClient, err = app.Auth(ctx)
+		if err != nil {
+			log.Printf("Failed to initialize Auth emulator client: %v", err)
+		}
+	} else {
+		log.Printf("%s not set, running without Auth", AuthEmulatorEnv)
+	}
+
+	firestoreClient, err := app.Firestore(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Storage likewise only works against the Storage emulator
+	var storageClient *storage.Client
+	if os.Getenv(StorageEmulatorEnv) != "" {
+		storageClient, err = storage.NewClient(ctx, opt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create storage emulator client: %v", err)
+		}
+	} else {
+		log.Printf("%s not set, running without Storage", StorageEmulatorEnv)
+	}
+
+	log.Printf("Using Firebase emulators (Firestore at %s)", os.Getenv(FirestoreEmulatorEnv))
+
+	return &Client{
+		App:       app,
+		Auth:      authClient,
+		Firestore: firestoreClient,
+		Storage:   storageClient,
+		emulator:  true,
+		apiKey:    emulatorAPIKey(config.APIKey),
+		timeouts:  config.Timeouts.withDefaults(),
+		retry:     DefaultRetryPolicy(),
+		listeners: newListenerGroup(context.Background()),
 	}, nil
 }
 
-// GetContext returns the context used by the client
-func (c *Client) GetContext() context.Context {
-	return c.ctx
+// emulatorAPIKey returns the API key used with the Auth emulator, which
+// accepts any key
+func emulatorAPIKey(apiKey string) string {
+	if apiKey == "" {
+		return "demo-api-key"
+	}
+	return apiKey
+}
+
+// IsEmulator reports whether the client is connected to local emulators
+func (c *Client) IsEmulator() bool {
+	return c.emulator
 }
 
-// Close closes all Firebase clients
+// Timeouts returns the per-operation timeouts applied by the services
+func (c *Client) Timeouts() Timeouts {
+	return c.timeouts
+}
+
+// Close stops all snapshot listeners and closes all Firebase clients
 func (c *Client) Close() error {
+	if c.listeners != nil {
+		c.listeners.close()
+	}
 	if c.Firestore != nil {
 		return c.Firestore.Close()
 	}
@@ -0,0 +1,246 @@
+package firebase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Collection is a typed handle to a Firestore collection
+type Collection[T any] struct {
+	client    *firestore.Client
+	name      string
+	timeouts  Timeouts
+	retry     RetryPolicy
+	listeners *listenerGroup
+}
+
+// NewCollection creates a typed handle for the named collection
+func NewCollection[T any](client *Client, name string) *Collection[T] {
+	return &Collection[T]{
+		client:    client.Firestore,
+		name:      name,
+		timeouts:  client.timeouts,
+		retry:     client.retry,
+		listeners: client.listeners,
+	}
+}
+
+// Name returns the collection name
+func (c *Collection[T]) Name() string {
+	return c.name
+}
+
+// Get retrieves a single document by ID
+func (c *Collection[T]) Get(ctx context.Context, documentID string) (*T, error) {
+	if c.client == nil {
+		return nil, errors.New("firestore client not initialized")
+	}
+
+	var doc *firestore.DocumentSnapshot
+	err := c.retry.run(ctx, c.timeouts.Read, func(ctx context.Context) error {
+		var err error
+		doc, err = c.client.Collection(c.name).Doc(documentID).Get(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var item T
+	if err := doc.DataTo(&item); err != nil {
+		return nil, &DecodeError{DocumentID: doc.Ref.ID, Err: err}
+	}
+	setDocumentID(&item, doc.Ref.ID)
+
+	return &item, nil
+}
+
+// List retrieves all documents in the collection.
+// Documents that fail to decode are skipped and reported as DecodeErrors
+// alongside the documents that decoded successfully.
+func (c *Collection[T]) List(ctx context.Context) ([]T, error) {
+	if c.client == nil {
+		return nil, errors.New("firestore client not initialized")
+	}
+
+	var items []T
+	err := c.retry.run(ctx, c.timeouts.Query, func(ctx context.Context) error {
+		var err error
+		items, err = c.decode(c.client.Collection(c.name).Documents(ctx))
+		return err
+	})
+	return items, err
+}
+
+// Query retrieves the documents matching all filters.
+// Decode failures are reported the same way as in List.
+func (c *Collection[T]) Query(ctx context.Context, filters []QueryFilter) ([]T, error) {
+	if c.client == nil {
+		return nil, errors.New("firestore client not initialized")
+	}
+
+	query, err := applyFilters(c.client.Collection(c.name).Query, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []T
+	err = c.retry.run(ctx, c.timeouts.Query, func(ctx context.Context) error {
+		var err error
+		items, err = c.decode(query.Documents(ctx))
+		return err
+	})
+	return items, err
+}
+
+// Page is a single page of query results
+type Page[T any] struct {
+	Items         []T
+	NextPageToken string // empty when there are no more results
+}
+
+// Find runs a query described by spec and returns one page of results.
+// Pass the returned NextPageToken in the next spec to fetch the following page.
+func (c *Collection[T]) Find(ctx context.Context, spec QuerySpec) (*Page[T], error) {
+	if c.client == nil {
+		return nil, errors.New("firestore client not initialized")
+	}
+
+	limit := spec.Limit
+	if limit > 0 {
+		// Fetch one extra document to know whether another page exists
+		spec.Limit = limit + 1
+	}
+
+	var ids []string
+	var items []T
+	err := c.retry.run(ctx, c.timeouts.Query, func(ctx context.Context) error {
+		query, err := buildQuery(ctx, c.client.Collection(c.name), spec)
+		if err != nil {
+			return err
+		}
+
+		// Start over on every attempt so a retry does not duplicate results
+		ids = nil
+		items = make([]T, 0)
+		return decodeDocuments(query.Documents(ctx), func(doc *firestore.DocumentSnapshot) error {
+			ids = append(ids, doc.Ref.ID)
+			if limit > 0 && len(ids) > limit {
+				return nil
+			}
+
+			var item T
+			if err := doc.DataTo(&item); err != nil {
+				return err
+			}
+			setDocumentID(&item, doc.Ref.ID)
+			items = append(items, item)
+			return nil
+		})
+	})
+	if err != nil && !IsDecodeError(err) {
+		return nil, err
+	}
+
+	page := &Page[T]{Items: items}
+	if limit > 0 && len(ids) > limit {
+		page.NextPageToken = EncodePageToken(ids[limit-1])
+	}
+
+	return page, err
+}
+
+// decode drains the iterator into a slice of T
+func (c *Collection[T]) decode(iter *firestore.DocumentIterator) ([]T, error) {
+	items := make([]T, 0)
+	err := decodeDocuments(iter, func(doc *firestore.DocumentSnapshot) error {
+		var item T
+		if err := doc.DataTo(&item); err != nil {
+			return err
+		}
+		setDocumentID(&item, doc.Ref.ID)
+		items = append(items, item)
+		return nil
+	})
+
+	return items, err
+}
+
+// DecodeError reports a document that could not be decoded
+type DecodeError struct {
+	DocumentID string
+	Err        error
+}
+
+// Error implements the error interface
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decode document %s: %v", e.DocumentID, e.Err)
+}
+
+// Unwrap returns the underlying decode error
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeErrors collects the per-document failures of a read
+type DecodeErrors []*DecodeError
+
+// Error implements the error interface
+func (e DecodeErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d document(s) failed to decode: %s", len(e), strings.Join(messages, "; "))
+}
+
+// IsDecodeError reports whether err only describes per-document decode
+// failures, in which case the returned results are still usable
+func IsDecodeError(err error) bool {
+	var decodeErrs DecodeErrors
+	var decodeErr *DecodeError
+	return errors.As(err, &decodeErrs) || errors.As(err, &decodeErr)
+}
+
+// documentIDSetter is implemented by models that carry their document ID
+type documentIDSetter interface {
+	SetID(id string)
+}
+
+// setDocumentID attaches the Firestore document ID to dest when supported
+func setDocumentID(dest interface{}, id string) {
+	if setter, ok := dest.(documentIDSetter); ok {
+		setter.SetID(id)
+	}
+}
+
+// decodeDocuments drains iter, calling decode for every document.
+// Iteration errors abort immediately; decode errors are collected.
+func decodeDocuments(iter *firestore.DocumentIterator, decode func(doc *firestore.DocumentSnapshot) error) error {
+	defer iter.Stop()
+
+	var decodeErrs DecodeErrors
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := decode(doc); err != nil {
+			decodeErrs = append(decodeErrs, &DecodeError{DocumentID: doc.Ref.ID, Err: err})
+		}
+	}
+
+	if len(decodeErrs) > 0 {
+		return decodeErrs
+	}
+	return nil
+}
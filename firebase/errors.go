@@ -0,0 +1,101 @@
+package firebase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"cloud.google.com/go/storage"
+	"firebase.google.com/go/v4/errorutils"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"kasirnest/models"
+)
+
+// BackendError is a Firebase failure mapped to one of the domain errors in
+// package models. Both the domain error and the original error can be
+// matched with errors.Is and errors.As.
+type BackendError struct {
+	Kind error // domain error from package models
+	Err  error // error returned by the client library
+}
+
+// Error implements the error interface
+func (e *BackendError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+// Unwrap returns the domain error and the original error
+func (e *BackendError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// ClassifyError maps gRPC, HTTP and Firebase errors to domain errors.
+// A missing document or object becomes notFound; when notFound is nil the
+// error is returned unchanged so a caller that knows what was missing can
+// classify it later. Errors that are not backend failures, such as stock
+// or decode errors, are returned unchanged.
+func ClassifyError(err, notFound error) error {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	var backendErr *BackendError
+	if errors.As(err, &backendErr) {
+		return err
+	}
+
+	var kind error
+	switch {
+	case isNotFound(err):
+		if notFound == nil {
+			return err
+		}
+		kind = notFound
+	case errors.Is(err, context.DeadlineExceeded) || hasCode(err, codes.DeadlineExceeded, http.StatusGatewayTimeout) ||
+		errorutils.IsDeadlineExceeded(err):
+		kind = models.ErrTimeout
+	case hasCode(err, codes.Unavailable, http.StatusServiceUnavailable, http.StatusBadGateway) ||
+		errorutils.IsUnavailable(err):
+		kind = models.ErrUnavailable
+	case hasCode(err, codes.ResourceExhausted, http.StatusTooManyRequests) || errorutils.IsResourceExhausted(err):
+		kind = models.ErrQuotaExceeded
+	case hasCode(err, codes.AlreadyExists, http.StatusConflict) || errorutils.IsAlreadyExists(err):
+		kind = models.ErrAlreadyExists
+	case hasCode(err, codes.PermissionDenied, http.StatusForbidden) || hasCode(err, codes.Unauthenticated, http.StatusUnauthorized) ||
+		errorutils.IsPermissionDenied(err) || errorutils.IsUnauthenticated(err):
+		kind = models.ErrUnauthorized
+	default:
+		return err
+	}
+
+	return &BackendError{Kind: kind, Err: err}
+}
+
+// isNotFound reports whether err says a document, object or user is missing
+func isNotFound(err error) bool {
+	return errors.Is(err, storage.ErrObjectNotExist) ||
+		hasCode(err, codes.NotFound, http.StatusNotFound) ||
+		errorutils.IsNotFound(err)
+}
+
+// hasCode reports whether err carries the given gRPC code or one of the
+// given HTTP statuses
+func hasCode(err error, grpcCode codes.Code, httpStatuses ...int) bool {
+	if s, ok := status.FromError(err); ok {
+		return s.Code() == grpcCode
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		for _, httpStatus := range httpStatuses {
+			if apiErr.Code == httpStatus {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -2,57 +2,78 @@ package firebase
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"reflect"
 
 	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
 	"google.golang.org/api/iterator"
 )
 
 // FirestoreService handles Firestore operations
 type FirestoreService struct {
-	client *firestore.Client
-	ctx    context.Context
+	client    *firestore.Client
+	timeouts  Timeouts
+	retry     RetryPolicy
+	listeners *listenerGroup
 }
 
 // NewFirestoreService creates a new Firestore service
 func NewFirestoreService(client *Client) *FirestoreService {
 	return &FirestoreService{
-		client: client.Firestore,
-		ctx:    client.GetContext(),
+		client:    client.Firestore,
+		timeouts:  client.timeouts,
+		retry:     client.retry,
+		listeners: client.listeners,
 	}
 }
 
 // Create creates a new document in a collection
-func (fs *FirestoreService) Create(collection, documentID string, data interface{}) error {
+func (fs *FirestoreService) Create(ctx context.Context, collection, documentID string, data interface{}) error {
 	if fs.client == nil {
 		return errors.New("firestore client not initialized")
 	}
 
-	_, err := fs.client.Collection(collection).Doc(documentID).Set(fs.ctx, data)
-	return err
+	// Set overwrites the whole document, so repeating it is safe
+	return fs.retry.run(ctx, fs.timeouts.Write, func(ctx context.Context) error {
+		_, err := fs.client.Collection(collection).Doc(documentID).Set(ctx, data)
+		return err
+	})
 }
 
 // CreateWithAutoID creates a new document with auto-generated ID
-func (fs *FirestoreService) CreateWithAutoID(collection string, data interface{}) (string, error) {
+func (fs *FirestoreService) CreateWithAutoID(ctx context.Context, collection string, data interface{}) (string, error) {
 	if fs.client == nil {
 		return "", errors.New("firestore client not initialized")
 	}
 
-	doc, _, err := fs.client.Collection(collection).Add(fs.ctx, data)
-	if err != nil {
-		return "", err
-	}
-	return doc.ID, nil
+	// A retried Add could create the document twice
+	var documentID string
+	err := noRetry.run(ctx, fs.timeouts.Write, func(ctx context.Context) error {
+		doc, _, err := fs.client.Collection(collection).Add(ctx, data)
+		if err != nil {
+			return err
+		}
+		documentID = doc.ID
+		return nil
+	})
+	return documentID, err
 }
 
 // Get retrieves a document by ID
-func (fs *FirestoreService) Get(collection, documentID string, dest interface{}) error {
+func (fs *FirestoreService) Get(ctx context.Context, collection, documentID string, dest interface{}) error {
 	if fs.client == nil {
 		return errors.New("firestore client not initialized")
 	}
 
-	doc, err := fs.client.Collection(collection).Doc(documentID).Get(fs.ctx)
+	var doc *firestore.DocumentSnapshot
+	err := fs.retry.run(ctx, fs.timeouts.Read, func(ctx context.Context) error {
+		var err error
+		doc, err = fs.client.Collection(collection).Doc(documentID).Get(ctx)
+		return err
+	})
 	if err != nil {
 		return err
 	}
@@ -65,110 +86,161 @@ func (fs *FirestoreService) Get(collection, documentID string, dest interface{})
 }
 
 // Update updates an existing document
-func (fs *FirestoreService) Update(collection, documentID string, data interface{}) error {
+func (fs *FirestoreService) Update(ctx context.Context, collection, documentID string, data interface{}) error {
 	if fs.client == nil {
 		return errors.New("firestore client not initialized")
 	}
 
-	_, err := fs.client.Collection(collection).Doc(documentID).Set(fs.ctx, data, firestore.MergeAll)
-	return err
+	return fs.retry.run(ctx, fs.timeouts.Write, func(ctx context.Context) error {
+		_, err := fs.client.Collection(collection).Doc(documentID).Set(ctx, data, firestore.MergeAll)
+		return err
+	})
 }
 
 // Delete deletes a document
-func (fs *FirestoreService) Delete(collection, documentID string) error {
+func (fs *FirestoreService) Delete(ctx context.Context, collection, documentID string) error {
 	if fs.client == nil {
 		return errors.New("firestore client not initialized")
 	}
 
-	_, err := fs.client.Collection(collection).Doc(documentID).Delete(fs.ctx)
-	return err
+	return fs.retry.run(ctx, fs.timeouts.Write, func(ctx context.Context) error {
+		_, err := fs.client.Collection(collection).Doc(documentID).Delete(ctx)
+		return err
+	})
 }
 
-// List retrieves all documents from a collection
-func (fs *FirestoreService) List(collection string, dest interface{}) error {
+// List retrieves all documents from a collection into dest,
+// which must be a pointer to a slice of structs or struct pointers
+func (fs *FirestoreService) List(ctx context.Context, collection string, dest interface{}) error {
 	if fs.client == nil {
 		return errors.New("firestore client not initialized")
 	}
 
-	iter := fs.client.Collection(collection).Documents(fs.ctx)
-	defer iter.Stop()
-
-	var results []map[string]interface{}
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return err
-		}
-
-		data := doc.Data()
-		// Add document ID to the data
-		data["id"] = doc.Ref.ID
-		results = append(results, data)
-	}
-
-	// This is a simplified implementation
-	// In a real application, you'd want to properly handle type conversion
-	return nil
+	return fs.retry.run(ctx, fs.timeouts.Query, func(ctx context.Context) error {
+		return decodeInto(fs.client.Collection(collection).Documents(ctx), dest)
+	})
 }
 
-// Query executes a query with filters
-func (fs *FirestoreService) Query(collection string, filters []QueryFilter, dest interface{}) error {
+// Query executes a query with filters and decodes the results into dest
+func (fs *FirestoreService) Query(ctx context.Context, collection string, filters []QueryFilter, dest interface{}) error {
 	if fs.client == nil {
 		return errors.New("firestore client not initialized")
 	}
 
-	query := fs.client.Collection(collection).Query
+	query, err := applyFilters(fs.client.Collection(collection).Query, filters)
+	if err != nil {
+		return err
+	}
 
-	// Apply filters
+	return fs.retry.run(ctx, fs.timeouts.Query, func(ctx context.Context) error {
+		return decodeInto(query.Documents(ctx), dest)
+	})
+}
+
+// applyFilters adds the where-clauses described by filters to query
+func applyFilters(query firestore.Query, filters []QueryFilter) (firestore.Query, error) {
 	for _, filter := range filters {
 		switch filter.Operator {
-		case "==":
-			query = query.Where(filter.Field, "==", filter.Value)
-		case "!=":
-			query = query.Where(filter.Field, "!=", filter.Value)
-		case ">":
-			query = query.Where(filter.Field, ">", filter.Value)
-		case ">=":
-			query = query.Where(filter.Field, ">=", filter.Value)
-		case "<":
-			query = query.Where(filter.Field, "<", filter.Value)
-		case "<=":
-			query = query.Where(filter.Field, "<=", filter.Value)
-		case "array-contains":
-			query = query.Where(filter.Field, "array-contains", filter.Value)
-		case "in":
-			query = query.Where(filter.Field, "in", filter.Value)
+		case "==", "!=", ">", ">=", "<", "<=", "array-contains", "in":
+			query = query.Where(filter.Field, filter.Operator, filter.Value)
 		default:
-			return fmt.Errorf("unsupported operator: %s", filter.Operator)
+			return query, fmt.Errorf("unsupported operator: %s", filter.Operator)
 		}
 	}
 
-	iter := query.Documents(fs.ctx)
-	defer iter.Stop()
+	return query, nil
+}
 
-	var results []map[string]interface{}
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
+// buildQuery turns spec into a Firestore query on collection.
+// A page token is resolved to the document it points at, and the query
+// resumes just after that document.
+func buildQuery(ctx context.Context, collection *firestore.CollectionRef, spec QuerySpec) (firestore.Query, error) {
+	query, err := applyFilters(collection.Query, spec.Filters)
+	if err != nil {
+		return query, err
+	}
+
+	for _, order := range spec.OrderBy {
+		direction := firestore.Asc
+		if order.Descending {
+			direction = firestore.Desc
 		}
+		query = query.OrderBy(order.Field, direction)
+	}
+
+	if spec.PageToken != "" {
+		documentID, err := DecodePageToken(spec.PageToken)
 		if err != nil {
-			return err
+			return query, err
 		}
 
-		data := doc.Data()
-		data["id"] = doc.Ref.ID
-		results = append(results, data)
+		cursor, err := collection.Doc(documentID).Get(ctx)
+		if err != nil {
+			return query, fmt.Errorf("invalid page token: %v", err)
+		}
+		query = query.StartAfter(cursor)
+	}
+
+	if spec.Limit > 0 {
+		query = query.Limit(spec.Limit)
 	}
 
-	return nil
+	return query, nil
+}
+
+// EncodePageToken creates an opaque page token for a document. Local
+// copies of a collection page with the same tokens.
+func EncodePageToken(documentID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(documentID))
+}
+
+// DecodePageToken returns the document ID stored in a page token
+func DecodePageToken(token string) (string, error) {
+	documentID, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(documentID) == 0 {
+		return "", errors.New("invalid page token")
+	}
+	return string(documentID), nil
+}
+
+// decodeInto drains iter into dest, a pointer to a slice.
+// Documents that fail to decode are reported as DecodeErrors.
+func decodeInto(iter *firestore.DocumentIterator, dest interface{}) error {
+	slice := reflect.ValueOf(dest)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		iter.Stop()
+		return errors.New("dest must be a pointer to a slice")
+	}
+	slice = slice.Elem()
+
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+
+	results := reflect.MakeSlice(slice.Type(), 0, 0)
+	err := decodeDocuments(iter, func(doc *firestore.DocumentSnapshot) error {
+		item := reflect.New(elemType)
+		if err := doc.DataTo(item.Interface()); err != nil {
+			return err
+		}
+		setDocumentID(item.Interface(), doc.Ref.ID)
+
+		if isPtr {
+			results = reflect.Append(results, item)
+		} else {
+			results = reflect.Append(results, item.Elem())
+		}
+		return nil
+	})
+
+	slice.Set(results)
+	return err
 }
 
 // BatchWrite performs multiple operations in a single batch
-func (fs *FirestoreService) BatchWrite(operations []BatchOperation) error {
+func (fs *FirestoreService) BatchWrite(ctx context.Context, operations []BatchOperation) error {
 	if fs.client == nil {
 		return errors.New("firestore client not initialized")
 	}
@@ -190,32 +262,120 @@ func (fs *FirestoreService) BatchWrite(operations []BatchOperation) error {
 		}
 	}
 
-	_, err := batch.Commit(fs.ctx)
-	return err
+	// Every operation overwrites or deletes a fixed document, so a batch
+	// whose response was lost can be committed again
+	return fs.retry.run(ctx, fs.timeouts.Write, func(ctx context.Context) error {
+		_, err := batch.Commit(ctx)
+		return err
+	})
 }
 
 // GetCollectionSize returns the number of documents in a collection
-func (fs *FirestoreService) GetCollectionSize(collection string) (int, error) {
+func (fs *FirestoreService) GetCollectionSize(ctx context.Context, collection string) (int, error) {
+	return fs.Count(ctx, collection, nil)
+}
+
+// Count returns the number of documents matching all filters.
+// The count is computed by Firestore without reading the documents.
+func (fs *FirestoreService) Count(ctx context.Context, collection string, filters []QueryFilter) (int, error) {
+	result, err := fs.Aggregate(ctx, collection, filters)
+	if err != nil {
+		return 0, err
+	}
+	return result.Count, nil
+}
+
+// Sum returns the sum of field over the documents matching all filters
+func (fs *FirestoreService) Sum(ctx context.Context, collection, field string, filters []QueryFilter) (float64, error) {
+	result, err := fs.Aggregate(ctx, collection, filters, field)
+	if err != nil {
+		return 0, err
+	}
+	return result.Sums[field], nil
+}
+
+// Aggregate counts the documents matching all filters and sums each of
+// sumFields over them in a single server-side aggregation query
+func (fs *FirestoreService) Aggregate(ctx context.Context, collection string, filters []QueryFilter, sumFields ...string) (*AggregateResult, error) {
 	if fs.client == nil {
-		return 0, errors.New("firestore client not initialized")
+		return nil, errors.New("firestore client not initialized")
 	}
 
-	iter := fs.client.Collection(collection).Documents(fs.ctx)
-	defer iter.Stop()
+	query, err := applyFilters(fs.client.Collection(collection).Query, filters)
+	if err != nil {
+		return nil, err
+	}
 
-	count := 0
-	for {
-		_, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
+	aggregation := query.NewAggregationQuery().WithCount(countAlias)
+	for i, field := range sumFields {
+		aggregation = aggregation.WithSum(field, sumAlias(i))
+	}
+
+	var values firestore.AggregationResult
+	err = fs.retry.run(ctx, fs.timeouts.Query, func(ctx context.Context) error {
+		var err error
+		values, err = aggregation.Get(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := aggregateNumber(values, countAlias)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &AggregateResult{Count: int(count), Sums: make(map[string]float64, len(sumFields))}
+	for i, field := range sumFields {
+		sum, err := aggregateNumber(values, sumAlias(i))
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
-		count++
+		result.Sums[field] = sum
 	}
 
-	return count, nil
+	return result, nil
+}
+
+// AggregateResult holds the results of an aggregation query
+type AggregateResult struct {
+	Count int
+	Sums  map[string]float64 // keyed by field name
+}
+
+// countAlias is the alias of the count in aggregation queries
+const countAlias = "count"
+
+// sumAlias returns the alias of the i-th sum in aggregation queries.
+// Field paths are not valid aliases, so sums are numbered instead.
+func sumAlias(i int) string {
+	return fmt.Sprintf("sum_%d", i)
+}
+
+// aggregateNumber reads a numeric aggregation result
+func aggregateNumber(values firestore.AggregationResult, alias string) (float64, error) {
+	raw, ok := values[alias]
+	if !ok {
+		return 0, fmt.Errorf("aggregation result %q missing", alias)
+	}
+
+	value, ok := raw.(*firestorepb.Value)
+	if !ok {
+		return 0, fmt.Errorf("unexpected aggregation result type %T", raw)
+	}
+
+	switch v := value.GetValueType().(type) {
+	case *firestorepb.Value_IntegerValue:
+		return float64(v.IntegerValue), nil
+	case *firestorepb.Value_DoubleValue:
+		return v.DoubleValue, nil
+	case *firestorepb.Value_NullValue:
+		// Sum over no documents
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("unexpected aggregation value %v", value)
+	}
 }
 
 // QueryFilter represents a query filter
@@ -225,6 +385,51 @@ type QueryFilter struct {
 	Value    interface{} `json:"value"`
 }
 
+// QuerySpec describes a query with filters, ordering and pagination
+type QuerySpec struct {
+	Filters   []QueryFilter `json:"filters,omitempty"`
+	OrderBy   []OrderBy     `json:"order_by,omitempty"`
+	Limit     int           `json:"limit,omitempty"`
+	PageToken string        `json:"page_token,omitempty"` // opaque cursor from a previous page
+}
+
+// OrderBy represents a query ordering
+type OrderBy struct {
+	Field      string `json:"field"`
+	Descending bool   `json:"descending"`
+}
+
+// Document is a Firestore document with its fields left undecoded
+type Document struct {
+	ID   string
+	Data map[string]interface{}
+}
+
+// Documents returns every document in a collection without decoding it
+// into a model, so no field is lost when the documents are exported
+func (fs *FirestoreService) Documents(ctx context.Context, collection string) ([]Document, error) {
+	if fs.client == nil {
+		return nil, errors.New("firestore client not initialized")
+	}
+
+	return runValue(fs.retry, ctx, fs.timeouts.Query, func(ctx context.Context) ([]Document, error) {
+		iter := fs.client.Collection(collection).Documents(ctx)
+		defer iter.Stop()
+
+		documents := make([]Document, 0)
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				return documents, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			documents = append(documents, Document{ID: doc.Ref.ID, Data: doc.Data()})
+		}
+	})
+}
+
 // BatchOperation represents a batch operation
 type BatchOperation struct {
 	Operation  string      `json:"operation"` // "create", "update", "delete"
@@ -234,12 +439,17 @@ type BatchOperation struct {
 }
 
 // Exists checks if a document exists
-func (fs *FirestoreService) Exists(collection, documentID string) (bool, error) {
+func (fs *FirestoreService) Exists(ctx context.Context, collection, documentID string) (bool, error) {
 	if fs.client == nil {
 		return false, errors.New("firestore client not initialized")
 	}
 
-	doc, err := fs.client.Collection(collection).Doc(documentID).Get(fs.ctx)
+	var doc *firestore.DocumentSnapshot
+	err := fs.retry.run(ctx, fs.timeouts.Read, func(ctx context.Context) error {
+		var err error
+		doc, err = fs.client.Collection(collection).Doc(documentID).Get(ctx)
+		return err
+	})
 	if err != nil {
 		return false, err
 	}
@@ -0,0 +1,259 @@
+package firebase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleapi"
+
+	"kasirnest/models"
+)
+
+// Endpoints of the REST APIs behind client-side Firebase Auth. The Admin SDK
+// cannot check passwords, so sign-in goes through them like the web SDK.
+const (
+	signInPath  = "identitytoolkit.googleapis.com/v1/accounts:signInWithPassword"
+	refreshPath = "securetoken.googleapis.com/v1/token"
+)
+
+// sessionRefreshMargin is how long before expiry an ID token is refreshed
+const sessionRefreshMargin = 5 * time.Minute
+
+// Session is a user signed in with Firebase Auth
+type Session struct {
+	UID          string
+	Email        string
+	DisplayName  string
+	IDToken      string
+	RefreshToken string
+	ExpiresAt    time.Time              // when IDToken expires
+	Claims       map[string]interface{} // from the verified ID token
+}
+
+// NeedsRefresh reports whether the ID token expires soon
+func (s *Session) NeedsRefresh() bool {
+	return time.Now().Add(sessionRefreshMargin).After(s.ExpiresAt)
+}
+
+// RefreshIn returns how long until the ID token should be refreshed
+func (s *Session) RefreshIn() time.Duration {
+	return time.Until(s.ExpiresAt.Add(-sessionRefreshMargin))
+}
+
+// Role returns the role in the RoleClaim claim. Users without a known role
+// get the least privileged one.
+func (s *Session) Role() string {
+	return roleFromClaims(s.Claims)
+}
+
+// User returns the signed in user with the role of the session
+func (s *Session) User() *models.User {
+	return &models.User{
+		UserID: s.UID,
+		Email:  s.Email,
+		Name:   s.DisplayName,
+		Role:   s.Role(),
+	}
+}
+
+// IdentityError is an error returned by the Identity Toolkit or Secure
+// Token API, such as INVALID_PASSWORD or USER_DISABLED
+type IdentityError struct {
+	StatusCode int
+	Code       string
+}
+
+// Error implements the error interface
+func (e *IdentityError) Error() string {
+	return fmt.Sprintf("firebase auth: %s (HTTP %d)", e.Code, e.StatusCode)
+}
+
+// identityErrors maps Identity Toolkit error codes to domain errors. Wrong
+// email and wrong password share one error so logins do not reveal which
+// accounts exist.
+var identityErrors = map[string]error{
+	"EMAIL_NOT_FOUND":             models.ErrInvalidCredentials,
+	"INVALID_PASSWORD":            models.ErrInvalidCredentials,
+	"INVALID_LOGIN_CREDENTIALS":   models.ErrInvalidCredentials,
+	"INVALID_EMAIL":               models.ErrInvalidCredentials,
+	"MISSING_PASSWORD":            models.ErrInvalidCredentials,
+	"USER_DISABLED":               models.ErrUserDisabled,
+	"TOO_MANY_ATTEMPTS_TRY_LATER": models.ErrTooManyAttempts,
+	"TOKEN_EXPIRED":               models.ErrSessionExpired,
+	"INVALID_REFRESH_TOKEN":       models.ErrSessionExpired,
+	"INVALID_ID_TOKEN":            models.ErrSessionExpired,
+	"USER_NOT_FOUND":              models.ErrSessionExpired,
+}
+
+// identityBaseURL returns the scheme and host prefix of the auth REST APIs,
+// the Auth emulator serves them under its own host
+func identityBaseURL(emulator bool) string {
+	if host := os.Getenv(AuthEmulatorEnv); emulator && host != "" {
+		return "http://" + host + "/"
+	}
+	return "https://"
+}
+
+// LoginWithEmailPassword checks the password of a user with the Identity
+// Toolkit and returns the verified session. Wrong credentials, disabled
+// users and locked accounts return models.ErrInvalidCredentials,
+// models.ErrUserDisabled and models.ErrTooManyAttempts.
+func (a *AuthService) LoginWithEmailPassword(ctx context.Context, email, password string) (*Session, error) {
+	var response struct {
+		LocalID      string `json:"localId"`
+		Email        string `json:"email"`
+		DisplayName  string `json:"displayName"`
+		IDToken      string `json:"idToken"`
+		RefreshToken string `json:"refreshToken"`
+		ExpiresIn    string `json:"expiresIn"`
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"email":             email,
+		"password":          password,
+		"returnSecureToken": true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.postIdentity(ctx, signInPath, "application/json", body, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{
+		UID:          response.LocalID,
+		Email:        response.Email,
+		DisplayName:  response.DisplayName,
+		IDToken:      response.IDToken,
+		RefreshToken: response.RefreshToken,
+		ExpiresAt:    expiresAt(response.ExpiresIn),
+	}
+	return session, a.verifySession(ctx, session)
+}
+
+// RefreshSession exchanges a refresh token for a new ID token. A revoked
+// or expired refresh token, or a deleted user, returns
+// models.ErrSessionExpired; a disabled user models.ErrUserDisabled.
+func (a *AuthService) RefreshSession(ctx context.Context, refreshToken string) (*Session, error) {
+	var response struct {
+		UserID       string `json:"user_id"`
+		IDToken      string `json:"id_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    string `json:"expires_in"`
+	}
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	}
+
+	err := a.postIdentity(ctx, refreshPath, "application/x-www-form-urlencoded", []byte(form.Encode()), &response)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{
+		UID:          response.UserID,
+		IDToken:      response.IDToken,
+		RefreshToken: response.RefreshToken,
+		ExpiresAt:    expiresAt(response.ExpiresIn),
+	}
+	if err := a.verifySession(ctx, session); err != nil {
+		return nil, err
+	}
+
+	// The token response carries no profile, the verified claims do
+	session.Email, _ = session.Claims["email"].(string)
+	session.DisplayName, _ = session.Claims["name"].(string)
+	return session, nil
+}
+
+// verifySession verifies the ID token of session and records its claims
+func (a *AuthService) verifySession(ctx context.Context, session *Session) error {
+	token, err := a.VerifyIDToken(ctx, session.IDToken)
+	if err != nil {
+		return err
+	}
+	if token.UID != session.UID {
+		return fmt.Errorf("ID token belongs to %s, not %s", token.UID, session.UID)
+	}
+
+	session.Claims = token.Claims
+	return nil
+}
+
+// postIdentity sends a request to one of the auth REST APIs and decodes
+// the JSON response into result
+func (a *AuthService) postIdentity(ctx context.Context, path, contentType string, body []byte, result interface{}) error {
+	if a.apiKey == "" {
+		return errors.New("firebase api_key is not configured")
+	}
+	endpoint := a.identityURL + path + "?key=" + url.QueryEscape(a.apiKey)
+
+	return a.retry.run(ctx, a.timeouts.Auth, func(ctx context.Context) error {
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Content-Type", contentType)
+
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return &BackendError{Kind: models.ErrUnavailable, Err: err}
+		}
+		defer response.Body.Close()
+
+		data, err := io.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
+		if response.StatusCode != http.StatusOK {
+			return identityError(response.StatusCode, data)
+		}
+		return json.Unmarshal(data, result)
+	})
+}
+
+// identityError converts an error response of the auth REST APIs. Server
+// failures become googleapi errors so they are retried and classified like
+// those of the other services.
+func identityError(statusCode int, data []byte) error {
+	var response struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	json.Unmarshal(data, &response)
+
+	// Messages may carry details, e.g. "TOO_MANY_ATTEMPTS_TRY_LATER : Access..."
+	code, _, _ := strings.Cut(response.Error.Message, " ")
+	if kind, ok := identityErrors[code]; ok {
+		return &BackendError{Kind: kind, Err: &IdentityError{StatusCode: statusCode, Code: code}}
+	}
+	if statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError {
+		return &googleapi.Error{Code: statusCode, Message: response.Error.Message}
+	}
+	return &IdentityError{StatusCode: statusCode, Code: code}
+}
+
+// expiresAt converts an expires_in value in seconds to a time
+func expiresAt(expiresIn string) time.Time {
+	seconds, err := strconv.Atoi(expiresIn)
+	if err != nil {
+		seconds = 3600 // ID tokens are valid for an hour
+	}
+	return time.Now().Add(time.Duration(seconds) * time.Second)
+}
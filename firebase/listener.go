@@ -0,0 +1,145 @@
+package firebase
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Delays between attempts to re-establish a broken snapshot listener
+const (
+	listenRetryMin = time.Second
+	listenRetryMax = 30 * time.Second
+)
+
+// listenerGroup owns the goroutines of all snapshot listeners started from
+// a client, so closing the client can stop them and wait for them to exit
+type listenerGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// newListenerGroup creates a listener group bound to ctx
+func newListenerGroup(ctx context.Context) *listenerGroup {
+	ctx, cancel := context.WithCancel(ctx)
+	return &listenerGroup{ctx: ctx, cancel: cancel}
+}
+
+// close stops every listener and waits for their goroutines to return
+func (g *listenerGroup) close() {
+	g.cancel()
+	g.wg.Wait()
+}
+
+// Listener is a running snapshot listener
+type Listener struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Stop stops the listener and waits until its handler is no longer called
+func (l *Listener) Stop() {
+	l.cancel()
+	<-l.done
+}
+
+// listen runs handler for every snapshot of query until the listener is
+// stopped, parent is cancelled or the client is closed. When the stream
+// breaks the error is passed to handler and the listener reconnects with
+// exponential backoff.
+func (g *listenerGroup) listen(parent context.Context, query firestore.Query, handler func(*firestore.QuerySnapshot, error)) *Listener {
+	ctx, cancel := context.WithCancel(g.ctx)
+	stopWithParent := context.AfterFunc(parent, cancel)
+	listener := &Listener{cancel: cancel, done: make(chan struct{})}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer close(listener.done)
+		defer stopWithParent()
+
+		delay := listenRetryMin
+		for {
+			err := receiveSnapshots(ctx, query, func(snapshot *firestore.QuerySnapshot) {
+				delay = listenRetryMin
+				handler(snapshot, nil)
+			})
+			if ctx.Err() != nil {
+				return
+			}
+
+			log.Printf("Snapshot listener interrupted, retrying in %v: %v", delay, err)
+			handler(nil, err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+
+			delay *= 2
+			if delay > listenRetryMax {
+				delay = listenRetryMax
+			}
+		}
+	}()
+
+	return listener
+}
+
+// receiveSnapshots passes snapshots to handler until the stream fails
+func receiveSnapshots(ctx context.Context, query firestore.Query, handler func(*firestore.QuerySnapshot)) error {
+	iter := query.Snapshots(ctx)
+	defer iter.Stop()
+
+	for {
+		snapshot, err := iter.Next()
+		if err != nil {
+			if ctx.Err() != nil && (status.Code(err) == codes.Canceled || errors.Is(err, context.Canceled)) {
+				return ctx.Err()
+			}
+			return err
+		}
+		handler(snapshot)
+	}
+}
+
+// Listen calls handler with the matching documents whenever the query
+// results change. Listeners stop when Stop is called, ctx is cancelled or
+// the client is closed.
+func (fs *FirestoreService) Listen(ctx context.Context, collection string, filters []QueryFilter, handler func(*firestore.QuerySnapshot, error)) (*Listener, error) {
+	if fs.client == nil {
+		return nil, errors.New("firestore client not initialized")
+	}
+
+	query, err := applyFilters(fs.client.Collection(collection).Query, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.listeners.listen(ctx, query, handler), nil
+}
+
+// Listen calls handler with every document in the collection whenever the
+// collection changes. Decode failures are reported the same way as in List.
+func (c *Collection[T]) Listen(ctx context.Context, handler func([]T, error)) (*Listener, error) {
+	if c.client == nil {
+		return nil, errors.New("firestore client not initialized")
+	}
+
+	query := c.client.Collection(c.name).Query
+	return c.listeners.listen(ctx, query, func(snapshot *firestore.QuerySnapshot, err error) {
+		if err != nil {
+			handler(nil, err)
+			return
+		}
+		handler(c.decode(snapshot.Documents))
+	}), nil
+}
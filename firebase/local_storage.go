@@ -0,0 +1,365 @@
+package firebase
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// localMetaDir holds the metadata of every stored file and the temporary
+// files of uploads in progress, it is never listed
+const localMetaDir = ".meta"
+
+// LocalStorage is a FileStorage that keeps files in a local directory.
+// Download URLs are file:// URLs, so files work without a connection.
+type LocalStorage struct {
+	root string
+}
+
+// localMeta is the metadata stored next to a file
+type localMeta struct {
+	ContentType string    `json:"content_type"`
+	MD5         string    `json:"md5"`
+	Created     time.Time `json:"created"`
+}
+
+// NewLocalStorage creates a local storage rooted at dir
+func NewLocalStorage(dir string) (*LocalStorage, error) {
+	if dir == "" {
+		return nil, errors.New("local storage directory is not configured")
+	}
+
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(root, localMetaDir), 0700); err != nil {
+		return nil, err
+	}
+
+	return &LocalStorage{root: root}, nil
+}
+
+// objectPath returns the clean object name and its path on disk
+func (s *LocalStorage) objectPath(fileName string) (string, string, error) {
+	name := strings.TrimPrefix(path.Clean("/"+fileName), "/")
+	if name == "" || name == localMetaDir || strings.HasPrefix(name, localMetaDir+"/") {
+		return "", "", fmt.Errorf("invalid file name: %q", fileName)
+	}
+	return name, filepath.Join(s.root, filepath.FromSlash(name)), nil
+}
+
+// metaPath returns where the metadata of the named object is kept
+func (s *LocalStorage) metaPath(name string) string {
+	return filepath.Join(s.root, localMetaDir, filepath.FromSlash(name)+".json")
+}
+
+// UploadFile stores data under fileName and returns its file:// URL
+func (s *LocalStorage) UploadFile(ctx context.Context, fileName string, data io.Reader, contentType string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	name, filePath, err := s.objectPath(fileName)
+	if err != nil {
+		return "", err
+	}
+	if err := s.write(name, filePath, data, contentType); err != nil {
+		return "", err
+	}
+
+	return s.GetDownloadURL(ctx, name)
+}
+
+// write stores data at filePath through a temporary file, so readers never
+// see a partial file, and records its metadata
+func (s *LocalStorage) write(name, filePath string, data io.Reader, contentType string) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(s.root, localMetaDir), "upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := md5.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		return err
+	}
+
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(name))
+	}
+	return s.writeMeta(name, localMeta{
+		ContentType: contentType,
+		MD5:         hex.EncodeToString(hash.Sum(nil)),
+		Created:     time.Now(),
+	})
+}
+
+// writeMeta stores the metadata of the named object
+func (s *LocalStorage) writeMeta(name string, meta localMeta) error {
+	metaPath := s.metaPath(name)
+	if err := os.MkdirAll(filepath.Dir(metaPath), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metaPath, data, 0600)
+}
+
+// readMeta loads the metadata of the named object. Files copied into the
+// directory by hand have none, their metadata is derived from the file.
+func (s *LocalStorage) readMeta(name, filePath string, info os.FileInfo) (localMeta, error) {
+	var meta localMeta
+	data, err := os.ReadFile(s.metaPath(name))
+	if err == nil && json.Unmarshal(data, &meta) == nil {
+		return meta, nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return meta, err
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return meta, err
+	}
+
+	return localMeta{
+		ContentType: mime.TypeByExtension(path.Ext(name)),
+		MD5:         hex.EncodeToString(hash.Sum(nil)),
+		Created:     info.ModTime(),
+	}, nil
+}
+
+// DownloadFile opens a stored file
+func (s *LocalStorage) DownloadFile(ctx context.Context, fileName string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	_, filePath, err := s.objectPath(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrFileNotFound
+	}
+	return file, err
+}
+
+// GetDownloadURL returns the file:// URL of a stored file
+func (s *LocalStorage) GetDownloadURL(ctx context.Context, fileName string) (string, error) {
+	_, filePath, err := s.objectPath(fileName)
+	if err != nil {
+		return "", err
+	}
+
+	// Windows paths need a leading slash before the drive letter
+	urlPath := filepath.ToSlash(filePath)
+	if !strings.HasPrefix(urlPath, "/") {
+		urlPath = "/" + urlPath
+	}
+	return (&url.URL{Scheme: "file", Path: urlPath}).String(), nil
+}
+
+// DeleteFile removes a stored file and its metadata
+func (s *LocalStorage) DeleteFile(ctx context.Context, fileName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	name, filePath, err := s.objectPath(fileName)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(filePath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrFileNotFound
+		}
+		return err
+	}
+	if err := os.Remove(s.metaPath(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// ListFiles lists the names of stored files starting with prefix
+func (s *LocalStorage) ListFiles(ctx context.Context, prefix string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(s.root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(s.root, filePath)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		if entry.IsDir() {
+			if name == localMetaDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(name, prefix) {
+			files = append(files, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// GetFileInfo returns the metadata of a stored file
+func (s *LocalStorage) GetFileInfo(ctx context.Context, fileName string) (*FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	name, filePath, err := s.objectPath(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := s.readMeta(name, filePath, info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileInfo{
+		Name:        name,
+		Size:        info.Size(),
+		ContentType: meta.ContentType,
+		Created:     meta.Created,
+		Updated:     info.ModTime(),
+		MD5:         meta.MD5,
+	}, nil
+}
+
+// CopyFile copies a stored file and its metadata
+func (s *LocalStorage) CopyFile(ctx context.Context, srcFileName, destFileName string) error {
+	info, err := s.GetFileInfo(ctx, srcFileName)
+	if err != nil {
+		return err
+	}
+
+	src, err := s.DownloadFile(ctx, srcFileName)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	name, filePath, err := s.objectPath(destFileName)
+	if err != nil {
+		return err
+	}
+	return s.write(name, filePath, src, info.ContentType)
+}
+
+// MoveFile renames a stored file
+func (s *LocalStorage) MoveFile(ctx context.Context, srcFileName, destFileName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	srcName, srcPath, err := s.objectPath(srcFileName)
+	if err != nil {
+		return err
+	}
+	destName, destPath, err := s.objectPath(destFileName)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destPath), 0700); err != nil {
+		return err
+	}
+	if err := os.Rename(srcPath, destPath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrFileNotFound
+		}
+		return err
+	}
+
+	// Drop metadata left over from a file that was replaced
+	destMeta := s.metaPath(destName)
+	if err := os.Remove(destMeta); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(destMeta), 0700); err != nil {
+		return err
+	}
+	if err := os.Rename(s.metaPath(srcName), destMeta); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// FileExists checks if a file is stored
+func (s *LocalStorage) FileExists(ctx context.Context, fileName string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	_, filePath, err := s.objectPath(fileName)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,120 @@
+package firebase
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"firebase.google.com/go/v4/errorutils"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryPolicy controls how transient failures of idempotent operations
+// are retried
+type RetryPolicy struct {
+	MaxAttempts    int           // total attempts, 1 disables retries
+	InitialBackoff time.Duration // upper bound of the first jittered delay
+	MaxBackoff     time.Duration // upper bound of any delay
+}
+
+// DefaultRetryPolicy returns the policy used for idempotent operations
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+	}
+}
+
+// noRetry runs an operation exactly once, for calls that must not be
+// repeated such as auto-ID creates and checkouts
+var noRetry = RetryPolicy{MaxAttempts: 1}
+
+// run calls op until it succeeds, fails permanently, the attempts run out
+// or ctx is done. Every attempt gets its own timeout so one hung call does
+// not use up the whole budget. The final error is classified.
+func (p RetryPolicy) run(ctx context.Context, timeout time.Duration, op func(ctx context.Context) error) error {
+	backoff := p.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := withTimeout(ctx, timeout)
+		err := op(attemptCtx)
+		cancel()
+
+		if err == nil {
+			return nil
+		}
+		if attempt >= p.MaxAttempts || !IsTransient(err) || ctx.Err() != nil {
+			return ClassifyError(err, nil)
+		}
+
+		// Full jitter keeps terminals that failed together from retrying together
+		delay := time.Duration(rand.Int63n(int64(backoff))) + time.Millisecond
+		log.Printf("Transient Firebase error (attempt %d/%d), retrying in %v: %v", attempt, p.MaxAttempts, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return ClassifyError(err, nil)
+		case <-time.After(delay):
+		}
+
+		backoff *= 2
+		if backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
+
+// runValue is run for operations that return a value
+func runValue[T any](p RetryPolicy, ctx context.Context, timeout time.Duration, op func(ctx context.Context) (T, error)) (T, error) {
+	var value T
+	err := p.run(ctx, timeout, func(ctx context.Context) error {
+		var err error
+		value, err = op(ctx)
+		return err
+	})
+	return value, err
+}
+
+// IsTransient reports whether err is a failure that may succeed when the
+// same request is sent again
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+			return true
+		}
+		return false
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return isTransientHTTP(apiErr.Code)
+	}
+
+	return errorutils.IsUnavailable(err) ||
+		errorutils.IsDeadlineExceeded(err) ||
+		errorutils.IsResourceExhausted(err) ||
+		errorutils.IsInternal(err)
+}
+
+// isTransientHTTP reports whether an HTTP status code is worth retrying
+func isTransientHTTP(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
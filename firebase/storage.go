@@ -5,29 +5,103 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
 )
 
+// FileStorage stores files such as product images. Object names use
+// forward slashes, e.g. "products/<id>/<file>". Missing files are reported
+// as ErrFileNotFound.
+type FileStorage interface {
+	UploadFile(ctx context.Context, fileName string, data io.Reader, contentType string) (string, error)
+	DownloadFile(ctx context.Context, fileName string) (io.ReadCloser, error)
+	GetDownloadURL(ctx context.Context, fileName string) (string, error)
+	DeleteFile(ctx context.Context, fileName string) error
+	ListFiles(ctx context.Context, prefix string) ([]string, error)
+	GetFileInfo(ctx context.Context, fileName string) (*FileInfo, error)
+	CopyFile(ctx context.Context, srcFileName, destFileName string) error
+	MoveFile(ctx context.Context, srcFileName, destFileName string) error
+	FileExists(ctx context.Context, fileName string) (bool, error)
+}
+
+// ErrFileNotFound is returned by FileStorage for missing files
+var ErrFileNotFound = storage.ErrObjectNotExist
+
+// Storage backends selectable in app.ini
+const (
+	StorageBackendFirebase = "firebase"
+	StorageBackendLocal    = "local"
+)
+
+// StorageConfig selects the FileStorage backend
+type StorageConfig struct {
+	Backend   string // StorageBackendFirebase or StorageBackendLocal
+	LocalDir  string // root directory of the local backend
+	CacheDir  string // where downloaded product images are kept
+	CacheSize int    // size of the image cache in megabytes
+}
+
+// NewFileStorage creates the backend selected by config. bucket is only
+// used by the Firebase backend.
+func NewFileStorage(client *Client, bucket string, config *StorageConfig) (FileStorage, error) {
+	switch config.Backend {
+	case "", StorageBackendFirebase:
+		if client.Storage == nil {
+			return nil, errors.New("storage client not initialized")
+		}
+		if bucket == "" {
+			return nil, errors.New("firebase storage_bucket is not configured")
+		}
+		return NewStorageService(client, bucket), nil
+	case StorageBackendLocal:
+		return NewLocalStorage(config.LocalDir)
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", config.Backend)
+	}
+}
+
+// Signed download URLs are valid for signedURLLifetime and signed again
+// once less than signedURLRefresh of it is left, so a URL handed out is
+// always usable for at least that long
+const (
+	signedURLLifetime = 7 * 24 * time.Hour
+	signedURLRefresh  = 24 * time.Hour
+)
+
+// signedURL is a cached download URL
+type signedURL struct {
+	url     string
+	expires time.Time
+}
+
 // StorageService handles Firebase Storage operations
 type StorageService struct {
-	client *storage.Client
-	bucket string
-	ctx    context.Context
+	client   *storage.Client
+	bucket   string
+	timeouts Timeouts
+	retry    RetryPolicy
+
+	urlsMu sync.Mutex
+	urls   map[string]signedURL // by object name
 }
 
 // NewStorageService creates a new storage service
 func NewStorageService(client *Client, bucketName string) *StorageService {
 	return &StorageService{
-		client: client.Storage,
-		bucket: bucketName,
-		ctx:    client.GetContext(),
+		client:   client.Storage,
+		bucket:   bucketName,
+		timeouts: client.timeouts,
+		retry:    client.retry,
+		urls:     make(map[string]signedURL),
 	}
 }
 
 // UploadFile uploads a file to Firebase Storage
-func (s *StorageService) UploadFile(fileName string, data io.Reader, contentType string) (string, error) {
+func (s *StorageService) UploadFile(ctx context.Context, fileName string, data io.Reader, contentType string) (string, error) {
 	if s.client == nil {
 		return "", errors.New("storage client not initialized")
 	}
@@ -38,23 +112,27 @@ func (s *StorageService) UploadFile(fileName string, data io.Reader, contentType
 	// Create an object handle
 	obj := bucket.Object(fileName)
 
-	// Create a writer
-	writer := obj.NewWriter(s.ctx)
-	writer.ContentType = contentType
+	// data can only be read once, so a failed upload is not retried here
+	err := noRetry.run(ctx, s.timeouts.Storage, func(ctx context.Context) error {
+		// Create a writer
+		writer := obj.NewWriter(ctx)
+		writer.ContentType = contentType
 
-	// Copy the file data to storage
-	if _, err := io.Copy(writer, data); err != nil {
-		writer.Close()
-		return "", err
-	}
+		// Copy the file data to storage
+		if _, err := io.Copy(writer, data); err != nil {
+			writer.Close()
+			return err
+		}
 
-	// Close the writer
-	if err := writer.Close(); err != nil {
+		// Close the writer
+		return writer.Close()
+	})
+	if err != nil {
 		return "", err
 	}
 
 	// Generate download URL
-	downloadURL, err := s.GetDownloadURL(fileName)
+	downloadURL, err := s.GetDownloadURL(ctx, fileName)
 	if err != nil {
 		return "", err
 	}
@@ -62,24 +140,39 @@ func (s *StorageService) UploadFile(fileName string, data io.Reader, contentType
 	return downloadURL, nil
 }
 
-// GetDownloadURL generates a signed download URL for a file
-func (s *StorageService) GetDownloadURL(fileName string) (string, error) {
+// GetDownloadURL returns a signed download URL for a file. URLs are cached
+// and only signed again when they are about to expire.
+func (s *StorageService) GetDownloadURL(ctx context.Context, fileName string) (string, error) {
 	if s.client == nil {
 		return "", errors.New("storage client not initialized")
 	}
 
-	// Generate signed URL (valid for 7 days)
+	now := time.Now()
+	s.urlsMu.Lock()
+	cached, ok := s.urls[fileName]
+	s.urlsMu.Unlock()
+	if ok && now.Add(signedURLRefresh).Before(cached.expires) {
+		return cached.url, nil
+	}
+
 	opts := &storage.SignedURLOptions{
 		Scheme:  storage.SigningSchemeV4,
 		Method:  "GET",
-		Expires: time.Now().Add(7 * 24 * time.Hour),
+		Expires: now.Add(signedURLLifetime),
+	}
+	signed, err := s.client.Bucket(s.bucket).SignedURL(fileName, opts)
+	if err != nil {
+		return "", err
 	}
 
-	return s.client.Bucket(s.bucket).SignedURL(fileName, opts)
+	s.urlsMu.Lock()
+	s.urls[fileName] = signedURL{url: signed, expires: opts.Expires}
+	s.urlsMu.Unlock()
+	return signed, nil
 }
 
 // DeleteFile deletes a file from Firebase Storage
-func (s *StorageService) DeleteFile(fileName string) error {
+func (s *StorageService) DeleteFile(ctx context.Context, fileName string) error {
 	if s.client == nil {
 		return errors.New("storage client not initialized")
 	}
@@ -87,11 +180,17 @@ func (s *StorageService) DeleteFile(fileName string) error {
 	bucket := s.client.Bucket(s.bucket)
 	obj := bucket.Object(fileName)
 
-	return obj.Delete(s.ctx)
+	s.urlsMu.Lock()
+	delete(s.urls, fileName)
+	s.urlsMu.Unlock()
+
+	return s.retry.run(ctx, s.timeouts.Storage, func(ctx context.Context) error {
+		return obj.Delete(ctx)
+	})
 }
 
 // ListFiles lists files in the storage bucket with optional prefix
-func (s *StorageService) ListFiles(prefix string) ([]string, error) {
+func (s *StorageService) ListFiles(ctx context.Context, prefix string) ([]string, error) {
 	if s.client == nil {
 		return nil, errors.New("storage client not initialized")
 	}
@@ -99,25 +198,27 @@ func (s *StorageService) ListFiles(prefix string) ([]string, error) {
 	bucket := s.client.Bucket(s.bucket)
 
 	query := &storage.Query{Prefix: prefix}
-	iter := bucket.Objects(s.ctx, query)
-
-	var files []string
-	for {
-		attrs, err := iter.Next()
-		if err == storage.ErrObjectNotExist {
-			break
-		}
-		if err != nil {
-			return nil, err
+	return runValue(s.retry, ctx, s.timeouts.Storage, func(ctx context.Context) ([]string, error) {
+		iter := bucket.Objects(ctx, query)
+
+		var files []string
+		for {
+			attrs, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, attrs.Name)
 		}
-		files = append(files, attrs.Name)
-	}
 
-	return files, nil
+		return files, nil
+	})
 }
 
 // GetFileInfo gets metadata information about a file
-func (s *StorageService) GetFileInfo(fileName string) (*FileInfo, error) {
+func (s *StorageService) GetFileInfo(ctx context.Context, fileName string) (*FileInfo, error) {
 	if s.client == nil {
 		return nil, errors.New("storage client not initialized")
 	}
@@ -125,7 +226,7 @@ func (s *StorageService) GetFileInfo(fileName string) (*FileInfo, error) {
 	bucket := s.client.Bucket(s.bucket)
 	obj := bucket.Object(fileName)
 
-	attrs, err := obj.Attrs(s.ctx)
+	attrs, err := runValue(s.retry, ctx, s.timeouts.Storage, obj.Attrs)
 	if err != nil {
 		return nil, err
 	}
@@ -140,8 +241,9 @@ func (s *StorageService) GetFileInfo(fileName string) (*FileInfo, error) {
 	}, nil
 }
 
-// DownloadFile downloads a file from Firebase Storage
-func (s *StorageService) DownloadFile(fileName string) (io.ReadCloser, error) {
+// DownloadFile downloads a file from Firebase Storage.
+// The reader is bound to ctx only, it may outlive the storage timeout.
+func (s *StorageService) DownloadFile(ctx context.Context, fileName string) (io.ReadCloser, error) {
 	if s.client == nil {
 		return nil, errors.New("storage client not initialized")
 	}
@@ -149,11 +251,11 @@ func (s *StorageService) DownloadFile(fileName string) (io.ReadCloser, error) {
 	bucket := s.client.Bucket(s.bucket)
 	obj := bucket.Object(fileName)
 
-	return obj.NewReader(s.ctx)
+	return obj.NewReader(ctx)
 }
 
 // CopyFile copies a file within the storage bucket
-func (s *StorageService) CopyFile(srcFileName, destFileName string) error {
+func (s *StorageService) CopyFile(ctx context.Context, srcFileName, destFileName string) error {
 	if s.client == nil {
 		return errors.New("storage client not initialized")
 	}
@@ -162,23 +264,25 @@ func (s *StorageService) CopyFile(srcFileName, destFileName string) error {
 	src := bucket.Object(srcFileName)
 	dst := bucket.Object(destFileName)
 
-	_, err := dst.CopierFrom(src).Run(s.ctx)
-	return err
+	return s.retry.run(ctx, s.timeouts.Storage, func(ctx context.Context) error {
+		_, err := dst.CopierFrom(src).Run(ctx)
+		return err
+	})
 }
 
 // MoveFile moves a file within the storage bucket
-func (s *StorageService) MoveFile(srcFileName, destFileName string) error {
+func (s *StorageService) MoveFile(ctx context.Context, srcFileName, destFileName string) error {
 	// Copy file to new location
-	if err := s.CopyFile(srcFileName, destFileName); err != nil {
+	if err := s.CopyFile(ctx, srcFileName, destFileName); err != nil {
 		return err
 	}
 
 	// Delete original file
-	return s.DeleteFile(srcFileName)
+	return s.DeleteFile(ctx, srcFileName)
 }
 
 // FileExists checks if a file exists in storage
-func (s *StorageService) FileExists(fileName string) (bool, error) {
+func (s *StorageService) FileExists(ctx context.Context, fileName string) (bool, error) {
 	if s.client == nil {
 		return false, errors.New("storage client not initialized")
 	}
@@ -186,8 +290,8 @@ func (s *StorageService) FileExists(fileName string) (bool, error) {
 	bucket := s.client.Bucket(s.bucket)
 	obj := bucket.Object(fileName)
 
-	_, err := obj.Attrs(s.ctx)
-	if err == storage.ErrObjectNotExist {
+	_, err := runValue(s.retry, ctx, s.timeouts.Storage, obj.Attrs)
+	if errors.Is(err, ErrFileNotFound) {
 		return false, nil
 	}
 	if err != nil {
@@ -207,23 +311,49 @@ type FileInfo struct {
 	MD5         string    `json:"md5"`
 }
 
-// UploadProductImage uploads a product image with proper naming
-func (s *StorageService) UploadProductImage(productID string, data io.Reader, contentType string) (string, error) {
-	fileName := fmt.Sprintf("products/%s/%d.jpg", productID, time.Now().Unix())
-	return s.UploadFile(fileName, data, contentType)
+// imageExtensions are the file extensions of the image types products use,
+// the mime package may know several for one type
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// ImageExtension returns the file extension for an image content type, or
+// an empty string when the type is unknown
+func ImageExtension(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	if ext, ok := imageExtensions[mediaType]; ok {
+		return ext
+	}
+	if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// UploadProductImage uploads a product image as is, named after its
+// content type. Use images.UploadProductImage to store a resized image
+// with a thumbnail.
+func UploadProductImage(ctx context.Context, s FileStorage, productID string, data io.Reader, contentType string) (string, error) {
+	fileName := fmt.Sprintf("products/%s/%d%s", productID, time.Now().UnixNano(), ImageExtension(contentType))
+	return s.UploadFile(ctx, fileName, data, contentType)
 }
 
 // DeleteProductImage deletes a product image
-func (s *StorageService) DeleteProductImage(productID string) error {
+func DeleteProductImage(ctx context.Context, s FileStorage, productID string) error {
 	// List files with product prefix
-	files, err := s.ListFiles(fmt.Sprintf("products/%s/", productID))
+	files, err := s.ListFiles(ctx, fmt.Sprintf("products/%s/", productID))
 	if err != nil {
 		return err
 	}
 
 	// Delete all files for this product
 	for _, file := range files {
-		if err := s.DeleteFile(file); err != nil {
+		if err := s.DeleteFile(ctx, file); err != nil {
 			return err
 		}
 	}
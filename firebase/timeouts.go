@@ -0,0 +1,57 @@
+package firebase
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts limits how long each kind of Firebase operation may take.
+// The limits apply on top of any deadline already set on the caller's
+// context, so UI code can still cancel an operation earlier.
+type Timeouts struct {
+	Read    time.Duration // single document reads
+	Query   time.Duration // lists, queries and aggregations
+	Write   time.Duration // creates, updates, deletes and transactions
+	Auth    time.Duration // Firebase Authentication calls
+	Storage time.Duration // Cloud Storage uploads and metadata calls
+}
+
+// DefaultTimeouts returns the timeouts used when none are configured
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Read:    10 * time.Second,
+		Query:   30 * time.Second,
+		Write:   15 * time.Second,
+		Auth:    15 * time.Second,
+		Storage: 60 * time.Second,
+	}
+}
+
+// withDefaults fills unset timeouts from DefaultTimeouts
+func (t Timeouts) withDefaults() Timeouts {
+	defaults := DefaultTimeouts()
+	if t.Read <= 0 {
+		t.Read = defaults.Read
+	}
+	if t.Query <= 0 {
+		t.Query = defaults.Query
+	}
+	if t.Write <= 0 {
+		t.Write = defaults.Write
+	}
+	if t.Auth <= 0 {
+		t.Auth = defaults.Auth
+	}
+	if t.Storage <= 0 {
+		t.Storage = defaults.Storage
+	}
+	return t
+}
+
+// withTimeout limits ctx to timeout
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
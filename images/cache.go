@@ -0,0 +1,288 @@
+package images
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"kasirnest/firebase"
+	"kasirnest/models"
+)
+
+// cacheIndexFile maps object names to the MD5 of their content
+const cacheIndexFile = "index.json"
+
+// Cache keeps downloaded product images on disk so they show instantly and
+// without a connection. Files are stored by the MD5 of their content, so an
+// image stored under several names is kept once, and the least recently
+// used files are removed when the cache grows past its size.
+type Cache struct {
+	dir      string
+	maxBytes int64
+	files    firebase.FileStorage
+
+	mu      sync.Mutex
+	objects map[string]string      // object name to MD5, saved in cacheIndexFile
+	entries map[string]*cacheEntry // by MD5
+	size    int64
+}
+
+// cacheEntry is a cached file
+type cacheEntry struct {
+	size int64
+	used time.Time
+}
+
+// NewCache opens the image cache in dir, holding at most maxBytes of images
+// downloaded from files
+func NewCache(dir string, maxBytes int64, files firebase.FileStorage) (*Cache, error) {
+	if dir == "" {
+		return nil, errors.New("image cache directory is not configured")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	c := &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		files:    files,
+		objects:  make(map[string]string),
+		entries:  make(map[string]*cacheEntry),
+	}
+
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, dirEntry := range dirEntries {
+		if !isMD5(dirEntry.Name()) {
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+		c.entries[dirEntry.Name()] = &cacheEntry{size: info.Size(), used: info.ModTime()}
+		c.size += info.Size()
+	}
+
+	// A missing or damaged index only costs downloads
+	if data, err := os.ReadFile(filepath.Join(dir, cacheIndexFile)); err == nil {
+		if err := json.Unmarshal(data, &c.objects); err != nil {
+			log.Printf("Image cache index unreadable, starting empty: %v", err)
+			c.objects = make(map[string]string)
+		}
+	}
+	for name, sum := range c.objects {
+		if c.entries[sum] == nil {
+			delete(c.objects, name)
+		}
+	}
+
+	c.mu.Lock()
+	c.evict("")
+	c.mu.Unlock()
+	return c, nil
+}
+
+// Load returns the content of the named image. Cached images are read from
+// disk without contacting the storage backend, others are downloaded and
+// cached.
+func (c *Cache) Load(ctx context.Context, name string) ([]byte, error) {
+	if data, ok := c.read(name); ok {
+		return data, nil
+	}
+
+	info, err := c.files.GetFileInfo(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// The same content may already be cached under another name
+	c.mu.Lock()
+	if c.entries[info.MD5] != nil {
+		c.objects[name] = info.MD5
+	}
+	c.mu.Unlock()
+	if data, ok := c.read(name); ok {
+		return data, nil
+	}
+
+	data, err := c.download(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	sum := md5Hex(data)
+	if info.MD5 != "" && info.MD5 != sum {
+		return nil, fmt.Errorf("%s: downloaded image does not match its checksum", name)
+	}
+
+	if err := c.store(name, sum, data); err != nil {
+		// The image is still usable, it just has to be downloaded again
+		log.Printf("Failed to cache image %s: %v", name, err)
+	}
+	return data, nil
+}
+
+// read returns the cached content of the named image
+func (c *Cache) read(name string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sum, ok := c.objects[name]
+	if !ok {
+		return nil, false
+	}
+	entry := c.entries[sum]
+	if entry == nil {
+		delete(c.objects, name)
+		return nil, false
+	}
+
+	path := filepath.Join(c.dir, sum)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		// Removed from disk behind our back
+		c.remove(sum)
+		return nil, false
+	}
+
+	entry.used = time.Now()
+	os.Chtimes(path, entry.used, entry.used) // keeps the order across restarts
+	return data, true
+}
+
+// download reads the named image from the storage backend
+func (c *Cache) download(ctx context.Context, name string) ([]byte, error) {
+	reader, err := c.files.DownloadFile(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, MaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxFileSize {
+		return nil, fmt.Errorf("%s: %w", name, models.ErrImageTooLarge)
+	}
+	return data, nil
+}
+
+// store writes data to the cache under its MD5 and records name
+func (c *Cache) store(name, sum string, data []byte) error {
+	tmp, err := os.CreateTemp(c.dir, "download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, sum)); err != nil {
+		return err
+	}
+	if old := c.entries[sum]; old != nil {
+		c.size -= old.size
+	}
+	c.entries[sum] = &cacheEntry{size: int64(len(data)), used: time.Now()}
+	c.size += int64(len(data))
+	c.objects[name] = sum
+
+	c.evict(sum)
+	return c.saveIndex()
+}
+
+// evict removes the least recently used files until the cache fits in
+// maxBytes. keep is never removed. Must be called with mu held.
+func (c *Cache) evict(keep string) {
+	if c.size <= c.maxBytes {
+		return
+	}
+
+	sums := make([]string, 0, len(c.entries))
+	for sum := range c.entries {
+		if sum != keep {
+			sums = append(sums, sum)
+		}
+	}
+	sort.Slice(sums, func(i, j int) bool {
+		return c.entries[sums[i]].used.Before(c.entries[sums[j]].used)
+	})
+
+	for _, sum := range sums {
+		if c.size <= c.maxBytes {
+			break
+		}
+		c.remove(sum)
+	}
+}
+
+// remove deletes a cached file and the names pointing at it. Must be
+// called with mu held.
+func (c *Cache) remove(sum string) {
+	if entry := c.entries[sum]; entry != nil {
+		c.size -= entry.size
+		delete(c.entries, sum)
+	}
+	if err := os.Remove(filepath.Join(c.dir, sum)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Failed to remove cached image %s: %v", sum, err)
+	}
+	for name, objectSum := range c.objects {
+		if objectSum == sum {
+			delete(c.objects, name)
+		}
+	}
+}
+
+// saveIndex writes the object names of the cached files. Must be called
+// with mu held.
+func (c *Cache) saveIndex() error {
+	data, err := json.Marshal(c.objects)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(c.dir, cacheIndexFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// md5Hex returns the MD5 of data as FileInfo.MD5 reports it
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// isMD5 reports whether name looks like a hex encoded MD5
+func isMD5(name string) bool {
+	if len(name) != md5.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
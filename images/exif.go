@@ -0,0 +1,89 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// orientationTag is the EXIF tag holding the camera orientation
+const orientationTag = 0x0112
+
+// jpegOrientation reads the EXIF orientation (1-8) of a JPEG file. It
+// returns 1, the normal orientation, when the file has none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	// Walk the segments before the image data looking for APP1
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		if marker == 0xFF { // fill byte
+			pos++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 { // start of scan, end of image
+			return 1
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return 1
+		}
+		if marker == 0xE1 {
+			if orientation, ok := exifOrientation(data[pos+4 : end]); ok {
+				return orientation
+			}
+		}
+		pos = end
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation from the body of an APP1 segment
+func exifOrientation(segment []byte) (int, bool) {
+	if !bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+		return 0, false
+	}
+	tiff := segment[6:]
+	if len(tiff) < 8 {
+		return 0, false
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, false
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0, false
+	}
+
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0, false
+		}
+		if order.Uint16(tiff[entry:]) != orientationTag {
+			continue
+		}
+
+		orientation := int(order.Uint16(tiff[entry+8:]))
+		if orientation < 1 || orientation > 8 {
+			return 0, false
+		}
+		return orientation, true
+	}
+	return 0, false
+}
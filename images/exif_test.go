@@ -0,0 +1,81 @@
+package images
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// tiffHeader builds a TIFF header followed by an IFD holding a software tag
+// and the orientation tag
+func tiffHeader(order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 8+2+2*12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 2)
+
+	software := tiff[10:]
+	order.PutUint16(software, 0x0131)
+	order.PutUint16(software[2:], 2)
+	order.PutUint32(software[4:], 4)
+	copy(software[8:], "cam")
+
+	entry := tiff[22:]
+	order.PutUint16(entry, orientationTag)
+	order.PutUint16(entry[2:], 3) // SHORT
+	order.PutUint32(entry[4:], 1)
+	order.PutUint16(entry[8:], orientation)
+	return tiff
+}
+
+// segment builds a JPEG marker segment with its length
+func segment(marker byte, body []byte) []byte {
+	data := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(data[2:], uint16(len(body)+2))
+	return append(data, body...)
+}
+
+// jpegWith builds the start of a JPEG file holding the given segments
+func jpegWith(segments ...[]byte) []byte {
+	data := []byte{0xFF, 0xD8}
+	for _, s := range segments {
+		data = append(data, s...)
+	}
+	return append(data, 0xFF, 0xDA, 0x00, 0x02)
+}
+
+func exifSegment(tiff []byte) []byte {
+	return segment(0xE1, append([]byte("Exif\x00\x00"), tiff...))
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	jfif := segment(0xE0, []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00"))
+	little := tiffHeader(binary.LittleEndian, 6)
+	big := tiffHeader(binary.BigEndian, 8)
+
+	for name, test := range map[string]struct {
+		data []byte
+		want int
+	}{
+		"little endian":        {jpegWith(jfif, exifSegment(little)), 6},
+		"big endian":           {jpegWith(exifSegment(big)), 8},
+		"fill bytes":           {append([]byte{0xFF, 0xD8, 0xFF}, jpegWith(exifSegment(big))[2:]...), 8},
+		"missing APP1":         {jpegWith(jfif), 1},
+		"APP1 after scan":      {append(jpegWith(jfif), exifSegment(little)...), 1},
+		"not exif APP1":        {jpegWith(segment(0xE1, append([]byte("http://ns\x00"), little...))), 1},
+		"truncated IFD":        {jpegWith(exifSegment(little[:len(little)-10])), 1},
+		"IFD past the end":     {jpegWith(exifSegment(little[:9])), 1},
+		"unknown byte order":   {jpegWith(exifSegment(append([]byte("XX"), little[2:]...))), 1},
+		"invalid orientation":  {jpegWith(exifSegment(tiffHeader(binary.BigEndian, 9))), 1},
+		"segment past the end": {jpegWith(jfif, exifSegment(little))[:30], 1},
+		"not a JPEG":           {[]byte("\x89PNG\r\n\x1a\n"), 1},
+	} {
+		if got := jpegOrientation(test.data); got != test.want {
+			t.Errorf("%s: jpegOrientation = %d, want %d", name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package images
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"kasirnest/firebase"
+	"kasirnest/models"
+)
+
+// productImagePrefix is where all product images are stored
+const productImagePrefix = "products/"
+
+// orphanMinAge keeps files uploaded moments ago, whose product may not be
+// saved yet, out of the collection
+const orphanMinAge = time.Hour
+
+// Orphan is a stored product image that no product uses
+type Orphan struct {
+	Path string
+	Size int64
+}
+
+// OrphanReport lists the product images that can be deleted
+type OrphanReport struct {
+	Scanned int // files under products/
+	Orphans []Orphan
+}
+
+// Bytes returns the total size of the orphaned files
+func (r *OrphanReport) Bytes() int64 {
+	var total int64
+	for _, orphan := range r.Orphans {
+		total += orphan.Size
+	}
+	return total
+}
+
+// FindOrphans lists the files under products/ that are not the current
+// image or thumbnail of any of products. products must hold every product:
+// images of missing products are reported as orphans.
+func FindOrphans(ctx context.Context, files firebase.FileStorage, products []models.Product) (*OrphanReport, error) {
+	names, err := files.ListFiles(ctx, productImagePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &OrphanReport{Scanned: len(names)}
+	cutoff := time.Now().Add(-orphanMinAge)
+	for _, name := range names {
+		if isReferenced(name, products) {
+			continue
+		}
+
+		info, err := files.GetFileInfo(ctx, name)
+		if errors.Is(err, firebase.ErrFileNotFound) {
+			continue // deleted since it was listed
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if info.Created.After(cutoff) {
+			continue
+		}
+
+		report.Orphans = append(report.Orphans, Orphan{Path: name, Size: info.Size})
+	}
+
+	sort.Slice(report.Orphans, func(i, j int) bool {
+		return report.Orphans[i].Path < report.Orphans[j].Path
+	})
+	return report, nil
+}
+
+// isReferenced reports whether a stored file is the image or thumbnail of
+// a product. Products saved before image paths were recorded only have a
+// URL, which contains the object name, escaped for Cloud Storage.
+func isReferenced(name string, products []models.Product) bool {
+	escaped := url.PathEscape(name)
+	for i := range products {
+		product := &products[i]
+		if product.ImagePath == name || product.ThumbnailPath == name {
+			return true
+		}
+		for _, imageURL := range []string{product.ImageURL, product.ThumbnailURL} {
+			if imageURL != "" && (strings.Contains(imageURL, name) || strings.Contains(imageURL, escaped)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DeleteOrphans deletes the files of report and returns how many were
+// deleted. It continues past failures and returns them joined.
+func DeleteOrphans(ctx context.Context, files firebase.FileStorage, report *OrphanReport) (int, error) {
+	deleted := 0
+	var errs []error
+	for _, orphan := range report.Orphans {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		err := files.DeleteFile(ctx, orphan.Path)
+		switch {
+		case err == nil, errors.Is(err, firebase.ErrFileNotFound):
+			deleted++
+		default:
+			errs = append(errs, fmt.Errorf("%s: %w", orphan.Path, err))
+		}
+	}
+	return deleted, errors.Join(errs...)
+}
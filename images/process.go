@@ -0,0 +1,199 @@
+// Package images prepares product images for storage: it decodes JPEG,
+// PNG and WebP files, corrects the camera orientation, scales them down and
+// creates thumbnails.
+package images
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register the WebP decoder
+
+	"kasirnest/models"
+)
+
+const (
+	// MaxDimension is the largest width or height of a stored image
+	MaxDimension = 1024
+
+	// ThumbnailDimension is the largest width or height of a thumbnail
+	ThumbnailDimension = 200
+
+	// MaxFileSize is the largest image file accepted
+	MaxFileSize = 20 << 20
+
+	// maxPixels guards against images that are small on disk but take
+	// gigabytes to decode
+	maxPixels = 50000000
+
+	jpegQuality = 85
+)
+
+// Encoded is an image ready to be uploaded
+type Encoded struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Processed is an uploaded image scaled down for storage with its thumbnail
+type Processed struct {
+	Image     Encoded
+	Thumbnail Encoded
+}
+
+// Process decodes an image, applies its EXIF orientation and encodes it
+// scaled down to MaxDimension along with a thumbnail. PNG images and WebP
+// images with transparency are stored as PNG, everything else as JPEG.
+// Invalid files return models.ErrUnsupportedImage, oversized files
+// models.ErrImageTooLarge.
+func Process(r io.Reader) (*Processed, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxFileSize {
+		return nil, models.ErrImageTooLarge
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "jpeg" && format != "png" && format != "webp") {
+		return nil, models.ErrUnsupportedImage
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, models.ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Join(models.ErrUnsupportedImage, err)
+	}
+
+	usePNG := format == "png" || (format == "webp" && !isOpaque(img))
+
+	// Scaling first keeps the orientation pass cheap for large photos
+	full := toNRGBA(scaleDown(img, MaxDimension))
+	if format == "jpeg" {
+		full = orient(full, jpegOrientation(data))
+	}
+	thumbnail := scaleDown(full, ThumbnailDimension)
+
+	processed := &Processed{}
+	if processed.Image, err = encode(full, usePNG); err != nil {
+		return nil, err
+	}
+	if processed.Thumbnail, err = encode(thumbnail, usePNG); err != nil {
+		return nil, err
+	}
+	return processed, nil
+}
+
+// scaleDown resizes img so neither side exceeds maxSize, keeping its
+// aspect ratio. Smaller images are returned unchanged.
+func scaleDown(img image.Image, maxSize int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSize && height <= maxSize {
+		return img
+	}
+
+	if width >= height {
+		height = max(1, height*maxSize/width)
+		width = maxSize
+	} else {
+		width = max(1, width*maxSize/height)
+		height = maxSize
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// toNRGBA returns img as an NRGBA image with its origin at 0,0
+func toNRGBA(img image.Image) *image.NRGBA {
+	if nrgba, ok := img.(*image.NRGBA); ok && nrgba.Rect.Min == (image.Point{}) {
+		return nrgba
+	}
+
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	return dst
+}
+
+// orient turns img upright according to an EXIF orientation value
+func orient(img *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 { // rotated by 90 degrees, sides swap
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = width-1-x, y
+			case 3: // rotated 180
+				sx, sy = width-1-x, height-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, height-1-y
+			case 5: // mirrored along the top-left diagonal
+				sx, sy = y, x
+			case 6: // needs a clockwise turn
+				sx, sy = y, height-1-x
+			case 7: // mirrored along the top-right diagonal
+				sx, sy = width-1-y, height-1-x
+			case 8: // needs a counter-clockwise turn
+				sx, sy = width-1-y, x
+			}
+			dst.SetNRGBA(x, y, img.NRGBAAt(sx, sy))
+		}
+	}
+	return dst
+}
+
+// isOpaque reports whether img has no transparent pixels
+func isOpaque(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return opaque.Opaque()
+	}
+	return false
+}
+
+// encode encodes img as PNG or JPEG
+func encode(img image.Image, usePNG bool) (Encoded, error) {
+	var buf bytes.Buffer
+	encoded := Encoded{
+		ContentType: "image/jpeg",
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+	}
+
+	var err error
+	if usePNG {
+		encoded.ContentType = "image/png"
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	if err != nil {
+		return Encoded{}, err
+	}
+
+	encoded.Data = buf.Bytes()
+	return encoded, nil
+}
@@ -0,0 +1,66 @@
+package images
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// letters builds an image whose pixels are told apart by their red value,
+// one row per string
+func letters(rows ...string) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x := range row {
+			img.SetNRGBA(x, y, color.NRGBA{R: row[x], A: 0xFF})
+		}
+	}
+	return img
+}
+
+// rows reads an image built by letters back into strings
+func rows(img *image.NRGBA) []string {
+	bounds := img.Bounds()
+	result := make([]string, 0, bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := make([]byte, 0, bounds.Dx())
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			row = append(row, img.NRGBAAt(x, y).R)
+		}
+		result = append(result, string(row))
+	}
+	return result
+}
+
+func TestOrient(t *testing.T) {
+	// Stored as the camera saw it, the expected rows are how it is shown
+	src := []string{
+		"ABC",
+		"DEF",
+	}
+
+	for orientation, want := range map[int][]string{
+		1: {"ABC", "DEF"},
+		2: {"CBA", "FED"},
+		3: {"FED", "CBA"},
+		4: {"DEF", "ABC"},
+		5: {"AD", "BE", "CF"},
+		6: {"DA", "EB", "FC"},
+		7: {"FC", "EB", "DA"},
+		8: {"CF", "BE", "AD"},
+		9: {"ABC", "DEF"},
+	} {
+		got := rows(orient(letters(src...), orientation))
+		if len(got) != len(want) || len(got[0]) != len(want[0]) {
+			t.Errorf("orientation %d: size %dx%d, want %dx%d",
+				orientation, len(got[0]), len(got), len(want[0]), len(want))
+			continue
+		}
+		for y := range want {
+			if got[y] != want[y] {
+				t.Errorf("orientation %d: rows %q, want %q", orientation, got, want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"kasirnest/firebase"
+)
+
+// ProductImage is a product image stored with its thumbnail
+type ProductImage struct {
+	URL           string
+	Path          string
+	ThumbnailURL  string
+	ThumbnailPath string
+}
+
+// UploadProductImage processes an image file and stores it with its
+// thumbnail under products/<productID>/
+func UploadProductImage(ctx context.Context, files firebase.FileStorage, productID string, r io.Reader) (*ProductImage, error) {
+	processed, err := Process(r)
+	if err != nil {
+		return nil, err
+	}
+
+	base := fmt.Sprintf("products/%s/%d", productID, time.Now().UnixNano())
+	uploaded := &ProductImage{
+		Path:          base + firebase.ImageExtension(processed.Image.ContentType),
+		ThumbnailPath: base + "_thumb" + firebase.ImageExtension(processed.Thumbnail.ContentType),
+	}
+
+	uploaded.URL, err = files.UploadFile(ctx, uploaded.Path, bytes.NewReader(processed.Image.Data), processed.Image.ContentType)
+	if err != nil {
+		return nil, err
+	}
+
+	uploaded.ThumbnailURL, err = files.UploadFile(ctx, uploaded.ThumbnailPath, bytes.NewReader(processed.Thumbnail.Data), processed.Thumbnail.ContentType)
+	if err != nil {
+		RemoveProductImage(ctx, files, uploaded.Path)
+		return nil, err
+	}
+
+	return uploaded, nil
+}
+
+// RemoveProductImage deletes stored image files, such as the files of an
+// image that was replaced. Failures are only logged: a leftover file wastes
+// space but breaks nothing.
+func RemoveProductImage(ctx context.Context, files firebase.FileStorage, paths ...string) {
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if err := files.DeleteFile(ctx, path); err != nil && !errors.Is(err, firebase.ErrFileNotFound) {
+			log.Printf("Failed to delete product image %s: %v", path, err)
+		}
+	}
+}
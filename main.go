@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"os"
+	"sync"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -10,8 +14,14 @@ import (
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
 
+	"kasirnest/accounts"
+	"kasirnest/backup"
 	"kasirnest/config"
 	"kasirnest/firebase"
+	"kasirnest/images"
+	"kasirnest/models"
+	"kasirnest/offline"
+	"kasirnest/repository"
 	"kasirnest/ui"
 )
 
@@ -21,10 +31,29 @@ type Application struct {
 	window         fyne.Window
 	config         *config.Config
 	firebaseClient *firebase.Client
-
-	// Screens
-	loginScreen     *ui.LoginScreen
-	dashboardScreen *ui.DashboardScreen
+	repositories   *repository.Repositories
+	localStore     *offline.Store
+	syncer         *offline.Syncer
+	backups        *backup.Manager
+	files          firebase.FileStorage
+	imageCache     *images.Cache
+	authService    *firebase.AuthService
+
+	// Signed in user, kept fresh by keepSessionFresh until stopSession
+	sessionMu   sync.Mutex
+	stopSession context.CancelFunc
+	currentUser *models.User // signed the terminal in
+	cashier     *models.User // switched in with a PIN, nil for currentUser
+	sessions    *ui.SessionManager
+	cashiers    *accounts.Cashiers
+
+	// Screens. The window content is changed by UI callbacks as well as
+	// the session goroutines, screenMu makes the changes take turns.
+	screenMu         sync.Mutex
+	loginScreen      *ui.LoginScreen
+	dashboardScreen  *ui.DashboardScreen
+	dashboardContent fyne.CanvasObject // shown again when the lock screen is unlocked
+	lockScreen       *ui.LockScreen
 
 	// Current state
 	isLoggedIn bool
@@ -76,31 +105,113 @@ func (a *Application) Initialize() error {
 		return a.showFirebaseError(err)
 	}
 
+	// Load the session of the last user, locked when idle for too long
+	a.sessions = ui.NewSessionManager(a.config.Security.EncryptionKey,
+		time.Duration(a.config.Security.SessionTimeout)*time.Second,
+		time.Duration(a.config.Security.IdleTimeout)*time.Second)
+
 	// Create main window
 	a.createMainWindow()
 
-	// Check if user is already logged in
-	if ui.ValidateSession() {
-		a.showDashboard()
-	} else {
-		a.showLogin()
-	}
+	// Resume the session of the last user when it is still valid
+	resumed := a.resumeSession()
+	a.switchScreen(func() {
+		if resumed {
+			a.showDashboard()
+		} else {
+			a.showLogin()
+		}
+	})
 
 	return nil
 }
 
 // initializeFirebase initializes Firebase services
 func (a *Application) initializeFirebase() error {
-	client, err := firebase.Initialize(a.config.Firebase)
+	client, err := firebase.Initialize(context.Background(), a.config.Firebase)
 	if err != nil {
 		return err
 	}
 
 	a.firebaseClient = client
+	a.authService = firebase.NewAuthService(client)
+	a.repositories = repository.NewFirestoreRepositories(client)
 	log.Println("Firebase initialized successfully")
+
+	a.initializeOfflineStore()
+
+	// PIN failures outlive a restart when there is a local database
+	var failures accounts.FailureStore
+	if a.localStore != nil {
+		failures = a.localStore
+	}
+	a.cashiers = accounts.NewCashiers(a.repositories.Users, failures)
+	a.initializeBackups()
+	a.initializeFileStorage()
 	return nil
 }
 
+// initializeOfflineStore opens the local database and starts syncing.
+// Without it the application still works, but only while online.
+func (a *Application) initializeOfflineStore() {
+	store, err := offline.Open(a.config.Database.LocalPath)
+	if err != nil {
+		log.Printf("Offline store unavailable, sales require a connection: %v", err)
+		return
+	}
+
+	interval := time.Duration(a.config.Database.SyncInterval) * time.Second
+	a.localStore = store
+	a.syncer = offline.NewSyncer(store, a.repositories, interval)
+	a.repositories = offline.NewRepositories(store, a.repositories, a.syncer)
+	a.syncer.Start()
+	log.Printf("Offline store opened at %s", a.config.Database.LocalPath)
+}
+
+// initializeBackups prepares Firestore backups and starts the schedule when
+// auto_backup is enabled. Backups can still be taken from the settings
+// dialog when it is disabled.
+func (a *Application) initializeBackups() {
+	manager, err := backup.NewManager(firebase.NewFirestoreService(a.firebaseClient), backup.Options{
+		Dir:       a.config.Database.BackupDir,
+		Key:       a.config.Security.EncryptionKey,
+		ProjectID: a.config.Firebase.ProjectID,
+		Interval:  time.Duration(a.config.Database.BackupInterval) * time.Hour,
+		Retention: a.config.Database.BackupRetention,
+	})
+	if err != nil {
+		log.Printf("Backups unavailable: %v", err)
+		return
+	}
+
+	a.backups = manager
+	if a.config.Database.AutoBackup {
+		a.backups.Start()
+		log.Printf("Automatic backups every %d hours to %s", a.config.Database.BackupInterval, a.config.Database.BackupDir)
+	}
+}
+
+// initializeFileStorage opens the storage backend selected in app.ini.
+// Without it products can still be managed, only without images.
+func (a *Application) initializeFileStorage() {
+	files, err := firebase.NewFileStorage(a.firebaseClient, a.config.Firebase.StorageBucket, a.config.Storage)
+	if err != nil {
+		log.Printf("File storage unavailable, product images disabled: %v", err)
+		return
+	}
+
+	a.files = files
+	log.Printf("Using %s file storage", a.config.Storage.Backend)
+
+	// Without the cache the POS shows products without photos
+	cache, err := images.NewCache(a.config.Storage.CacheDir, int64(a.config.Storage.CacheSize)<<20, files)
+	if err != nil {
+		log.Printf("Image cache unavailable, product photos hidden in the POS: %v", err)
+		return
+	}
+	a.imageCache = cache
+}
+
 // createMainWindow creates the main application window
 func (a *Application) createMainWindow() {
 	width, height := a.config.GetWindowSize()
@@ -114,6 +225,10 @@ func (a *Application) createMainWindow() {
 		a.window.SetIcon(logoResource)
 	}
 
+	// Typing outside entries, e.g. shortcuts, counts as activity
+	a.window.Canvas().SetOnTypedKey(func(*fyne.KeyEvent) { a.sessions.Touch() })
+	a.window.Canvas().SetOnTypedRune(func(rune) { a.sessions.Touch() })
+
 	// Handle window close
 	a.window.SetCloseIntercept(func() {
 		if a.isLoggedIn {
@@ -135,12 +250,9 @@ func (a *Application) createMainWindow() {
 func (a *Application) showLogin() {
 	a.isLoggedIn = false
 
-	// Create auth service
-	authService := firebase.NewAuthService(a.firebaseClient)
-
 	// Create login screen
-	a.loginScreen = ui.NewLoginScreen(a.window, authService, func() {
-		a.onLoginSuccess()
+	a.loginScreen = ui.NewLoginScreen(a.window, a.authService, func(session *firebase.Session) {
+		a.switchScreen(func() { a.onLoginSuccess(session) })
 	})
 
 	// Set window content
@@ -154,40 +266,292 @@ func (a *Application) showLogin() {
 func (a *Application) showDashboard() {
 	a.isLoggedIn = true
 
-	// Create dashboard screen
-	a.dashboardScreen = ui.NewDashboardScreen(a.window, a.firebaseClient)
+	if a.dashboardScreen != nil {
+		a.dashboardScreen.Close()
+	}
+
+	// Create dashboard screen, acting with the permissions of the user
+	// working on the terminal
+	user := a.activeUser()
+	repos := repository.WithAccess(a.repositories, user)
+	a.dashboardScreen = ui.NewDashboardScreen(a.window, user, a.firebaseClient, a.authService, repos, a.cashiers, a.syncer, a.backups, a.files, a.imageCache)
 
 	// Set logout callback
 	a.dashboardScreen.SetLogoutCallback(func() {
-		a.onLogout()
+		a.switchScreen(a.onLogout)
+	})
+	a.dashboardScreen.SetLockCallback(func() {
+		if a.sessions.Lock(ui.LockManual) {
+			a.switchScreen(func() { a.showLock(ui.LockManual) })
+		}
 	})
+	a.dashboardContent = a.sessions.TrackActivity(a.dashboardScreen.GetContainer())
 
-	// Set window content
-	a.window.SetContent(a.dashboardScreen.GetContainer())
+	// A locked session keeps the dashboard behind the lock screen
+	if reason, locked := a.sessions.Locked(); locked {
+		a.showLock(reason)
+		return
+	}
 
-	// Update window title with user info
+	a.window.SetContent(a.dashboardContent)
+	a.setDashboardTitle()
+
+	log.Println("Dashboard screen displayed")
+}
+
+// activeUser returns the user working on the terminal, whose role decides
+// what the dashboard offers
+func (a *Application) activeUser() *models.User {
+	a.sessionMu.Lock()
+	defer a.sessionMu.Unlock()
+	if a.cashier != nil {
+		return a.cashier
+	}
+	return a.currentUser
+}
+
+// setDashboardTitle shows the signed in user in the window title
+func (a *Application) setDashboardTitle() {
 	_, _, userName := ui.GetCurrentUser()
 	if userName != "" {
 		a.window.SetTitle(a.config.App.Name + " - " + userName)
 	} else {
 		a.window.SetTitle(a.config.App.Name + " - Dashboard")
 	}
+}
 
-	log.Println("Dashboard screen displayed")
+// showLock hides the dashboard behind the lock screen
+func (a *Application) showLock(reason ui.LockReason) {
+	onUnlock := func(session *firebase.Session) {
+		a.switchScreen(func() { a.onUnlock(session) })
+	}
+	onSwitch := func(cashier *models.User) {
+		a.switchScreen(func() { a.onSwitchCashier(cashier) })
+	}
+	a.lockScreen = ui.NewLockScreen(a.window, a.authService, a.sessions, a.cashiers, reason, onUnlock, onSwitch, func() {
+		ui.ClearSession()
+		a.switchScreen(a.onLogout)
+	})
+
+	// Dialogs left open would show on top of the lock screen
+	overlays := a.window.Canvas().Overlays()
+	for overlays.Top() != nil {
+		overlays.Remove(overlays.Top())
+	}
+
+	a.window.SetContent(a.lockScreen.GetContainer())
+	a.window.SetTitle(a.config.App.Name + " - Terkunci")
+	a.lockScreen.Focus()
+
+	log.Println("Screen locked")
+}
+
+// onUnlock shows the dashboard again once the signed in user entered their
+// password on the lock screen
+func (a *Application) onUnlock(session *firebase.Session) {
+	if err := a.sessions.Unlock(session); err != nil {
+		log.Printf("Failed to store session: %v", err)
+	}
+
+	previous := a.activeUser()
+	a.startSession(session)
+	a.resumeDashboard(previous, session.User())
+}
+
+// onSwitchCashier hands the terminal to a cashier who entered their PIN on
+// the lock screen, or back to the signed in user who unlocked it offline.
+// The Firebase session of the terminal is kept.
+func (a *Application) onSwitchCashier(cashier *models.User) {
+	a.sessions.SwitchUser(cashier)
+
+	a.sessionMu.Lock()
+	previous := a.cashier
+	if previous == nil {
+		previous = a.currentUser
+	}
+	a.cashier = cashier
+	if a.currentUser != nil && cashier.UserID == a.currentUser.UserID {
+		// The role of the signed in user comes from their token
+		a.cashier = nil
+		cashier = a.currentUser
+	}
+	a.sessionMu.Unlock()
+
+	log.Printf("Cashier %s took over from %s", cashier.UserID, previous.UserID)
+	a.resumeDashboard(previous, cashier)
+}
+
+// resumeDashboard shows the dashboard after the lock screen. It is rebuilt
+// for another user or a changed role, otherwise work in progress such as
+// the cart is kept.
+func (a *Application) resumeDashboard(previous, next *models.User) {
+	a.lockScreen = nil
+	if a.dashboardScreen == nil || previous == nil || previous.UserID != next.UserID || previous.Role != next.Role {
+		a.showDashboard()
+		return
+	}
+	a.window.SetContent(a.dashboardContent)
+	a.setDashboardTitle()
 }
 
 // onLoginSuccess handles successful login
-func (a *Application) onLoginSuccess() {
+func (a *Application) onLoginSuccess(session *firebase.Session) {
 	log.Println("Login successful")
+	if err := a.sessions.Start(session); err != nil {
+		log.Printf("Failed to store session: %v", err)
+	}
+	a.startSession(session)
 	a.showDashboard()
 }
 
 // onLogout handles user logout
 func (a *Application) onLogout() {
 	log.Println("User logged out")
+	a.endSession()
+	if a.dashboardScreen != nil {
+		a.dashboardScreen.Close()
+		a.dashboardScreen = nil
+		a.dashboardContent = nil
+	}
+	a.lockScreen = nil
 	a.showLogin()
 }
 
+// resumeSession signs the last user in again with their stored refresh
+// token. When Firebase cannot be reached the stored session is resumed
+// offline and verified once the connection is back. Sessions older than
+// session_timeout are not resumed.
+func (a *Application) resumeSession() bool {
+	stored, ok := a.sessions.Stored()
+	if !ok {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.firebaseClient.Timeouts().Auth)
+	defer cancel()
+	session, err := a.authService.RefreshSession(ctx, stored.RefreshToken)
+	switch {
+	case err == nil:
+		if err := a.sessions.Update(session); err != nil {
+			log.Printf("Failed to store session: %v", err)
+		}
+		a.startSession(session)
+		return true
+	case errors.Is(err, models.ErrUnavailable) || errors.Is(err, models.ErrTimeout):
+		log.Printf("Resuming session offline: %v", err)
+		// An expired session is refreshed as soon as possible. Until then
+		// the role is unknown and the user gets the least privileged one.
+		a.startSession(stored)
+		return true
+	default:
+		log.Printf("Stored session is no longer valid: %v", err)
+		ui.ClearSession()
+		return false
+	}
+}
+
+// startSession keeps the ID token of session fresh and watches for the
+// idle and session timeouts in the background
+func (a *Application) startSession(session *firebase.Session) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a.sessionMu.Lock()
+	if a.stopSession != nil {
+		a.stopSession()
+	}
+	a.stopSession = cancel
+	a.currentUser = session.User()
+	a.cashier = nil
+	a.sessionMu.Unlock()
+
+	go a.keepSessionFresh(ctx, session)
+	go a.sessions.Watch(ctx, func(reason ui.LockReason) {
+		a.switchScreen(func() {
+			// The session may have ended while waiting for the screen
+			if ctx.Err() == nil {
+				a.showLock(reason)
+			}
+		})
+	})
+}
+
+// switchScreen runs change, which may replace the window content, once no
+// other screen change is in progress. Callbacks and goroutines change the
+// screen through it; the show and on methods assume it is held.
+func (a *Application) switchScreen(change func()) {
+	a.screenMu.Lock()
+	defer a.screenMu.Unlock()
+	change()
+}
+
+// endSession stops refreshing the session of the user who logged out
+func (a *Application) endSession() {
+	a.sessionMu.Lock()
+	defer a.sessionMu.Unlock()
+	if a.stopSession != nil {
+		a.stopSession()
+		a.stopSession = nil
+	}
+	a.currentUser = nil
+	a.cashier = nil
+}
+
+// keepSessionFresh refreshes the ID token shortly before it expires. Users
+// who were disabled or whose tokens were revoked are logged out; other
+// failures, such as being offline, are retried.
+func (a *Application) keepSessionFresh(ctx context.Context, session *firebase.Session) {
+	const retryDelay = time.Minute
+
+	wait := session.RefreshIn()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		next, err := a.authService.RefreshSession(ctx, session.RefreshToken)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, models.ErrSessionExpired) || errors.Is(err, models.ErrUserDisabled) {
+			log.Printf("Session ended by Firebase Auth: %v", err)
+			ui.ClearSession()
+			a.switchScreen(func() {
+				a.onLogout()
+				dialog.ShowInformation("Sesi Berakhir", models.UserMessage(err), a.window)
+			})
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to refresh session, retrying in %v: %v", retryDelay, err)
+			wait = retryDelay
+			continue
+		}
+
+		session = next
+		if err := a.sessions.Update(session); err != nil {
+			log.Printf("Failed to store session: %v", err)
+		}
+		wait = session.RefreshIn()
+
+		// A changed role shows up in the refreshed claims. It only matters
+		// to the dashboard while no other cashier switched in.
+		a.switchScreen(func() {
+			a.sessionMu.Lock()
+			changed := ctx.Err() == nil && a.currentUser.Role != session.Role()
+			if changed {
+				a.currentUser = session.User()
+			}
+			changed = changed && a.cashier == nil
+			a.sessionMu.Unlock()
+			if changed {
+				log.Printf("Role changed to %s", session.Role())
+				a.showDashboard()
+			}
+		})
+	}
+}
+
 // showSetupDialog shows setup dialog when config file is missing
 func (a *Application) showSetupDialog(configError error) error {
 	// Create a simple window for setup dialog
@@ -326,6 +690,21 @@ func (a *Application) openConfigFile() error {
 func (a *Application) cleanup() {
 	log.Println("Cleaning up application...")
 
+	a.endSession()
+
+	// Stop syncing and backups before the stores go away
+	if a.backups != nil {
+		a.backups.Stop()
+	}
+	if a.syncer != nil {
+		a.syncer.Stop()
+	}
+	if a.localStore != nil {
+		if err := a.localStore.Close(); err != nil {
+			log.Printf("Error closing offline store: %v", err)
+		}
+	}
+
 	// Close Firebase connections
 	if a.firebaseClient != nil {
 		if err := a.firebaseClient.Close(); err != nil {
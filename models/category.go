@@ -7,6 +7,11 @@ type Category struct {
 	Description string `json:"description" firestore:"description"`
 }
 
+// SetID sets the category ID from its Firestore document ID
+func (c *Category) SetID(id string) {
+	c.CategoryID = id
+}
+
 // DefaultCategories returns a slice of default categories
 func DefaultCategories() []Category {
 	return []Category{
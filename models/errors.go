@@ -1,14 +1,111 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 // Common errors used across models
 var (
-	ErrInsufficientStock = errors.New("insufficient stock")
-	ErrInvalidQuantity   = errors.New("invalid quantity")
-	ErrInvalidPrice      = errors.New("invalid price")
-	ErrProductNotFound   = errors.New("product not found")
-	ErrUserNotFound      = errors.New("user not found")
-	ErrInvalidUser       = errors.New("invalid user")
-	ErrUnauthorized      = errors.New("unauthorized access")
+	ErrInsufficientStock   = errors.New("insufficient stock")
+	ErrInvalidQuantity     = errors.New("invalid quantity")
+	ErrInvalidPrice        = errors.New("invalid price")
+	ErrProductNotFound     = errors.New("product not found")
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrTransactionConflict = errors.New("transaction ID is used by another sale")
+	ErrCategoryNotFound    = errors.New("category not found")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrInvalidUser         = errors.New("invalid user")
+	ErrUnauthorized        = errors.New("unauthorized access")
+	ErrOwnAccount          = errors.New("cannot disable, demote or log out own account")
+
+	// Backend failures, mapped from gRPC and HTTP errors
+	ErrTimeout       = errors.New("operation timed out")
+	ErrUnavailable   = errors.New("service unavailable")
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	ErrAlreadyExists = errors.New("already exists")
+
+	// Login and sessions
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrUserDisabled       = errors.New("user is disabled")
+	ErrTooManyAttempts    = errors.New("too many login attempts")
+	ErrSessionExpired     = errors.New("session expired")
+	ErrInvalidPIN         = errors.New("PIN must be 4 to 6 digits")
+	ErrWrongPIN           = errors.New("wrong PIN")
+
+	// Cashier shifts
+	ErrShiftNotFound = errors.New("shift not found")
+	ErrNoOpenShift   = errors.New("no open shift")
+	ErrShiftOpen     = errors.New("a shift is already open")
+	ErrShiftClosed   = errors.New("shift is closed")
+	ErrInvalidAmount = errors.New("invalid amount")
+
+	// Product image uploads
+	ErrUnsupportedImage = errors.New("unsupported image format")
+	ErrImageTooLarge    = errors.New("image is too large")
 )
+
+// userMessages are the Indonesian messages shown for domain errors
+var userMessages = []struct {
+	err     error
+	message string
+}{
+	{ErrInsufficientStock, "stok tidak mencukupi"},
+	{ErrInvalidQuantity, "jumlah tidak valid"},
+	{ErrInvalidPrice, "harga tidak valid"},
+	{ErrProductNotFound, "produk tidak ditemukan"},
+	{ErrTransactionNotFound, "transaksi tidak ditemukan"},
+	{ErrTransactionConflict, "nomor transaksi sudah dipakai transaksi lain, silakan ulangi"},
+	{ErrCategoryNotFound, "kategori tidak ditemukan"},
+	{ErrUserNotFound, "pengguna tidak ditemukan"},
+	{ErrInvalidUser, "data pengguna tidak valid"},
+	{ErrUnauthorized, "anda tidak memiliki akses untuk melakukan tindakan ini"},
+	{ErrOwnAccount, "akun anda sendiri tidak dapat dinonaktifkan, diubah perannya atau dipaksa keluar"},
+	{ErrTimeout, "server terlalu lama merespons, silakan coba lagi"},
+	{ErrUnavailable, "server tidak dapat dihubungi, periksa koneksi internet lalu coba lagi"},
+	{ErrQuotaExceeded, "server sedang sibuk, silakan coba beberapa saat lagi"},
+	{ErrAlreadyExists, "data sudah ada"},
+	{ErrInvalidCredentials, "email atau password salah"},
+	{ErrUserDisabled, "akun ini dinonaktifkan, hubungi admin"},
+	{ErrTooManyAttempts, "terlalu banyak percobaan login, coba lagi beberapa saat lagi"},
+	{ErrSessionExpired, "sesi telah berakhir, silakan login kembali"},
+	{ErrInvalidPIN, "PIN harus terdiri dari 4 sampai 6 angka"},
+	{ErrWrongPIN, "PIN salah"},
+	{ErrShiftNotFound, "shift tidak ditemukan"},
+	{ErrNoOpenShift, "belum ada shift yang dibuka, buka shift terlebih dahulu"},
+	{ErrShiftOpen, "masih ada shift yang terbuka di kasir ini"},
+	{ErrShiftClosed, "shift sudah ditutup"},
+	{ErrInvalidAmount, "jumlah uang tidak valid"},
+	{ErrUnsupportedImage, "format gambar tidak didukung, gunakan JPEG, PNG atau WebP"},
+	{ErrImageTooLarge, "ukuran gambar terlalu besar"},
+}
+
+// UserMessage returns an Indonesian message for err suitable for showing
+// to the cashier. Errors without a known message are returned as is.
+func UserMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	for _, m := range userMessages {
+		if errors.Is(err, m.err) {
+			return m.message
+		}
+	}
+	return err.Error()
+}
+
+// StockError reports the products that could not be sold during checkout
+type StockError struct {
+	ProductIDs []string
+}
+
+// Error implements the error interface
+func (e *StockError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrInsufficientStock, strings.Join(e.ProductIDs, ", "))
+}
+
+// Unwrap allows errors.Is(err, ErrInsufficientStock)
+func (e *StockError) Unwrap() error {
+	return ErrInsufficientStock
+}
@@ -0,0 +1,62 @@
+package models
+
+import "fmt"
+
+// Permission is an action that only some roles may perform
+type Permission string
+
+// Permissions checked by the UI and the repositories
+const (
+	PermProductView       Permission = "product.view"
+	PermProductEdit       Permission = "product.edit"   // add and change products, categories and images
+	PermProductDelete     Permission = "product.delete" // also covers removing unused images
+	PermTransactionCreate Permission = "transaction.create"
+	PermTransactionView   Permission = "transaction.view"
+	PermTransactionVoid   Permission = "transaction.void"
+	PermReportView        Permission = "report.view"
+	PermUserManage        Permission = "user.manage"
+	PermSettingsManage    Permission = "settings.manage" // backups, restores and storage
+)
+
+// rolePermissions lists what each role may do
+var rolePermissions = map[string][]Permission{
+	RoleAdmin: {
+		PermProductView, PermProductEdit, PermProductDelete,
+		PermTransactionCreate, PermTransactionView, PermTransactionVoid,
+		PermReportView, PermUserManage, PermSettingsManage,
+	},
+	RoleKasir: {
+		PermProductView,
+		PermTransactionCreate, PermTransactionView,
+	},
+}
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RoleHas reports whether role grants permission
+func RoleHas(role string, permission Permission) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Can checks if the user's role grants permission
+func (u *User) Can(permission Permission) bool {
+	return u != nil && RoleHas(u.Role, permission)
+}
+
+// Require returns an error wrapping ErrUnauthorized when the user's role
+// does not grant permission
+func (u *User) Require(permission Permission) error {
+	if u.Can(permission) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrUnauthorized, permission)
+}
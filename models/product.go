@@ -15,6 +15,20 @@ type Product struct {
 	ImageURL  string    `json:"image_url" firestore:"image_url"`
 	CreatedAt time.Time `json:"created_at" firestore:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" firestore:"updated_at"`
+
+	// Small copy of the image for the POS grid, and the storage object
+	// names of both so they can be replaced or removed
+	ThumbnailURL  string `json:"thumbnail_url" firestore:"thumbnail_url"`
+	ImagePath     string `json:"image_path" firestore:"image_path"`
+	ThumbnailPath string `json:"thumbnail_path" firestore:"thumbnail_path"`
+}
+
+// LowStockThreshold is the stock level at which a product needs restocking
+const LowStockThreshold = 10
+
+// SetID sets the product ID from its Firestore document ID
+func (p *Product) SetID(id string) {
+	p.ProductID = id
 }
 
 // IsInStock checks if product has available stock
@@ -22,6 +36,11 @@ func (p *Product) IsInStock() bool {
 	return p.Stock > 0
 }
 
+// IsLowStock checks if product stock is at or below LowStockThreshold
+func (p *Product) IsLowStock() bool {
+	return p.Stock <= LowStockThreshold
+}
+
 // CanSell checks if product can be sold with given quantity
 func (p *Product) CanSell(quantity int) bool {
 	return p.Stock >= quantity && quantity > 0
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Shift is a cashier's working period on a terminal, from opening the cash
+// drawer with a starting float to counting it at the end
+type Shift struct {
+	ShiftID      string    `json:"shift_id" firestore:"shift_id"`
+	TerminalID   string    `json:"terminal_id" firestore:"terminal_id"`
+	Status       string    `json:"status" firestore:"status"`
+	OpenedBy     string    `json:"opened_by" firestore:"opened_by"`
+	OpenedByName string    `json:"opened_by_name" firestore:"opened_by_name"`
+	OpenedAt     time.Time `json:"opened_at" firestore:"opened_at"`
+	OpeningCash  float64   `json:"opening_cash" firestore:"opening_cash"`
+
+	// Set when the shift is closed
+	ClosedBy     string         `json:"closed_by,omitempty" firestore:"closed_by,omitempty"`
+	ClosedByName string         `json:"closed_by_name,omitempty" firestore:"closed_by_name,omitempty"`
+	ClosedAt     time.Time      `json:"closed_at,omitempty" firestore:"closed_at,omitempty"`
+	CashCounts   []CashCount    `json:"cash_counts,omitempty" firestore:"cash_counts,omitempty"`
+	CountedCash  float64        `json:"counted_cash" firestore:"counted_cash"`
+	ExpectedCash float64        `json:"expected_cash" firestore:"expected_cash"`
+	Variance     float64        `json:"variance" firestore:"variance"` // counted minus expected
+	Payments     []PaymentTotal `json:"payments,omitempty" firestore:"payments,omitempty"`
+	SalesCount   int            `json:"sales_count" firestore:"sales_count"`
+	SalesTotal   float64        `json:"sales_total" firestore:"sales_total"`
+}
+
+// Shift status constants
+const (
+	ShiftOpen   = "open"
+	ShiftClosed = "closed"
+)
+
+// Denominations are the rupiah notes and coins counted when closing a
+// shift, largest first
+var Denominations = []int64{100000, 50000, 20000, 10000, 5000, 2000, 1000, 500, 200, 100}
+
+// CashCount is the number of notes or coins of one denomination in the
+// drawer
+type CashCount struct {
+	Denomination int64 `json:"denomination" firestore:"denomination"`
+	Count        int   `json:"count" firestore:"count"`
+}
+
+// PaymentTotal is the number and value of sales paid with one method
+type PaymentTotal struct {
+	Method string  `json:"method" firestore:"method"`
+	Count  int     `json:"count" firestore:"count"`
+	Total  float64 `json:"total" firestore:"total"`
+}
+
+// NewShift opens a shift on a terminal with the cash already in the drawer.
+// The name of the user is kept so reports need not look them up.
+func NewShift(terminalID, userID, userName string, openingCash float64) (*Shift, error) {
+	if openingCash < 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	now := time.Now()
+	return &Shift{
+		ShiftID:      fmt.Sprintf("shift_%d", now.UnixNano()),
+		TerminalID:   terminalID,
+		Status:       ShiftOpen,
+		OpenedBy:     userID,
+		OpenedByName: userName,
+		OpenedAt:     now,
+		OpeningCash:  openingCash,
+	}, nil
+}
+
+// SetID sets the shift ID from its Firestore document ID
+func (s *Shift) SetID(id string) {
+	s.ShiftID = id
+}
+
+// IsOpen reports whether sales can still be recorded in the shift
+func (s *Shift) IsOpen() bool {
+	return s.Status == ShiftOpen
+}
+
+// Close closes the shift with the cash counted in the drawer. The sales are
+// the transactions of the shift, they decide how much cash is expected.
+func (s *Shift) Close(userID, userName string, counts []CashCount, sales []Transaction) error {
+	if !s.IsOpen() {
+		return ErrShiftClosed
+	}
+	for _, count := range counts {
+		if count.Count < 0 {
+			return ErrInvalidAmount
+		}
+	}
+
+	s.Payments = SummarizePayments(sales)
+	s.SalesCount = len(sales)
+	s.SalesTotal = 0
+	cashSales := 0.0
+	for _, payment := range s.Payments {
+		s.SalesTotal += payment.Total
+		if payment.Method == PaymentCash {
+			cashSales = payment.Total
+		}
+	}
+
+	s.CashCounts = counts
+	s.CountedCash = TotalCash(counts)
+	s.ExpectedCash = s.OpeningCash + cashSales
+	s.Variance = s.CountedCash - s.ExpectedCash
+	s.ClosedBy = userID
+	s.ClosedByName = userName
+	s.ClosedAt = time.Now()
+	s.Status = ShiftClosed
+	return nil
+}
+
+// TotalCash adds up counted notes and coins
+func TotalCash(counts []CashCount) float64 {
+	total := 0.0
+	for _, count := range counts {
+		total += float64(count.Denomination) * float64(count.Count)
+	}
+	return total
+}
+
+// SummarizePayments totals sales by payment method. The known methods come
+// first in a fixed order, even without sales, followed by any others.
+func SummarizePayments(sales []Transaction) []PaymentTotal {
+	payments := []PaymentTotal{{Method: PaymentCash}, {Method: PaymentCard}, {Method: PaymentDigital}}
+	index := map[string]int{PaymentCash: 0, PaymentCard: 1, PaymentDigital: 2}
+
+	for _, sale := range sales {
+		i, ok := index[sale.PaymentMethod]
+		if !ok {
+			i = len(payments)
+			index[sale.PaymentMethod] = i
+			payments = append(payments, PaymentTotal{Method: sale.PaymentMethod})
+		}
+		payments[i].Count++
+		payments[i].Total += sale.Total
+	}
+	return payments
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"time"
 )
 
@@ -8,12 +11,46 @@ import (
 type Transaction struct {
 	TransID       string            `json:"trans_id" firestore:"trans_id"`
 	UserID        string            `json:"user_id" firestore:"user_id"`
+	ShiftID       string            `json:"shift_id,omitempty" firestore:"shift_id,omitempty"`
 	Date          time.Time         `json:"date" firestore:"date"`
 	Total         float64           `json:"total" firestore:"total"`
 	PaymentMethod string            `json:"payment_method" firestore:"payment_method"`
 	Items         []TransactionItem `json:"items" firestore:"items"`
 }
 
+// SetID sets the transaction ID from its Firestore document ID
+func (t *Transaction) SetID(id string) {
+	t.TransID = id
+}
+
+// NewTransactionID returns the ID of a new sale. The random part keeps
+// sales started at the same moment, on this or another terminal, apart.
+// The ID is kept when the checkout of the sale is retried.
+func NewTransactionID() string {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		// Only the time is left, still unique on this terminal
+		return fmt.Sprintf("trans_%d", time.Now().UnixNano())
+	}
+	return fmt.Sprintf("trans_%d_%s", time.Now().UnixNano(), hex.EncodeToString(suffix))
+}
+
+// SameSale reports whether other records the same sale as t, e.g. an
+// earlier attempt to check t out. A different sale with the same ID is a
+// conflict, not a duplicate.
+func (t *Transaction) SameSale(other *Transaction) bool {
+	if t.TransID != other.TransID || t.UserID != other.UserID ||
+		t.Total != other.Total || len(t.Items) != len(other.Items) {
+		return false
+	}
+	for i := range t.Items {
+		if t.Items[i] != other.Items[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // TransactionItem represents an item in a transaction
 type TransactionItem struct {
 	ProductID string  `json:"product_id" firestore:"product_id"`
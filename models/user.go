@@ -10,6 +10,8 @@ type User struct {
 	Email     string    `json:"email" firestore:"email"`
 	Name      string    `json:"name" firestore:"name"`
 	Role      string    `json:"role" firestore:"role"` // "admin" or "kasir"
+	Disabled  bool      `json:"disabled" firestore:"disabled"`
+	PINHash   string    `json:"pin_hash,omitempty" firestore:"pin_hash,omitempty"` // empty without a PIN
 	CreatedAt time.Time `json:"created_at" firestore:"created_at"`
 	LastLogin time.Time `json:"last_login" firestore:"last_login"`
 }
@@ -20,6 +22,30 @@ const (
 	RoleKasir = "kasir"
 )
 
+// PIN lengths, PINs are digits only
+const (
+	MinPINLength = 4
+	MaxPINLength = 6
+)
+
+// ValidPIN checks pin has MinPINLength to MaxPINLength digits
+func ValidPIN(pin string) bool {
+	if len(pin) < MinPINLength || len(pin) > MaxPINLength {
+		return false
+	}
+	for _, c := range pin {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// HasPIN reports whether the user can switch in with a PIN
+func (u *User) HasPIN() bool {
+	return u.PINHash != ""
+}
+
 // IsAdmin checks if user has admin role
 func (u *User) IsAdmin() bool {
 	return u.Role == RoleAdmin
@@ -29,3 +55,8 @@ func (u *User) IsAdmin() bool {
 func (u *User) IsKasir() bool {
 	return u.Role == RoleKasir
 }
+
+// SetID sets the user ID from its Firestore document ID
+func (u *User) SetID(id string) {
+	u.UserID = id
+}
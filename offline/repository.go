@@ -0,0 +1,454 @@
+package offline
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"kasirnest/models"
+	"kasirnest/repository"
+)
+
+// NewRepositories wraps the remote repositories so products can be read
+// and sales recorded without connectivity. Sales go to Firestore directly
+// and are only queued locally when it cannot be reached. Shifts are always
+// written to the local store first and pushed to Firestore by the syncer.
+func NewRepositories(store *Store, remote *repository.Repositories, syncer *Syncer) *repository.Repositories {
+	watchers := &productWatchers{store: store, callbacks: make(map[int]func([]models.Product, error))}
+
+	return &repository.Repositories{
+		Products:     &productRepository{store: store, remote: remote.Products, watchers: watchers},
+		Transactions: &transactionRepository{store: store, remote: remote.Transactions, syncer: syncer, watchers: watchers},
+		Users:        remote.Users,
+		Categories:   remote.Categories,
+		Shifts:       &shiftRepository{store: store, remote: remote.Shifts, syncer: syncer},
+	}
+}
+
+// productRepository reads products from Firestore, falling back to the
+// local mirror when Firestore cannot be reached
+type productRepository struct {
+	store    *Store
+	remote   repository.ProductRepository
+	watchers *productWatchers
+}
+
+func (r *productRepository) Get(ctx context.Context, productID string) (*models.Product, error) {
+	product, err := r.remote.Get(ctx, productID)
+	if err == nil || errors.Is(err, models.ErrProductNotFound) {
+		return product, err
+	}
+
+	log.Printf("Reading product %s from local store: %v", productID, err)
+	return r.store.Product(productID)
+}
+
+func (r *productRepository) List(ctx context.Context) ([]models.Product, error) {
+	products, err := r.remote.List(ctx)
+	if err == nil || repository.IsPartial(err) {
+		return r.mirror(products, err), err
+	}
+
+	log.Printf("Reading products from local store: %v", err)
+	local, localErr := r.store.Products()
+	if localErr != nil {
+		return nil, err
+	}
+	return local, &repository.StaleError{Err: err}
+}
+
+// mirror refreshes the local mirror and returns it, so stock already
+// sold by queued sales is reflected in what the cashier sees. listErr is
+// the error the products were read with.
+func (r *productRepository) mirror(products []models.Product, listErr error) []models.Product {
+	if err := mirrorProducts(r.store, products, listErr); err != nil {
+		log.Printf("Failed to update local product mirror: %v", err)
+		return products
+	}
+
+	mirrored, err := r.store.Products()
+	if err != nil {
+		return products
+	}
+	return mirrored
+}
+
+func (r *productRepository) Create(ctx context.Context, product *models.Product) error {
+	if err := r.remote.Create(ctx, product); err != nil {
+		return err
+	}
+	return r.store.PutProduct(*product)
+}
+
+func (r *productRepository) Update(ctx context.Context, product *models.Product) error {
+	if err := r.remote.Update(ctx, product); err != nil {
+		return err
+	}
+	return r.store.PutProduct(*product)
+}
+
+func (r *productRepository) Delete(ctx context.Context, productID string) error {
+	if err := r.remote.Delete(ctx, productID); err != nil {
+		return err
+	}
+	return r.store.DeleteProduct(productID)
+}
+
+func (r *productRepository) Count(ctx context.Context) (int, error) {
+	count, err := r.remote.Count(ctx)
+	if err == nil {
+		return count, nil
+	}
+
+	products, localErr := r.store.Products()
+	if localErr != nil {
+		return 0, err
+	}
+	return len(products), nil
+}
+
+func (r *productRepository) CountLowStock(ctx context.Context, threshold int) (int, error) {
+	count, err := r.remote.CountLowStock(ctx, threshold)
+	if err == nil {
+		return count, nil
+	}
+
+	products, localErr := r.store.Products()
+	if localErr != nil {
+		return 0, err
+	}
+	count = 0
+	for _, product := range products {
+		if product.Stock <= threshold {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Watch follows the remote products and mirrors every update locally.
+// While the remote listener is broken watchers get the local mirror, which
+// also changes whenever a sale is recorded on this terminal.
+func (r *productRepository) Watch(ctx context.Context, onChange func([]models.Product, error)) (func(), error) {
+	id := r.watchers.add(onChange)
+
+	stopRemote, err := r.remote.Watch(ctx, func(products []models.Product, err error) {
+		if err == nil || repository.IsPartial(err) {
+			onChange(r.mirror(products, err), err)
+			return
+		}
+
+		log.Printf("Product listener offline, using local store: %v", err)
+		local, localErr := r.store.Products()
+		if localErr != nil {
+			onChange(nil, err)
+			return
+		}
+		onChange(local, &repository.StaleError{Err: err})
+	})
+	if err != nil {
+		// Without a remote listener only local sales update the products
+		log.Printf("Watching local products only: %v", err)
+		r.watchers.notifyOne(onChange)
+		return func() { r.watchers.remove(id) }, nil
+	}
+
+	return func() {
+		stopRemote()
+		r.watchers.remove(id)
+	}, nil
+}
+
+// productWatchers tracks product watchers that should also hear about
+// stock changes made by local sales
+type productWatchers struct {
+	store *Store
+
+	mu        sync.Mutex
+	callbacks map[int]func([]models.Product, error)
+	nextID    int
+}
+
+func (w *productWatchers) add(callback func([]models.Product, error)) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	id := w.nextID
+	w.nextID++
+	w.callbacks[id] = callback
+	return id
+}
+
+func (w *productWatchers) remove(id int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.callbacks, id)
+}
+
+// notify sends the local products to every watcher
+func (w *productWatchers) notify() {
+	w.mu.Lock()
+	callbacks := make([]func([]models.Product, error), 0, len(w.callbacks))
+	for _, callback := range w.callbacks {
+		callbacks = append(callbacks, callback)
+	}
+	w.mu.Unlock()
+
+	for _, callback := range callbacks {
+		w.notifyOne(callback)
+	}
+}
+
+// notifyOne sends the local products to a single watcher
+func (w *productWatchers) notifyOne(callback func([]models.Product, error)) {
+	products, err := w.store.Products()
+	if err != nil {
+		log.Printf("Failed to read local products: %v", err)
+		return
+	}
+	callback(products, nil)
+}
+
+// transactionRepository records sales in Firestore, queueing them locally
+// for upload while it cannot be reached
+type transactionRepository struct {
+	store    *Store
+	remote   repository.TransactionRepository
+	syncer   *Syncer
+	watchers *productWatchers
+
+	// count is the last transaction count read from Firestore, plus the
+	// sales committed from this terminal since
+	mu         sync.Mutex
+	count      int
+	countKnown bool
+}
+
+func (r *transactionRepository) Get(ctx context.Context, transID string) (*models.Transaction, error) {
+	transaction, err := r.store.Transaction(transID)
+	if err == nil {
+		return transaction, nil
+	}
+	return r.remote.Get(ctx, transID)
+}
+
+func (r *transactionRepository) List(ctx context.Context, query repository.TransactionQuery) (*repository.TransactionPage, error) {
+	if query.ShiftID != "" && r.store.ShiftSales(query.ShiftID) {
+		// Every sale of a shift opened here is kept locally until the
+		// shift is closed, including those still waiting in the outbox
+		transactions, err := r.store.Transactions()
+		if err == nil {
+			return repository.PageTransactions(transactions, query)
+		}
+		log.Printf("Failed to read shift %s sales from local store: %v", query.ShiftID, err)
+	}
+
+	page, err := r.remote.List(ctx, query)
+	if err == nil || repository.IsPartial(err) {
+		return page, err
+	}
+
+	log.Printf("Reading transactions from local store: %v", err)
+	transactions, localErr := r.store.Transactions()
+	if localErr != nil {
+		return nil, err
+	}
+	page, localErr = repository.PageTransactions(transactions, query)
+	if localErr != nil {
+		return nil, localErr
+	}
+	return page, &repository.StaleError{Err: err}
+}
+
+// Checkout commits the sale to Firestore, so a stock conflict with another
+// terminal is reported to the cashier right away. Only when Firestore
+// cannot be reached is the sale checked against the local mirror and
+// queued for the syncer.
+func (r *transactionRepository) Checkout(ctx context.Context, transaction *models.Transaction) error {
+	if !r.syncer.Offline() {
+		err := r.remote.Checkout(ctx, transaction)
+		switch {
+		case err == nil || errors.Is(err, models.ErrAlreadyExists):
+			// ErrAlreadyExists means Firestore holds this very sale, from
+			// an earlier attempt whose response was lost. Another sale
+			// under the same ID is ErrTransactionConflict and returned.
+			if err := r.store.RecordSynced(transaction); err != nil {
+				log.Printf("Failed to record transaction %s locally: %v", transaction.TransID, err)
+			}
+			r.mu.Lock()
+			r.count++
+			r.mu.Unlock()
+			r.watchers.notify()
+			return nil
+		case errors.Is(err, models.ErrUnavailable) || errors.Is(err, models.ErrTimeout):
+			log.Printf("Queueing transaction %s for upload: %v", transaction.TransID, err)
+		default:
+			return err
+		}
+	}
+
+	if err := r.store.RecordSale(transaction); err != nil {
+		return err
+	}
+
+	r.watchers.notify()
+	r.syncer.Trigger()
+	return nil
+}
+
+// Count adds the sales waiting in the outbox to the count in Firestore.
+// Without Firestore the last count read is used, so the number does not
+// drop to what happens to be stored on this terminal.
+func (r *transactionRepository) Count(ctx context.Context) (int, error) {
+	pending, _, pendingErr := r.store.OutboxCounts()
+	if pendingErr != nil {
+		pending = 0
+	}
+
+	count, err := r.remote.Count(ctx)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		r.count = count
+		r.countKnown = true
+		return count + pending, nil
+	}
+	if !r.countKnown {
+		return 0, err
+	}
+	return r.count + pending, nil
+}
+
+// Summary adds the sales still waiting in the outbox to the remote summary,
+// or summarizes the transactions kept on this terminal when Firestore cannot
+// be reached
+func (r *transactionRepository) Summary(ctx context.Context, from, to time.Time) (*repository.SalesSummary, error) {
+	local, localErr := r.store.Transactions()
+
+	summary, err := r.remote.Summary(ctx, from, to)
+	if err != nil {
+		if localErr != nil {
+			return nil, err
+		}
+		return repository.SummarizeTransactions(local, from, to), &repository.StaleError{Err: err}
+	}
+	if localErr != nil {
+		return summary, nil
+	}
+
+	pending, err := r.store.Outbox()
+	if err != nil {
+		return summary, nil
+	}
+	unsynced := make(map[string]bool, len(pending))
+	for _, entry := range pending {
+		unsynced[entry.TransID] = entry.Status == StatusPending
+	}
+
+	queued := make([]models.Transaction, 0, len(pending))
+	for _, transaction := range local {
+		if unsynced[transaction.TransID] {
+			queued = append(queued, transaction)
+		}
+	}
+	extra := repository.SummarizeTransactions(queued, from, to)
+	summary.Count += extra.Count
+	summary.Total += extra.Total
+	return summary, nil
+}
+
+// shiftRepository keeps the shifts of this terminal locally, so the drawer
+// can be opened and counted without connectivity
+type shiftRepository struct {
+	store  *Store
+	remote repository.ShiftRepository
+	syncer *Syncer
+}
+
+func (r *shiftRepository) Get(ctx context.Context, shiftID string) (*models.Shift, error) {
+	shift, err := r.store.Shift(shiftID)
+	if err == nil {
+		return shift, nil
+	}
+	return r.remote.Get(ctx, shiftID)
+}
+
+// Current prefers the local store, which knows every shift opened on this
+// terminal. Firestore is only asked when the local store has no open shift,
+// e.g. after it was reset.
+func (r *shiftRepository) Current(ctx context.Context, terminalID string) (*models.Shift, error) {
+	shift, err := r.store.OpenShift(terminalID)
+	if !errors.Is(err, models.ErrNoOpenShift) {
+		return shift, err
+	}
+
+	shift, err = r.remote.Current(ctx, terminalID)
+	if err != nil {
+		if !errors.Is(err, models.ErrNoOpenShift) {
+			log.Printf("Checking for an open shift in Firestore: %v", err)
+		}
+		return nil, models.ErrNoOpenShift
+	}
+	if local, err := r.store.Shift(shift.ShiftID); err == nil && !local.IsOpen() {
+		// Closed here, Firestore has not heard about it yet
+		return nil, models.ErrNoOpenShift
+	}
+	if err := r.store.MirrorShift(*shift); err != nil {
+		log.Printf("Failed to store shift %s locally: %v", shift.ShiftID, err)
+	}
+	return shift, nil
+}
+
+func (r *shiftRepository) Save(ctx context.Context, shift *models.Shift) error {
+	if err := r.store.PutShift(*shift); err != nil {
+		return err
+	}
+	r.syncer.Trigger()
+	return nil
+}
+
+// List returns the shifts in Firestore with the local changes not uploaded
+// yet, or only the local shifts when Firestore cannot be reached
+func (r *shiftRepository) List(ctx context.Context, from, to time.Time) ([]models.Shift, error) {
+	remote, err := r.remote.List(ctx, from, to)
+	if err != nil && !repository.IsPartial(err) {
+		log.Printf("Reading shifts from local store: %v", err)
+		local, localErr := r.store.Shifts()
+		if localErr != nil {
+			return nil, err
+		}
+		return filterShifts(local, from, to), &repository.StaleError{Err: err}
+	}
+
+	pending, pendingErr := r.store.PendingShifts()
+	if pendingErr != nil {
+		return remote, err
+	}
+	byID := make(map[string]int, len(remote))
+	for i, shift := range remote {
+		byID[shift.ShiftID] = i
+	}
+	for _, local := range pending {
+		if i, ok := byID[local.Shift.ShiftID]; ok {
+			remote[i] = local.Shift
+		} else {
+			remote = append(remote, local.Shift)
+		}
+	}
+	return filterShifts(remote, from, to), err
+}
+
+// filterShifts returns the shifts opened in [from, to), most recent first
+func filterShifts(shifts []models.Shift, from, to time.Time) []models.Shift {
+	matches := make([]models.Shift, 0, len(shifts))
+	for _, shift := range shifts {
+		if !shift.OpenedAt.Before(from) && shift.OpenedAt.Before(to) {
+			matches = append(matches, shift)
+		}
+	}
+	repository.SortShifts(matches)
+	return matches
+}
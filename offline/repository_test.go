@@ -0,0 +1,100 @@
+package offline
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"kasirnest/models"
+	"kasirnest/repository"
+)
+
+// newTestRemote returns memory repositories standing in for Firestore,
+// stocked like newTestStore
+func newTestRemote(t *testing.T) *repository.Repositories {
+	t.Helper()
+	remote := repository.NewMemoryRepositories()
+	for _, product := range []models.Product{
+		{ProductID: "kopi", Name: "Kopi", Stock: 10},
+		{ProductID: "teh", Name: "Teh", Stock: 5},
+	} {
+		product := product
+		if err := remote.Products.Create(context.Background(), &product); err != nil {
+			t.Fatalf("Create(%s): %v", product.ProductID, err)
+		}
+	}
+	return remote
+}
+
+func TestCheckoutIDConflictNotAcknowledged(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	remote := newTestRemote(t)
+	repos := NewRepositories(store, remote, NewSyncer(store, remote, time.Minute))
+
+	if err := remote.Transactions.Checkout(ctx, sale("t1", "", "kopi", 1)); err != nil {
+		t.Fatalf("remote Checkout: %v", err)
+	}
+
+	// A different sale that got the same ID must not be taken for it
+	err := repos.Transactions.Checkout(ctx, sale("t1", "", "teh", 2))
+	if !errors.Is(err, models.ErrTransactionConflict) || errors.Is(err, models.ErrAlreadyExists) {
+		t.Fatalf("Checkout = %v, want ErrTransactionConflict", err)
+	}
+	if got := stockOf(t, store, "teh"); got != 5 {
+		t.Errorf("mirrored teh stock = %d, want 5", got)
+	}
+	if pending, failed, _ := store.OutboxCounts(); pending != 0 || failed != 0 {
+		t.Errorf("outbox = %d pending, %d failed, want empty", pending, failed)
+	}
+	if count, err := repos.Transactions.Count(ctx); err != nil || count != 1 {
+		t.Errorf("Count = %d, %v, want 1", count, err)
+	}
+}
+
+func TestSyncIDConflictNotAcknowledged(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	remote := newTestRemote(t)
+	syncer := NewSyncer(store, remote, time.Minute)
+
+	committed := sale("t1", "", "kopi", 1)
+	if err := remote.Transactions.Checkout(ctx, committed); err != nil {
+		t.Fatalf("remote Checkout: %v", err)
+	}
+
+	// Queued offline: the same sale again, and another sale with the ID
+	// of a sale already in Firestore
+	if err := store.RecordSale(committed); err != nil {
+		t.Fatalf("RecordSale(same): %v", err)
+	}
+	conflicting := sale("t2", "", "teh", 2)
+	if err := remote.Transactions.Checkout(ctx, sale("t2", "", "kopi", 3)); err != nil {
+		t.Fatalf("remote Checkout(t2): %v", err)
+	}
+	if err := store.RecordSale(conflicting); err != nil {
+		t.Fatalf("RecordSale(conflicting): %v", err)
+	}
+
+	syncer.syncOnce()
+
+	entries, err := store.Outbox()
+	if err != nil {
+		t.Fatalf("Outbox: %v", err)
+	}
+	if len(entries) != 1 || entries[0].TransID != "t2" || entries[0].Status != StatusFailed {
+		t.Fatalf("outbox = %+v, want only t2 failed", entries)
+	}
+	if _, err := store.Transaction("t2"); err != nil {
+		t.Errorf("conflicting sale dropped from the local store: %v", err)
+	}
+
+	stored, err := remote.Transactions.Get(ctx, "t2")
+	if err != nil {
+		t.Fatalf("remote Get(t2): %v", err)
+	}
+	if stored.Items[0].ProductID != "kopi" {
+		t.Errorf("remote t2 sells %s, want the original kopi sale", stored.Items[0].ProductID)
+	}
+}
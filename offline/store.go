@@ -0,0 +1,737 @@
+package offline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"kasirnest/models"
+)
+
+// Bucket names in the local database
+var (
+	productsBucket     = []byte("products")
+	transactionsBucket = []byte("transactions")
+	outboxBucket       = []byte("outbox")
+	shiftsBucket       = []byte("shifts")
+	pinFailuresBucket  = []byte("pin_failures")
+)
+
+// Outbox entry statuses
+const (
+	StatusPending = "pending"
+	StatusFailed  = "failed"
+)
+
+// OutboxEntry tracks a locally recorded transaction that still has to be
+// pushed to Firestore
+type OutboxEntry struct {
+	TransID   string    `json:"trans_id"`
+	Status    string    `json:"status"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error"`
+	QueuedAt  time.Time `json:"queued_at"`
+}
+
+// localShift is a shift stored on this terminal. Version counts local
+// changes, Synced is the version last uploaded to Firestore. Opened is set
+// when the shift was opened here rather than read back from Firestore.
+type localShift struct {
+	Shift   models.Shift `json:"shift"`
+	Version int          `json:"version"`
+	Synced  int          `json:"synced"`
+	Opened  bool         `json:"opened"`
+}
+
+// keepsSales reports whether the sales of the shift are kept locally. They
+// are needed until the shift is closed and the close was uploaded.
+func (l localShift) keepsSales() bool {
+	return l.Shift.IsOpen() || l.Synced != l.Version
+}
+
+// pinFailures counts the wrong PINs entered for a user on this terminal
+type pinFailures struct {
+	Count int       `json:"count"`
+	Until time.Time `json:"until"`
+}
+
+// PendingShift is a shift changed on this terminal since it was last
+// uploaded
+type PendingShift struct {
+	Shift   models.Shift
+	Version int
+}
+
+// Store is the embedded local database that mirrors products and keeps
+// transactions recorded on this terminal
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens (or creates) the local database at path
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{productsBucket, transactionsBucket, outboxBucket, shiftsBucket, pinFailuresBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		// Older versions kept every sale, drop those already uploaded
+		return pruneTransactions(tx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Close closes the local database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// ReplaceProducts replaces the product mirror with the products from
+// Firestore. Stock still held by pending outbox sales is subtracted again
+// so the mirror matches what the terminal has already sold.
+func (s *Store) ReplaceProducts(products []models.Product) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		pending, err := pendingQuantities(tx)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.DeleteBucket(productsBucket); err != nil {
+			return err
+		}
+		bucket, err := tx.CreateBucket(productsBucket)
+		if err != nil {
+			return err
+		}
+
+		return putMirrored(bucket, products, pending)
+	})
+}
+
+// MergeProducts updates the given products in the mirror and keeps the
+// others. It is used when Firestore returned only some of the products.
+func (s *Store) MergeProducts(products []models.Product) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		pending, err := pendingQuantities(tx)
+		if err != nil {
+			return err
+		}
+		return putMirrored(tx.Bucket(productsBucket), products, pending)
+	})
+}
+
+// putMirrored stores products from Firestore, less the stock held by
+// pending outbox sales
+func putMirrored(bucket *bolt.Bucket, products []models.Product, pending map[string]int) error {
+	for _, product := range products {
+		product.Stock -= pending[product.ProductID]
+		if product.Stock < 0 {
+			product.Stock = 0
+		}
+		if err := putJSON(bucket, product.ProductID, product); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PutProduct stores a single product in the mirror
+func (s *Store) PutProduct(product models.Product) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(productsBucket), product.ProductID, product)
+	})
+}
+
+// DeleteProduct removes a product from the mirror
+func (s *Store) DeleteProduct(productID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(productsBucket).Delete([]byte(productID))
+	})
+}
+
+// Product returns a mirrored product
+func (s *Store) Product(productID string) (*models.Product, error) {
+	var product models.Product
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(productsBucket).Get([]byte(productID))
+		if data == nil {
+			return models.ErrProductNotFound
+		}
+		return json.Unmarshal(data, &product)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// Products returns all mirrored products
+func (s *Store) Products() ([]models.Product, error) {
+	products := make([]models.Product, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(productsBucket).ForEach(func(k, v []byte) error {
+			var product models.Product
+			if err := json.Unmarshal(v, &product); err != nil {
+				return err
+			}
+			products = append(products, product)
+			return nil
+		})
+	})
+	return products, err
+}
+
+// RecordSale validates the sale against the mirrored stock, decrements it,
+// stores the transaction and queues it for upload, all in one local
+// database transaction
+func (s *Store) RecordSale(transaction *models.Transaction) error {
+	if transaction == nil || len(transaction.Items) == 0 {
+		return models.ErrInvalidQuantity
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		transactions := tx.Bucket(transactionsBucket)
+		if data := transactions.Get([]byte(transaction.TransID)); data != nil {
+			var stored models.Transaction
+			if err := json.Unmarshal(data, &stored); err != nil {
+				return err
+			}
+			if !stored.SameSale(transaction) {
+				return fmt.Errorf("%w: %s", models.ErrTransactionConflict, transaction.TransID)
+			}
+			return fmt.Errorf("%w: transaction %s", models.ErrAlreadyExists, transaction.TransID)
+		}
+
+		quantities := make(map[string]int)
+		var productIDs []string
+		for _, item := range transaction.Items {
+			if item.Quantity <= 0 {
+				return models.ErrInvalidQuantity
+			}
+			if _, exists := quantities[item.ProductID]; !exists {
+				productIDs = append(productIDs, item.ProductID)
+			}
+			quantities[item.ProductID] += item.Quantity
+		}
+
+		products := tx.Bucket(productsBucket)
+		stocked := make([]models.Product, len(productIDs))
+		var insufficient []string
+		for i, productID := range productIDs {
+			data := products.Get([]byte(productID))
+			if data == nil {
+				return models.ErrProductNotFound
+			}
+			if err := json.Unmarshal(data, &stocked[i]); err != nil {
+				return err
+			}
+			if !stocked[i].CanSell(quantities[productID]) {
+				insufficient = append(insufficient, productID)
+			}
+		}
+
+		if len(insufficient) > 0 {
+			return &models.StockError{ProductIDs: insufficient}
+		}
+
+		for i := range stocked {
+			product := &stocked[i]
+			if err := product.UpdateStock(quantities[product.ProductID]); err != nil {
+				return err
+			}
+			if err := putJSON(products, product.ProductID, *product); err != nil {
+				return err
+			}
+		}
+
+		if err := putJSON(transactions, transaction.TransID, *transaction); err != nil {
+			return err
+		}
+
+		return putJSON(tx.Bucket(outboxBucket), transaction.TransID, OutboxEntry{
+			TransID:  transaction.TransID,
+			Status:   StatusPending,
+			QueuedAt: time.Now(),
+		})
+	})
+}
+
+// RecordSynced applies a sale already committed to Firestore to the
+// mirrored stock. The transaction is only kept while its shift needs it.
+func (s *Store) RecordSynced(transaction *models.Transaction) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		transactions := tx.Bucket(transactionsBucket)
+		if transactions.Get([]byte(transaction.TransID)) != nil {
+			return nil
+		}
+
+		products := tx.Bucket(productsBucket)
+		for _, item := range transaction.Items {
+			data := products.Get([]byte(item.ProductID))
+			if data == nil {
+				continue
+			}
+			var product models.Product
+			if err := json.Unmarshal(data, &product); err != nil {
+				return err
+			}
+			product.Stock -= item.Quantity
+			if product.Stock < 0 {
+				product.Stock = 0
+			}
+			if err := putJSON(products, product.ProductID, product); err != nil {
+				return err
+			}
+		}
+
+		keep, err := keepsTransaction(tx, transaction)
+		if err != nil || !keep {
+			return err
+		}
+		return putJSON(transactions, transaction.TransID, *transaction)
+	})
+}
+
+// Transaction returns a locally recorded transaction
+func (s *Store) Transaction(transID string) (*models.Transaction, error) {
+	var transaction models.Transaction
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(transactionsBucket).Get([]byte(transID))
+		if data == nil {
+			return models.ErrTransactionNotFound
+		}
+		return json.Unmarshal(data, &transaction)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+// Transactions returns all locally recorded transactions
+func (s *Store) Transactions() ([]models.Transaction, error) {
+	transactions := make([]models.Transaction, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(transactionsBucket).ForEach(func(k, v []byte) error {
+			var transaction models.Transaction
+			if err := json.Unmarshal(v, &transaction); err != nil {
+				return err
+			}
+			transactions = append(transactions, transaction)
+			return nil
+		})
+	})
+	return transactions, err
+}
+
+// Outbox returns all queued entries, oldest first
+func (s *Store) Outbox() ([]OutboxEntry, error) {
+	entries := make([]OutboxEntry, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(outboxBucket).ForEach(func(k, v []byte) error {
+			var entry OutboxEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys are transaction IDs, order by queue time instead
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].QueuedAt.Before(entries[j].QueuedAt)
+	})
+	return entries, nil
+}
+
+// OutboxCounts returns the number of pending and failed outbox entries
+func (s *Store) OutboxCounts() (pending, failed int, err error) {
+	entries, err := s.Outbox()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, entry := range entries {
+		if entry.Status == StatusFailed {
+			failed++
+		} else {
+			pending++
+		}
+	}
+	return pending, failed, nil
+}
+
+// MarkSynced removes a transaction from the outbox. The transaction itself
+// is dropped too unless its shift still needs it.
+func (s *Store) MarkSynced(transID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(outboxBucket).Delete([]byte(transID)); err != nil {
+			return err
+		}
+
+		transactions := tx.Bucket(transactionsBucket)
+		data := transactions.Get([]byte(transID))
+		if data == nil {
+			return nil
+		}
+		var transaction models.Transaction
+		if err := json.Unmarshal(data, &transaction); err != nil {
+			return err
+		}
+		keep, err := keepsTransaction(tx, &transaction)
+		if err != nil || keep {
+			return err
+		}
+		return transactions.Delete([]byte(transID))
+	})
+}
+
+// MarkAttempt records a failed upload attempt. Entries marked as failed
+// are not retried until RetryFailed is called.
+func (s *Store) MarkAttempt(transID string, attemptErr error, failed bool) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(outboxBucket)
+		data := bucket.Get([]byte(transID))
+		if data == nil {
+			return nil
+		}
+
+		var entry OutboxEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+
+		entry.Attempts++
+		if attemptErr != nil {
+			entry.LastError = attemptErr.Error()
+		}
+		if failed {
+			entry.Status = StatusFailed
+		}
+		return putJSON(bucket, transID, entry)
+	})
+}
+
+// RetryFailed puts every failed outbox entry back in the pending state
+func (s *Store) RetryFailed() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(outboxBucket)
+		var retry []OutboxEntry
+		err := bucket.ForEach(func(k, v []byte) error {
+			var entry OutboxEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			if entry.Status == StatusFailed {
+				entry.Status = StatusPending
+				retry = append(retry, entry)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range retry {
+			if err := putJSON(bucket, entry.TransID, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PutShift stores a shift opened or closed on this terminal and marks it
+// for upload
+func (s *Store) PutShift(shift models.Shift) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(shiftsBucket)
+		local := localShift{}
+		if data := bucket.Get([]byte(shift.ShiftID)); data != nil {
+			if err := json.Unmarshal(data, &local); err != nil {
+				return err
+			}
+		} else {
+			local.Opened = true
+		}
+
+		local.Shift = shift
+		local.Version++
+		return putJSON(bucket, shift.ShiftID, local)
+	})
+}
+
+// MirrorShift stores a shift read from Firestore, unless this terminal
+// changed it since
+func (s *Store) MirrorShift(shift models.Shift) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(shiftsBucket)
+		local := localShift{}
+		if data := bucket.Get([]byte(shift.ShiftID)); data != nil {
+			if err := json.Unmarshal(data, &local); err != nil {
+				return err
+			}
+			if local.Synced != local.Version {
+				return nil
+			}
+		}
+
+		local.Shift = shift
+		local.Synced = local.Version
+		return putJSON(bucket, shift.ShiftID, local)
+	})
+}
+
+// Shift returns a shift stored on this terminal
+func (s *Store) Shift(shiftID string) (*models.Shift, error) {
+	var local localShift
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(shiftsBucket).Get([]byte(shiftID))
+		if data == nil {
+			return models.ErrShiftNotFound
+		}
+		return json.Unmarshal(data, &local)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &local.Shift, nil
+}
+
+// Shifts returns all shifts stored on this terminal
+func (s *Store) Shifts() ([]models.Shift, error) {
+	shifts := make([]models.Shift, 0)
+	err := s.forEachShift(func(local localShift) {
+		shifts = append(shifts, local.Shift)
+	})
+	return shifts, err
+}
+
+// OpenShift returns the open shift of terminalID, or models.ErrNoOpenShift
+func (s *Store) OpenShift(terminalID string) (*models.Shift, error) {
+	var open *models.Shift
+	err := s.forEachShift(func(local localShift) {
+		shift := local.Shift
+		if shift.TerminalID == terminalID && shift.IsOpen() &&
+			(open == nil || shift.OpenedAt.After(open.OpenedAt)) {
+			open = &shift
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if open == nil {
+		return nil, models.ErrNoOpenShift
+	}
+	return open, nil
+}
+
+// PendingShifts returns the shifts changed since they were last uploaded
+func (s *Store) PendingShifts() ([]PendingShift, error) {
+	pending := make([]PendingShift, 0)
+	err := s.forEachShift(func(local localShift) {
+		if local.Synced != local.Version {
+			pending = append(pending, PendingShift{Shift: local.Shift, Version: local.Version})
+		}
+	})
+	return pending, err
+}
+
+// MarkShiftSynced records that version of a shift was uploaded. Changes
+// made since stay pending.
+func (s *Store) MarkShiftSynced(shiftID string, version int) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(shiftsBucket)
+		data := bucket.Get([]byte(shiftID))
+		if data == nil {
+			return nil
+		}
+
+		var local localShift
+		if err := json.Unmarshal(data, &local); err != nil {
+			return err
+		}
+		if version > local.Synced {
+			local.Synced = version
+		}
+		if err := putJSON(bucket, shiftID, local); err != nil {
+			return err
+		}
+		if local.keepsSales() {
+			return nil
+		}
+
+		// The close reached Firestore, its uploaded sales are not needed
+		return pruneTransactions(tx)
+	})
+}
+
+// ShiftSales reports whether every sale of a shift is kept locally, which
+// holds for shifts opened on this terminal until their close is uploaded
+func (s *Store) ShiftSales(shiftID string) bool {
+	var local localShift
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(shiftsBucket).Get([]byte(shiftID))
+		if data == nil {
+			return models.ErrShiftNotFound
+		}
+		return json.Unmarshal(data, &local)
+	})
+	return err == nil && local.Opened && local.keepsSales()
+}
+
+// forEachShift calls fn with every stored shift
+func (s *Store) forEachShift(fn func(localShift)) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(shiftsBucket).ForEach(func(k, v []byte) error {
+			var local localShift
+			if err := json.Unmarshal(v, &local); err != nil {
+				return err
+			}
+			fn(local)
+			return nil
+		})
+	})
+}
+
+// PINFailures returns the wrong PINs counted for a user and when they may
+// try again
+func (s *Store) PINFailures(uid string) (count int, until time.Time, err error) {
+	var failures pinFailures
+	err = s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(pinFailuresBucket).Get([]byte(uid))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &failures)
+	})
+	return failures.Count, failures.Until, err
+}
+
+// PutPINFailures stores the wrong PINs counted for a user, or removes them
+// when there are none
+func (s *Store) PutPINFailures(uid string, count int, until time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(pinFailuresBucket)
+		if count == 0 && until.IsZero() {
+			return bucket.Delete([]byte(uid))
+		}
+		return putJSON(bucket, uid, pinFailures{Count: count, Until: until})
+	})
+}
+
+// keepsTransaction reports whether a transaction has to stay in the local
+// store after it was uploaded, because its shift is still open here
+func keepsTransaction(tx *bolt.Tx, transaction *models.Transaction) (bool, error) {
+	if transaction.ShiftID == "" {
+		return false, nil
+	}
+	data := tx.Bucket(shiftsBucket).Get([]byte(transaction.ShiftID))
+	if data == nil {
+		return false, nil
+	}
+	var local localShift
+	if err := json.Unmarshal(data, &local); err != nil {
+		return false, err
+	}
+	return local.keepsSales(), nil
+}
+
+// pruneTransactions drops every transaction that is neither waiting in the
+// outbox nor needed by its shift
+func pruneTransactions(tx *bolt.Tx) error {
+	transactions := tx.Bucket(transactionsBucket)
+	outbox := tx.Bucket(outboxBucket)
+
+	var prune [][]byte
+	err := transactions.ForEach(func(k, v []byte) error {
+		if outbox.Get(k) != nil {
+			return nil
+		}
+		var transaction models.Transaction
+		if err := json.Unmarshal(v, &transaction); err != nil {
+			return err
+		}
+		keep, err := keepsTransaction(tx, &transaction)
+		if err != nil || keep {
+			return err
+		}
+		prune = append(prune, append([]byte(nil), k...))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range prune {
+		if err := transactions.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pendingQuantities sums the item quantities of all transactions still
+// waiting in the outbox
+func pendingQuantities(tx *bolt.Tx) (map[string]int, error) {
+	quantities := make(map[string]int)
+	transactions := tx.Bucket(transactionsBucket)
+
+	err := tx.Bucket(outboxBucket).ForEach(func(k, v []byte) error {
+		var entry OutboxEntry
+		if err := json.Unmarshal(v, &entry); err != nil {
+			return err
+		}
+		if entry.Status != StatusPending {
+			return nil
+		}
+
+		data := transactions.Get(k)
+		if data == nil {
+			return nil
+		}
+		var transaction models.Transaction
+		if err := json.Unmarshal(data, &transaction); err != nil {
+			return err
+		}
+		for _, item := range transaction.Items {
+			quantities[item.ProductID] += item.Quantity
+		}
+		return nil
+	})
+
+	return quantities, err
+}
+
+// putJSON stores value as JSON under key
+func putJSON(bucket *bolt.Bucket, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(key), data)
+}
@@ -0,0 +1,179 @@
+package offline
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kasirnest/models"
+)
+
+// newTestStore opens a store in a temporary directory stocked with two
+// mirrored products
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := Open(filepath.Join(t.TempDir(), "local.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	err = store.ReplaceProducts([]models.Product{
+		{ProductID: "kopi", Name: "Kopi", Stock: 10},
+		{ProductID: "teh", Name: "Teh", Stock: 5},
+	})
+	if err != nil {
+		t.Fatalf("ReplaceProducts: %v", err)
+	}
+	return store
+}
+
+// sale builds a transaction selling quantity of productID
+func sale(id, shiftID, productID string, quantity int) *models.Transaction {
+	return &models.Transaction{
+		TransID: id,
+		ShiftID: shiftID,
+		Date:    time.Now(),
+		Items:   []models.TransactionItem{{ProductID: productID, Quantity: quantity}},
+	}
+}
+
+func stockOf(t *testing.T, store *Store, productID string) int {
+	t.Helper()
+	product, err := store.Product(productID)
+	if err != nil {
+		t.Fatalf("Product(%s): %v", productID, err)
+	}
+	return product.Stock
+}
+
+func TestMarkSyncedPrunesTransaction(t *testing.T) {
+	store := newTestStore(t)
+
+	if err := store.RecordSale(sale("t1", "", "kopi", 2)); err != nil {
+		t.Fatalf("RecordSale: %v", err)
+	}
+	if err := store.RecordSale(sale("t1", "", "kopi", 2)); !errors.Is(err, models.ErrAlreadyExists) {
+		t.Errorf("RecordSale twice = %v, want ErrAlreadyExists", err)
+	}
+	if err := store.RecordSale(sale("t1", "", "teh", 1)); !errors.Is(err, models.ErrTransactionConflict) {
+		t.Errorf("RecordSale of another sale with the same ID = %v, want ErrTransactionConflict", err)
+	}
+	if got := stockOf(t, store, "teh"); got != 5 {
+		t.Errorf("teh stock = %d, want 5", got)
+	}
+	if err := store.MarkSynced("t1"); err != nil {
+		t.Fatalf("MarkSynced: %v", err)
+	}
+
+	if _, err := store.Transaction("t1"); !errors.Is(err, models.ErrTransactionNotFound) {
+		t.Errorf("Transaction after sync = %v, want ErrTransactionNotFound", err)
+	}
+	if pending, _, _ := store.OutboxCounts(); pending != 0 {
+		t.Errorf("pending = %d, want 0", pending)
+	}
+}
+
+func TestShiftSalesKeptUntilCloseIsSynced(t *testing.T) {
+	store := newTestStore(t)
+
+	shift := models.Shift{ShiftID: "s1", TerminalID: "kasir-1", Status: models.ShiftOpen, OpenedAt: time.Now()}
+	if err := store.PutShift(shift); err != nil {
+		t.Fatalf("PutShift: %v", err)
+	}
+	if !store.ShiftSales("s1") {
+		t.Fatal("ShiftSales = false for a shift opened here")
+	}
+
+	if err := store.RecordSale(sale("t1", "s1", "kopi", 1)); err != nil {
+		t.Fatalf("RecordSale: %v", err)
+	}
+	if err := store.MarkSynced("t1"); err != nil {
+		t.Fatalf("MarkSynced: %v", err)
+	}
+	if err := store.RecordSynced(sale("t2", "s1", "teh", 2)); err != nil {
+		t.Fatalf("RecordSynced: %v", err)
+	}
+	for _, id := range []string{"t1", "t2"} {
+		if _, err := store.Transaction(id); err != nil {
+			t.Errorf("Transaction(%s) while shift open: %v", id, err)
+		}
+	}
+	if got := stockOf(t, store, "teh"); got != 3 {
+		t.Errorf("teh stock = %d, want 3", got)
+	}
+
+	shift.Status = models.ShiftClosed
+	shift.ClosedAt = time.Now()
+	if err := store.PutShift(shift); err != nil {
+		t.Fatalf("PutShift(closed): %v", err)
+	}
+	pending, err := store.PendingShifts()
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("PendingShifts = %v, %v", pending, err)
+	}
+	if _, err := store.Transaction("t1"); err != nil {
+		t.Errorf("Transaction before close synced: %v", err)
+	}
+
+	if err := store.MarkShiftSynced("s1", pending[0].Version); err != nil {
+		t.Fatalf("MarkShiftSynced: %v", err)
+	}
+	if store.ShiftSales("s1") {
+		t.Error("ShiftSales = true after the close was synced")
+	}
+	transactions, err := store.Transactions()
+	if err != nil || len(transactions) != 0 {
+		t.Errorf("Transactions after close synced = %d, %v, want none", len(transactions), err)
+	}
+}
+
+func TestMergeProductsKeepsMissingProducts(t *testing.T) {
+	store := newTestStore(t)
+
+	if err := store.RecordSale(sale("t1", "", "kopi", 3)); err != nil {
+		t.Fatalf("RecordSale: %v", err)
+	}
+	if err := store.MergeProducts([]models.Product{{ProductID: "kopi", Name: "Kopi", Stock: 8}}); err != nil {
+		t.Fatalf("MergeProducts: %v", err)
+	}
+
+	// The queued sale is still subtracted from the refreshed stock
+	if got := stockOf(t, store, "kopi"); got != 5 {
+		t.Errorf("kopi stock = %d, want 5", got)
+	}
+	if got := stockOf(t, store, "teh"); got != 5 {
+		t.Errorf("teh stock = %d, want 5", got)
+	}
+}
+
+func TestPINFailuresSurviveReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "local.db")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	until := time.Now().Add(time.Minute).Round(0)
+	if err := store.PutPINFailures("u1", 3, until); err != nil {
+		t.Fatalf("PutPINFailures: %v", err)
+	}
+	store.Close()
+
+	store, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open again: %v", err)
+	}
+	defer store.Close()
+	count, got, err := store.PINFailures("u1")
+	if err != nil || count != 3 || !got.Equal(until) {
+		t.Errorf("PINFailures = %d, %v, %v, want 3, %v", count, got, err, until)
+	}
+
+	if err := store.PutPINFailures("u1", 0, time.Time{}); err != nil {
+		t.Fatalf("PutPINFailures(reset): %v", err)
+	}
+	if count, got, err := store.PINFailures("u1"); err != nil || count != 0 || !got.IsZero() {
+		t.Errorf("PINFailures after reset = %d, %v, %v", count, got, err)
+	}
+}
@@ -0,0 +1,283 @@
+package offline
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"kasirnest/models"
+	"kasirnest/repository"
+)
+
+// SyncStatus describes the state of the outbox queue
+type SyncStatus struct {
+	Pending   int
+	Failed    int
+	Online    bool
+	LastSync  time.Time
+	LastError string
+}
+
+// Syncer pushes queued transactions and shifts to Firestore in the
+// background and keeps the local product mirror up to date while online
+type Syncer struct {
+	store    *Store
+	remote   *repository.Repositories
+	interval time.Duration
+
+	// ctx is cancelled by Stop, aborting any upload in progress
+	ctx     context.Context
+	cancel  context.CancelFunc
+	trigger chan struct{}
+	done    chan struct{}
+
+	mu           sync.Mutex
+	status       SyncStatus
+	listeners    map[int]func(SyncStatus)
+	nextListener int
+}
+
+// NewSyncer creates a syncer that runs every interval and whenever triggered
+func NewSyncer(store *Store, remote *repository.Repositories, interval time.Duration) *Syncer {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Syncer{
+		store:     store,
+		remote:    remote,
+		interval:  interval,
+		ctx:       ctx,
+		cancel:    cancel,
+		trigger:   make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		listeners: make(map[int]func(SyncStatus)),
+	}
+}
+
+// Start starts the background sync loop
+func (s *Syncer) Start() {
+	go s.run()
+	s.Trigger()
+}
+
+// Stop stops the background sync loop and waits for it to finish
+func (s *Syncer) Stop() {
+	s.cancel()
+	<-s.done
+}
+
+// Trigger asks the sync loop to run as soon as possible
+func (s *Syncer) Trigger() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Status returns the current sync status
+func (s *Syncer) Status() SyncStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Offline reports whether the last sync run could not reach Firestore
+func (s *Syncer) Offline() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.status.Online && s.status.LastError != ""
+}
+
+// OnStatusChange registers a callback for sync status updates and returns
+// a function that removes it. Callbacks run on the sync goroutine.
+func (s *Syncer) OnStatusChange(callback func(SyncStatus)) func() {
+	s.mu.Lock()
+	id := s.nextListener
+	s.nextListener++
+	s.listeners[id] = callback
+	status := s.status
+	s.mu.Unlock()
+
+	callback(status)
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.listeners, id)
+	}
+}
+
+// RetryFailed requeues failed transactions and triggers a sync
+func (s *Syncer) RetryFailed() error {
+	if err := s.store.RetryFailed(); err != nil {
+		return err
+	}
+	s.Trigger()
+	return nil
+}
+
+// run is the sync loop
+func (s *Syncer) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.trigger:
+		}
+
+		s.syncOnce()
+	}
+}
+
+// syncOnce pushes pending transactions and refreshes the product mirror
+func (s *Syncer) syncOnce() {
+	online := true
+	var lastErr error
+
+	entries, err := s.store.Outbox()
+	if err != nil {
+		log.Printf("Failed to read sync outbox: %v", err)
+		lastErr = err
+	}
+
+	for _, entry := range entries {
+		if entry.Status != StatusPending {
+			continue
+		}
+
+		pushErr := s.push(entry.TransID)
+		if s.ctx.Err() != nil {
+			// Stopped mid-upload, the entry stays pending
+			return
+		}
+		if pushErr == nil {
+			if err := s.store.MarkSynced(entry.TransID); err != nil {
+				log.Printf("Failed to mark transaction %s as synced: %v", entry.TransID, err)
+			}
+			continue
+		}
+
+		lastErr = pushErr
+		permanent := isPermanent(pushErr)
+		if err := s.store.MarkAttempt(entry.TransID, pushErr, permanent); err != nil {
+			log.Printf("Failed to record sync attempt for %s: %v", entry.TransID, err)
+		}
+
+		if !permanent {
+			// Most likely offline, try the rest on the next run
+			online = false
+			break
+		}
+		log.Printf("Transaction %s could not be synced: %v", entry.TransID, pushErr)
+	}
+
+	if online {
+		if err := s.pushShifts(); err != nil {
+			online = false
+			lastErr = err
+		}
+	}
+
+	if online {
+		if products, err := s.remote.Products.List(s.ctx); err == nil || repository.IsPartial(err) {
+			if err := mirrorProducts(s.store, products, err); err != nil {
+				log.Printf("Failed to update local product mirror: %v", err)
+			}
+		} else {
+			online = false
+			lastErr = err
+		}
+	}
+
+	pending, failed, err := s.store.OutboxCounts()
+	if err != nil {
+		log.Printf("Failed to count sync outbox: %v", err)
+	}
+
+	s.mu.Lock()
+	s.status.Pending = pending
+	s.status.Failed = failed
+	s.status.Online = online
+	if online {
+		s.status.LastSync = time.Now()
+	}
+	s.status.LastError = ""
+	if lastErr != nil {
+		s.status.LastError = lastErr.Error()
+	}
+	status := s.status
+	listeners := make([]func(SyncStatus), 0, len(s.listeners))
+	for _, listener := range s.listeners {
+		listeners = append(listeners, listener)
+	}
+	s.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(status)
+	}
+}
+
+// push uploads a single queued transaction
+func (s *Syncer) push(transID string) error {
+	transaction, err := s.store.Transaction(transID)
+	if err != nil {
+		return err
+	}
+
+	err = s.remote.Transactions.Checkout(s.ctx, transaction)
+	if errors.Is(err, models.ErrAlreadyExists) {
+		// Firestore holds this very sale, an earlier attempt succeeded
+		// but its response was lost
+		log.Printf("Transaction %s was already uploaded", transID)
+		return nil
+	}
+	return err
+}
+
+// pushShifts uploads the shifts opened or closed on this terminal since
+// they were last uploaded
+func (s *Syncer) pushShifts() error {
+	pending, err := s.store.PendingShifts()
+	if err != nil {
+		return err
+	}
+
+	for i := range pending {
+		shift := &pending[i].Shift
+		if err := s.remote.Shifts.Save(s.ctx, shift); err != nil {
+			return err
+		}
+		if err := s.store.MarkShiftSynced(shift.ShiftID, pending[i].Version); err != nil {
+			log.Printf("Failed to mark shift %s as synced: %v", shift.ShiftID, err)
+		}
+	}
+	return nil
+}
+
+// mirrorProducts updates the local mirror with products read from
+// Firestore. A partial result only updates the products it contains, the
+// missing ones must not disappear from the terminal.
+func mirrorProducts(store *Store, products []models.Product, err error) error {
+	if err != nil {
+		return store.MergeProducts(products)
+	}
+	return store.ReplaceProducts(products)
+}
+
+// isPermanent reports whether retrying the upload cannot succeed
+func isPermanent(err error) bool {
+	return errors.Is(err, models.ErrInsufficientStock) ||
+		errors.Is(err, models.ErrProductNotFound) ||
+		errors.Is(err, models.ErrInvalidQuantity) ||
+		errors.Is(err, models.ErrTransactionNotFound) ||
+		errors.Is(err, models.ErrTransactionConflict)
+}
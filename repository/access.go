@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"kasirnest/models"
+)
+
+// WithAccess returns repositories that act for user, refusing every call
+// the user's role does not permit with an error wrapping
+// models.ErrUnauthorized. The UI hides what a role cannot do, this keeps
+// the data safe when it does not.
+func WithAccess(repos *Repositories, user *models.User) *Repositories {
+	return &Repositories{
+		Products:     &accessProductRepository{ProductRepository: repos.Products, user: user},
+		Transactions: &accessTransactionRepository{TransactionRepository: repos.Transactions, user: user},
+		Users:        &accessUserRepository{UserRepository: repos.Users, user: user},
+		Categories:   &accessCategoryRepository{CategoryRepository: repos.Categories, user: user},
+		Shifts:       &accessShiftRepository{ShiftRepository: repos.Shifts, user: user},
+	}
+}
+
+// accessProductRepository checks permissions before product calls
+type accessProductRepository struct {
+	ProductRepository
+	user *models.User
+}
+
+func (r *accessProductRepository) Get(ctx context.Context, productID string) (*models.Product, error) {
+	if err := r.user.Require(models.PermProductView); err != nil {
+		return nil, err
+	}
+	return r.ProductRepository.Get(ctx, productID)
+}
+
+func (r *accessProductRepository) List(ctx context.Context) ([]models.Product, error) {
+	if err := r.user.Require(models.PermProductView); err != nil {
+		return nil, err
+	}
+	return r.ProductRepository.List(ctx)
+}
+
+func (r *accessProductRepository) Create(ctx context.Context, product *models.Product) error {
+	if err := r.user.Require(models.PermProductEdit); err != nil {
+		return err
+	}
+	return r.ProductRepository.Create(ctx, product)
+}
+
+func (r *accessProductRepository) Update(ctx context.Context, product *models.Product) error {
+	if err := r.user.Require(models.PermProductEdit); err != nil {
+		return err
+	}
+	return r.ProductRepository.Update(ctx, product)
+}
+
+func (r *accessProductRepository) Delete(ctx context.Context, productID string) error {
+	if err := r.user.Require(models.PermProductDelete); err != nil {
+		return err
+	}
+	return r.ProductRepository.Delete(ctx, productID)
+}
+
+func (r *accessProductRepository) Watch(ctx context.Context, onChange func([]models.Product, error)) (func(), error) {
+	if err := r.user.Require(models.PermProductView); err != nil {
+		return nil, err
+	}
+	return r.ProductRepository.Watch(ctx, onChange)
+}
+
+// accessTransactionRepository checks permissions before transaction calls.
+// Totals over all transactions are reports.
+type accessTransactionRepository struct {
+	TransactionRepository
+	user *models.User
+}
+
+func (r *accessTransactionRepository) Get(ctx context.Context, transID string) (*models.Transaction, error) {
+	if err := r.user.Require(models.PermTransactionView); err != nil {
+		return nil, err
+	}
+	return r.TransactionRepository.Get(ctx, transID)
+}
+
+func (r *accessTransactionRepository) List(ctx context.Context, query TransactionQuery) (*TransactionPage, error) {
+	if err := r.user.Require(models.PermTransactionView); err != nil {
+		return nil, err
+	}
+	return r.TransactionRepository.List(ctx, query)
+}
+
+func (r *accessTransactionRepository) Checkout(ctx context.Context, transaction *models.Transaction) error {
+	if err := r.user.Require(models.PermTransactionCreate); err != nil {
+		return err
+	}
+	return r.TransactionRepository.Checkout(ctx, transaction)
+}
+
+func (r *accessTransactionRepository) Count(ctx context.Context) (int, error) {
+	if err := r.user.Require(models.PermReportView); err != nil {
+		return 0, err
+	}
+	return r.TransactionRepository.Count(ctx)
+}
+
+func (r *accessTransactionRepository) Summary(ctx context.Context, from, to time.Time) (*SalesSummary, error) {
+	if err := r.user.Require(models.PermReportView); err != nil {
+		return nil, err
+	}
+	return r.TransactionRepository.Summary(ctx, from, to)
+}
+
+// accessUserRepository lets users read their own profile and only user
+// managers touch the others
+type accessUserRepository struct {
+	UserRepository
+	user *models.User
+}
+
+func (r *accessUserRepository) Get(ctx context.Context, userID string) (*models.User, error) {
+	if r.user == nil || userID != r.user.UserID {
+		if err := r.user.Require(models.PermUserManage); err != nil {
+			return nil, err
+		}
+	}
+	return r.UserRepository.Get(ctx, userID)
+}
+
+func (r *accessUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	if r.user == nil || email != r.user.Email {
+		if err := r.user.Require(models.PermUserManage); err != nil {
+			return nil, err
+		}
+	}
+	return r.UserRepository.GetByEmail(ctx, email)
+}
+
+func (r *accessUserRepository) List(ctx context.Context) ([]models.User, error) {
+	if err := r.user.Require(models.PermUserManage); err != nil {
+		return nil, err
+	}
+	return r.UserRepository.List(ctx)
+}
+
+func (r *accessUserRepository) Save(ctx context.Context, user *models.User) error {
+	if err := r.user.Require(models.PermUserManage); err != nil {
+		return err
+	}
+	return r.UserRepository.Save(ctx, user)
+}
+
+func (r *accessUserRepository) Delete(ctx context.Context, userID string) error {
+	if err := r.user.Require(models.PermUserManage); err != nil {
+		return err
+	}
+	return r.UserRepository.Delete(ctx, userID)
+}
+
+// accessCategoryRepository checks permissions before category calls
+type accessCategoryRepository struct {
+	CategoryRepository
+	user *models.User
+}
+
+func (r *accessCategoryRepository) Save(ctx context.Context, category *models.Category) error {
+	if err := r.user.Require(models.PermProductEdit); err != nil {
+		return err
+	}
+	return r.CategoryRepository.Save(ctx, category)
+}
+
+func (r *accessCategoryRepository) Delete(ctx context.Context, categoryID string) error {
+	if err := r.user.Require(models.PermProductEdit); err != nil {
+		return err
+	}
+	return r.CategoryRepository.Delete(ctx, categoryID)
+}
+
+// accessShiftRepository checks permissions before shift calls. Cashiers who
+// sell run their shifts; past shifts of every terminal are reports.
+type accessShiftRepository struct {
+	ShiftRepository
+	user *models.User
+}
+
+func (r *accessShiftRepository) Get(ctx context.Context, shiftID string) (*models.Shift, error) {
+	if err := r.user.Require(models.PermTransactionCreate); err != nil {
+		return nil, err
+	}
+	return r.ShiftRepository.Get(ctx, shiftID)
+}
+
+func (r *accessShiftRepository) Current(ctx context.Context, terminalID string) (*models.Shift, error) {
+	if err := r.user.Require(models.PermTransactionCreate); err != nil {
+		return nil, err
+	}
+	return r.ShiftRepository.Current(ctx, terminalID)
+}
+
+func (r *accessShiftRepository) Save(ctx context.Context, shift *models.Shift) error {
+	if err := r.user.Require(models.PermTransactionCreate); err != nil {
+		return err
+	}
+	return r.ShiftRepository.Save(ctx, shift)
+}
+
+func (r *accessShiftRepository) List(ctx context.Context, from, to time.Time) ([]models.Shift, error) {
+	if err := r.user.Require(models.PermReportView); err != nil {
+		return nil, err
+	}
+	return r.ShiftRepository.List(ctx, from, to)
+}
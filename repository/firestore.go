@@ -0,0 +1,265 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"kasirnest/firebase"
+	"kasirnest/models"
+)
+
+// NewFirestoreRepositories creates repositories backed by Firestore
+func NewFirestoreRepositories(client *firebase.Client) *Repositories {
+	firestoreService := firebase.NewFirestoreService(client)
+
+	return &Repositories{
+		Products: &firestoreProductRepository{
+			service:    firestoreService,
+			collection: firebase.NewCollection[models.Product](client, ProductsCollection),
+		},
+		Transactions: &firestoreTransactionRepository{
+			service:    firestoreService,
+			collection: firebase.NewCollection[models.Transaction](client, TransactionsCollection),
+			checkout:   firebase.NewCheckoutService(client),
+		},
+		Users: &firestoreUserRepository{
+			service:    firestoreService,
+			collection: firebase.NewCollection[models.User](client, UsersCollection),
+		},
+		Categories: &firestoreCategoryRepository{
+			service:    firestoreService,
+			collection: firebase.NewCollection[models.Category](client, CategoriesCollection),
+		},
+		Shifts: &firestoreShiftRepository{
+			service:    firestoreService,
+			collection: firebase.NewCollection[models.Shift](client, ShiftsCollection),
+		},
+	}
+}
+
+// notFound maps a Firestore NotFound error to the given domain error and
+// other backend failures to the matching errors in package models
+func notFound(err, domainErr error) error {
+	return firebase.ClassifyError(err, domainErr)
+}
+
+// firestoreProductRepository implements ProductRepository on Firestore
+type firestoreProductRepository struct {
+	service    *firebase.FirestoreService
+	collection *firebase.Collection[models.Product]
+}
+
+func (r *firestoreProductRepository) Get(ctx context.Context, productID string) (*models.Product, error) {
+	product, err := r.collection.Get(ctx, productID)
+	if err != nil {
+		return nil, notFound(err, models.ErrProductNotFound)
+	}
+	return product, nil
+}
+
+func (r *firestoreProductRepository) List(ctx context.Context) ([]models.Product, error) {
+	return r.collection.List(ctx)
+}
+
+func (r *firestoreProductRepository) Create(ctx context.Context, product *models.Product) error {
+	return r.service.Create(ctx, ProductsCollection, product.ProductID, *product)
+}
+
+func (r *firestoreProductRepository) Update(ctx context.Context, product *models.Product) error {
+	return r.service.Update(ctx, ProductsCollection, product.ProductID, *product)
+}
+
+func (r *firestoreProductRepository) Delete(ctx context.Context, productID string) error {
+	return r.service.Delete(ctx, ProductsCollection, productID)
+}
+
+func (r *firestoreProductRepository) Count(ctx context.Context) (int, error) {
+	return r.service.GetCollectionSize(ctx, ProductsCollection)
+}
+
+func (r *firestoreProductRepository) CountLowStock(ctx context.Context, threshold int) (int, error) {
+	return r.service.Count(ctx, ProductsCollection, []firebase.QueryFilter{
+		{Field: "stock", Operator: "<=", Value: threshold},
+	})
+}
+
+func (r *firestoreProductRepository) Watch(ctx context.Context, onChange func([]models.Product, error)) (func(), error) {
+	listener, err := r.collection.Listen(ctx, onChange)
+	if err != nil {
+		return nil, err
+	}
+	return listener.Stop, nil
+}
+
+// firestoreTransactionRepository implements TransactionRepository on Firestore
+type firestoreTransactionRepository struct {
+	service    *firebase.FirestoreService
+	collection *firebase.Collection[models.Transaction]
+	checkout   *firebase.CheckoutService
+}
+
+func (r *firestoreTransactionRepository) Get(ctx context.Context, transID string) (*models.Transaction, error) {
+	transaction, err := r.collection.Get(ctx, transID)
+	if err != nil {
+		return nil, notFound(err, models.ErrTransactionNotFound)
+	}
+	return transaction, nil
+}
+
+func (r *firestoreTransactionRepository) List(ctx context.Context, query TransactionQuery) (*TransactionPage, error) {
+	spec := firebase.QuerySpec{
+		OrderBy:   []firebase.OrderBy{{Field: "date", Descending: true}},
+		Limit:     query.Limit,
+		PageToken: query.PageToken,
+	}
+	if !query.From.IsZero() {
+		spec.Filters = append(spec.Filters, firebase.QueryFilter{Field: "date", Operator: ">=", Value: query.From})
+	}
+	if !query.To.IsZero() {
+		spec.Filters = append(spec.Filters, firebase.QueryFilter{Field: "date", Operator: "<", Value: query.To})
+	}
+	if query.ShiftID != "" {
+		spec.Filters = append(spec.Filters, firebase.QueryFilter{Field: "shift_id", Operator: "==", Value: query.ShiftID})
+	}
+
+	page, err := r.collection.Find(ctx, spec)
+	if page == nil {
+		return nil, err
+	}
+
+	return &TransactionPage{
+		Transactions:  page.Items,
+		NextPageToken: page.NextPageToken,
+	}, err
+}
+
+func (r *firestoreTransactionRepository) Checkout(ctx context.Context, transaction *models.Transaction) error {
+	return r.checkout.Checkout(ctx, transaction)
+}
+
+func (r *firestoreTransactionRepository) Count(ctx context.Context) (int, error) {
+	return r.service.GetCollectionSize(ctx, TransactionsCollection)
+}
+
+func (r *firestoreTransactionRepository) Summary(ctx context.Context, from, to time.Time) (*SalesSummary, error) {
+	result, err := r.service.Aggregate(ctx, TransactionsCollection, []firebase.QueryFilter{
+		{Field: "date", Operator: ">=", Value: from},
+		{Field: "date", Operator: "<", Value: to},
+	}, "total")
+	if err != nil {
+		return nil, err
+	}
+	return &SalesSummary{Count: result.Count, Total: result.Sums["total"]}, nil
+}
+
+// firestoreUserRepository implements UserRepository on Firestore
+type firestoreUserRepository struct {
+	service    *firebase.FirestoreService
+	collection *firebase.Collection[models.User]
+}
+
+func (r *firestoreUserRepository) Get(ctx context.Context, userID string) (*models.User, error) {
+	user, err := r.collection.Get(ctx, userID)
+	if err != nil {
+		return nil, notFound(err, models.ErrUserNotFound)
+	}
+	return user, nil
+}
+
+func (r *firestoreUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	users, err := r.collection.Query(ctx, []firebase.QueryFilter{
+		{Field: "email", Operator: "==", Value: email},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, models.ErrUserNotFound
+	}
+	return &users[0], nil
+}
+
+func (r *firestoreUserRepository) List(ctx context.Context) ([]models.User, error) {
+	return r.collection.List(ctx)
+}
+
+func (r *firestoreUserRepository) Save(ctx context.Context, user *models.User) error {
+	return r.service.Create(ctx, UsersCollection, user.UserID, *user)
+}
+
+func (r *firestoreUserRepository) Delete(ctx context.Context, userID string) error {
+	return r.service.Delete(ctx, UsersCollection, userID)
+}
+
+// firestoreCategoryRepository implements CategoryRepository on Firestore
+type firestoreCategoryRepository struct {
+	service    *firebase.FirestoreService
+	collection *firebase.Collection[models.Category]
+}
+
+func (r *firestoreCategoryRepository) Get(ctx context.Context, categoryID string) (*models.Category, error) {
+	category, err := r.collection.Get(ctx, categoryID)
+	if err != nil {
+		return nil, notFound(err, models.ErrCategoryNotFound)
+	}
+	return category, nil
+}
+
+func (r *firestoreCategoryRepository) List(ctx context.Context) ([]models.Category, error) {
+	return r.collection.List(ctx)
+}
+
+func (r *firestoreCategoryRepository) Save(ctx context.Context, category *models.Category) error {
+	return r.service.Create(ctx, CategoriesCollection, category.CategoryID, *category)
+}
+
+func (r *firestoreCategoryRepository) Delete(ctx context.Context, categoryID string) error {
+	return r.service.Delete(ctx, CategoriesCollection, categoryID)
+}
+
+// firestoreShiftRepository implements ShiftRepository on Firestore
+type firestoreShiftRepository struct {
+	service    *firebase.FirestoreService
+	collection *firebase.Collection[models.Shift]
+}
+
+func (r *firestoreShiftRepository) Get(ctx context.Context, shiftID string) (*models.Shift, error) {
+	shift, err := r.collection.Get(ctx, shiftID)
+	if err != nil {
+		return nil, notFound(err, models.ErrShiftNotFound)
+	}
+	return shift, nil
+}
+
+func (r *firestoreShiftRepository) Current(ctx context.Context, terminalID string) (*models.Shift, error) {
+	shifts, err := r.collection.Query(ctx, []firebase.QueryFilter{
+		{Field: "terminal_id", Operator: "==", Value: terminalID},
+		{Field: "status", Operator: "==", Value: models.ShiftOpen},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(shifts) == 0 {
+		return nil, models.ErrNoOpenShift
+	}
+	SortShifts(shifts)
+	return &shifts[0], nil
+}
+
+func (r *firestoreShiftRepository) Save(ctx context.Context, shift *models.Shift) error {
+	return r.service.Create(ctx, ShiftsCollection, shift.ShiftID, *shift)
+}
+
+func (r *firestoreShiftRepository) List(ctx context.Context, from, to time.Time) ([]models.Shift, error) {
+	page, err := r.collection.Find(ctx, firebase.QuerySpec{
+		Filters: []firebase.QueryFilter{
+			{Field: "opened_at", Operator: ">=", Value: from},
+			{Field: "opened_at", Operator: "<", Value: to},
+		},
+		OrderBy: []firebase.OrderBy{{Field: "opened_at", Descending: true}},
+	})
+	if page == nil {
+		return nil, err
+	}
+	return page.Items, err
+}
@@ -0,0 +1,470 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"kasirnest/models"
+)
+
+// memoryStore holds the data shared by the in-memory repositories.
+// A single lock guards every collection so Checkout can update products
+// and transactions atomically.
+type memoryStore struct {
+	mu           sync.RWMutex
+	products     map[string]models.Product
+	transactions map[string]models.Transaction
+	users        map[string]models.User
+	categories   map[string]models.Category
+	shifts       map[string]models.Shift
+
+	watchers    map[int]func([]models.Product, error)
+	nextWatcher int
+}
+
+// NewMemoryRepositories creates thread-safe repositories that keep all data
+// in memory, for tests and running without Firebase
+func NewMemoryRepositories() *Repositories {
+	store := &memoryStore{
+		products:     make(map[string]models.Product),
+		transactions: make(map[string]models.Transaction),
+		users:        make(map[string]models.User),
+		categories:   make(map[string]models.Category),
+		shifts:       make(map[string]models.Shift),
+		watchers:     make(map[int]func([]models.Product, error)),
+	}
+
+	return &Repositories{
+		Products:     &memoryProductRepository{store: store},
+		Transactions: &memoryTransactionRepository{store: store},
+		Users:        &memoryUserRepository{store: store},
+		Categories:   &memoryCategoryRepository{store: store},
+		Shifts:       &memoryShiftRepository{store: store},
+	}
+}
+
+// sortedProducts returns every product ordered by ID.
+// The caller must hold the lock.
+func (s *memoryStore) sortedProducts() []models.Product {
+	products := make([]models.Product, 0, len(s.products))
+	for _, product := range s.products {
+		products = append(products, product)
+	}
+	sort.Slice(products, func(i, j int) bool {
+		return products[i].ProductID < products[j].ProductID
+	})
+	return products
+}
+
+// notifyProducts sends the current products to every watcher.
+// The caller must not hold the lock.
+func (s *memoryStore) notifyProducts() {
+	s.mu.RLock()
+	products := s.sortedProducts()
+	watchers := make([]func([]models.Product, error), 0, len(s.watchers))
+	for _, watcher := range s.watchers {
+		watchers = append(watchers, watcher)
+	}
+	s.mu.RUnlock()
+
+	for _, watcher := range watchers {
+		watcher(append([]models.Product(nil), products...), nil)
+	}
+}
+
+// copyShift returns a shift that shares no slices with s
+func copyShift(s models.Shift) models.Shift {
+	s.CashCounts = append([]models.CashCount(nil), s.CashCounts...)
+	s.Payments = append([]models.PaymentTotal(nil), s.Payments...)
+	return s
+}
+
+// copyTransaction returns a transaction that shares no slices with t
+func copyTransaction(t models.Transaction) models.Transaction {
+	t.Items = append([]models.TransactionItem(nil), t.Items...)
+	return t
+}
+
+// memoryProductRepository implements ProductRepository in memory
+type memoryProductRepository struct {
+	store *memoryStore
+}
+
+func (r *memoryProductRepository) Get(ctx context.Context, productID string) (*models.Product, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	product, exists := r.store.products[productID]
+	if !exists {
+		return nil, models.ErrProductNotFound
+	}
+	return &product, nil
+}
+
+func (r *memoryProductRepository) List(ctx context.Context) ([]models.Product, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return r.store.sortedProducts(), nil
+}
+
+func (r *memoryProductRepository) Create(ctx context.Context, product *models.Product) error {
+	if product.ProductID == "" {
+		return errors.New("product ID is required")
+	}
+
+	r.store.mu.Lock()
+	r.store.products[product.ProductID] = *product
+	r.store.mu.Unlock()
+
+	r.store.notifyProducts()
+	return nil
+}
+
+func (r *memoryProductRepository) Update(ctx context.Context, product *models.Product) error {
+	r.store.mu.Lock()
+	if _, exists := r.store.products[product.ProductID]; !exists {
+		r.store.mu.Unlock()
+		return models.ErrProductNotFound
+	}
+	r.store.products[product.ProductID] = *product
+	r.store.mu.Unlock()
+
+	r.store.notifyProducts()
+	return nil
+}
+
+func (r *memoryProductRepository) Delete(ctx context.Context, productID string) error {
+	r.store.mu.Lock()
+	delete(r.store.products, productID)
+	r.store.mu.Unlock()
+
+	r.store.notifyProducts()
+	return nil
+}
+
+func (r *memoryProductRepository) Count(ctx context.Context) (int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return len(r.store.products), nil
+}
+
+func (r *memoryProductRepository) CountLowStock(ctx context.Context, threshold int) (int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	count := 0
+	for _, product := range r.store.products {
+		if product.Stock <= threshold {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryProductRepository) Watch(ctx context.Context, onChange func([]models.Product, error)) (func(), error) {
+	r.store.mu.Lock()
+	id := r.store.nextWatcher
+	r.store.nextWatcher++
+	r.store.watchers[id] = onChange
+	products := r.store.sortedProducts()
+	r.store.mu.Unlock()
+
+	onChange(products, nil)
+
+	return func() {
+		r.store.mu.Lock()
+		delete(r.store.watchers, id)
+		r.store.mu.Unlock()
+	}, nil
+}
+
+// memoryTransactionRepository implements TransactionRepository in memory
+type memoryTransactionRepository struct {
+	store *memoryStore
+}
+
+func (r *memoryTransactionRepository) Get(ctx context.Context, transID string) (*models.Transaction, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	transaction, exists := r.store.transactions[transID]
+	if !exists {
+		return nil, models.ErrTransactionNotFound
+	}
+	transaction = copyTransaction(transaction)
+	return &transaction, nil
+}
+
+func (r *memoryTransactionRepository) List(ctx context.Context, query TransactionQuery) (*TransactionPage, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	transactions := make([]models.Transaction, 0, len(r.store.transactions))
+	for _, transaction := range r.store.transactions {
+		transactions = append(transactions, copyTransaction(transaction))
+	}
+
+	return PageTransactions(transactions, query)
+}
+
+func (r *memoryTransactionRepository) Checkout(ctx context.Context, transaction *models.Transaction) error {
+	if err := r.checkout(transaction); err != nil {
+		return err
+	}
+
+	r.store.notifyProducts()
+	return nil
+}
+
+// checkout applies the sale under the store lock
+func (r *memoryTransactionRepository) checkout(transaction *models.Transaction) error {
+	if transaction == nil || len(transaction.Items) == 0 {
+		return models.ErrInvalidQuantity
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if stored, exists := r.store.transactions[transaction.TransID]; exists {
+		if !stored.SameSale(transaction) {
+			return models.ErrTransactionConflict
+		}
+		return models.ErrAlreadyExists
+	}
+
+	// Sum quantities per product, the cart may list a product more than once
+	quantities := make(map[string]int)
+	var productIDs []string
+	for _, item := range transaction.Items {
+		if item.Quantity <= 0 {
+			return models.ErrInvalidQuantity
+		}
+		if _, exists := quantities[item.ProductID]; !exists {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		quantities[item.ProductID] += item.Quantity
+	}
+
+	var insufficient []string
+	for _, productID := range productIDs {
+		product, exists := r.store.products[productID]
+		if !exists {
+			return models.ErrProductNotFound
+		}
+		if !product.CanSell(quantities[productID]) {
+			insufficient = append(insufficient, productID)
+		}
+	}
+
+	if len(insufficient) > 0 {
+		return &models.StockError{ProductIDs: insufficient}
+	}
+
+	for _, productID := range productIDs {
+		product := r.store.products[productID]
+		if err := product.UpdateStock(quantities[productID]); err != nil {
+			return err
+		}
+		r.store.products[productID] = product
+	}
+
+	r.store.transactions[transaction.TransID] = copyTransaction(*transaction)
+	return nil
+}
+
+func (r *memoryTransactionRepository) Count(ctx context.Context) (int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return len(r.store.transactions), nil
+}
+
+func (r *memoryTransactionRepository) Summary(ctx context.Context, from, to time.Time) (*SalesSummary, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	transactions := make([]models.Transaction, 0, len(r.store.transactions))
+	for _, transaction := range r.store.transactions {
+		transactions = append(transactions, transaction)
+	}
+	return SummarizeTransactions(transactions, from, to), nil
+}
+
+// memoryUserRepository implements UserRepository in memory
+type memoryUserRepository struct {
+	store *memoryStore
+}
+
+func (r *memoryUserRepository) Get(ctx context.Context, userID string) (*models.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	user, exists := r.store.users[userID]
+	if !exists {
+		return nil, models.ErrUserNotFound
+	}
+	return &user, nil
+}
+
+func (r *memoryUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, user := range r.store.users {
+		if strings.EqualFold(user.Email, email) {
+			return &user, nil
+		}
+	}
+	return nil, models.ErrUserNotFound
+}
+
+func (r *memoryUserRepository) List(ctx context.Context) ([]models.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	users := make([]models.User, 0, len(r.store.users))
+	for _, user := range r.store.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].UserID < users[j].UserID
+	})
+	return users, nil
+}
+
+func (r *memoryUserRepository) Save(ctx context.Context, user *models.User) error {
+	if user.UserID == "" {
+		return models.ErrInvalidUser
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.users[user.UserID] = *user
+	return nil
+}
+
+func (r *memoryUserRepository) Delete(ctx context.Context, userID string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	delete(r.store.users, userID)
+	return nil
+}
+
+// memoryCategoryRepository implements CategoryRepository in memory
+type memoryCategoryRepository struct {
+	store *memoryStore
+}
+
+func (r *memoryCategoryRepository) Get(ctx context.Context, categoryID string) (*models.Category, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	category, exists := r.store.categories[categoryID]
+	if !exists {
+		return nil, models.ErrCategoryNotFound
+	}
+	return &category, nil
+}
+
+func (r *memoryCategoryRepository) List(ctx context.Context) ([]models.Category, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	categories := make([]models.Category, 0, len(r.store.categories))
+	for _, category := range r.store.categories {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		return categories[i].CategoryID < categories[j].CategoryID
+	})
+	return categories, nil
+}
+
+func (r *memoryCategoryRepository) Save(ctx context.Context, category *models.Category) error {
+	if category.CategoryID == "" {
+		return errors.New("category ID is required")
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.categories[category.CategoryID] = *category
+	return nil
+}
+
+func (r *memoryCategoryRepository) Delete(ctx context.Context, categoryID string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	delete(r.store.categories, categoryID)
+	return nil
+}
+
+// memoryShiftRepository implements ShiftRepository in memory
+type memoryShiftRepository struct {
+	store *memoryStore
+}
+
+func (r *memoryShiftRepository) Get(ctx context.Context, shiftID string) (*models.Shift, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	shift, exists := r.store.shifts[shiftID]
+	if !exists {
+		return nil, models.ErrShiftNotFound
+	}
+	shift = copyShift(shift)
+	return &shift, nil
+}
+
+func (r *memoryShiftRepository) Current(ctx context.Context, terminalID string) (*models.Shift, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	open := make([]models.Shift, 0, 1)
+	for _, shift := range r.store.shifts {
+		if shift.TerminalID == terminalID && shift.IsOpen() {
+			open = append(open, copyShift(shift))
+		}
+	}
+	if len(open) == 0 {
+		return nil, models.ErrNoOpenShift
+	}
+	SortShifts(open)
+	return &open[0], nil
+}
+
+func (r *memoryShiftRepository) Save(ctx context.Context, shift *models.Shift) error {
+	if shift.ShiftID == "" {
+		return errors.New("shift ID is required")
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.shifts[shift.ShiftID] = copyShift(*shift)
+	return nil
+}
+
+func (r *memoryShiftRepository) List(ctx context.Context, from, to time.Time) ([]models.Shift, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	shifts := make([]models.Shift, 0)
+	for _, shift := range r.store.shifts {
+		if shift.OpenedAt.Before(from) || !shift.OpenedAt.Before(to) {
+			continue
+		}
+		shifts = append(shifts, copyShift(shift))
+	}
+	SortShifts(shifts)
+	return shifts, nil
+}
@@ -0,0 +1,329 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"kasirnest/models"
+)
+
+// newTestRepositories returns memory repositories stocked with two products
+func newTestRepositories(t *testing.T) *Repositories {
+	t.Helper()
+	repos := NewMemoryRepositories()
+	for _, product := range []models.Product{
+		{ProductID: "kopi", Name: "Kopi", Price: 15000, Stock: 10},
+		{ProductID: "teh", Name: "Teh", Price: 8000, Stock: 2},
+	} {
+		product := product
+		if err := repos.Products.Create(context.Background(), &product); err != nil {
+			t.Fatalf("Create(%s): %v", product.ProductID, err)
+		}
+	}
+	return repos
+}
+
+// sale builds a transaction for the given product quantities
+func sale(id string, date time.Time, quantities map[string]int) *models.Transaction {
+	transaction := &models.Transaction{TransID: id, Date: date, PaymentMethod: models.PaymentCash}
+	for productID, quantity := range quantities {
+		transaction.Items = append(transaction.Items, models.TransactionItem{ProductID: productID, Quantity: quantity})
+	}
+	return transaction
+}
+
+func stockOf(t *testing.T, repos *Repositories, productID string) int {
+	t.Helper()
+	product, err := repos.Products.Get(context.Background(), productID)
+	if err != nil {
+		t.Fatalf("Get(%s): %v", productID, err)
+	}
+	return product.Stock
+}
+
+func TestMemoryCheckoutDecrementsStock(t *testing.T) {
+	ctx := context.Background()
+	repos := newTestRepositories(t)
+
+	transaction := sale("t1", time.Now(), map[string]int{"kopi": 3})
+	transaction.Items = append(transaction.Items, models.TransactionItem{ProductID: "kopi", Quantity: 2})
+	if err := repos.Transactions.Checkout(ctx, transaction); err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+
+	if got := stockOf(t, repos, "kopi"); got != 5 {
+		t.Errorf("kopi stock = %d, want 5", got)
+	}
+	if _, err := repos.Transactions.Get(ctx, "t1"); err != nil {
+		t.Errorf("Get(t1): %v", err)
+	}
+}
+
+func TestMemoryCheckoutInsufficientStock(t *testing.T) {
+	ctx := context.Background()
+	repos := newTestRepositories(t)
+
+	err := repos.Transactions.Checkout(ctx, sale("t1", time.Now(), map[string]int{"kopi": 1, "teh": 3}))
+	var stockErr *models.StockError
+	if !errors.As(err, &stockErr) || !errors.Is(err, models.ErrInsufficientStock) {
+		t.Fatalf("Checkout error = %v, want a StockError", err)
+	}
+	if len(stockErr.ProductIDs) != 1 || stockErr.ProductIDs[0] != "teh" {
+		t.Errorf("StockError products = %v, want [teh]", stockErr.ProductIDs)
+	}
+
+	// Nothing is sold when any item is short
+	if got := stockOf(t, repos, "kopi"); got != 10 {
+		t.Errorf("kopi stock = %d, want 10", got)
+	}
+	if _, err := repos.Transactions.Get(ctx, "t1"); !errors.Is(err, models.ErrTransactionNotFound) {
+		t.Errorf("Get(t1) error = %v, want ErrTransactionNotFound", err)
+	}
+}
+
+func TestMemoryCheckoutRejectsInvalidSales(t *testing.T) {
+	ctx := context.Background()
+	repos := newTestRepositories(t)
+
+	tests := []struct {
+		name string
+		sale *models.Transaction
+		want error
+	}{
+		{"empty cart", &models.Transaction{TransID: "t1"}, models.ErrInvalidQuantity},
+		{"zero quantity", sale("t2", time.Now(), map[string]int{"kopi": 0}), models.ErrInvalidQuantity},
+		{"unknown product", sale("t3", time.Now(), map[string]int{"susu": 1}), models.ErrProductNotFound},
+	}
+	for _, tt := range tests {
+		if err := repos.Transactions.Checkout(ctx, tt.sale); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Checkout error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestMemoryCheckoutDuplicate(t *testing.T) {
+	ctx := context.Background()
+	repos := newTestRepositories(t)
+
+	if err := repos.Transactions.Checkout(ctx, sale("t1", time.Now(), map[string]int{"kopi": 1})); err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	err := repos.Transactions.Checkout(ctx, sale("t1", time.Now(), map[string]int{"kopi": 1}))
+	if !errors.Is(err, models.ErrAlreadyExists) {
+		t.Fatalf("second Checkout error = %v, want ErrAlreadyExists", err)
+	}
+	if got := stockOf(t, repos, "kopi"); got != 9 {
+		t.Errorf("kopi stock = %d, want 9", got)
+	}
+}
+
+func TestMemoryCheckoutIDConflict(t *testing.T) {
+	ctx := context.Background()
+	repos := newTestRepositories(t)
+
+	if err := repos.Transactions.Checkout(ctx, sale("t1", time.Now(), map[string]int{"kopi": 1})); err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	// Another sale that happens to get the same ID is not a duplicate
+	err := repos.Transactions.Checkout(ctx, sale("t1", time.Now(), map[string]int{"teh": 1}))
+	if !errors.Is(err, models.ErrTransactionConflict) || errors.Is(err, models.ErrAlreadyExists) {
+		t.Fatalf("conflicting Checkout error = %v, want ErrTransactionConflict", err)
+	}
+	if got := stockOf(t, repos, "teh"); got != 2 {
+		t.Errorf("teh stock = %d, want 2", got)
+	}
+}
+
+func TestNewTransactionIDUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id := models.NewTransactionID()
+		if seen[id] {
+			t.Fatalf("NewTransactionID returned %s twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestMemoryCheckoutConcurrentCannotOversell(t *testing.T) {
+	ctx := context.Background()
+	repos := newTestRepositories(t)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- repos.Transactions.Checkout(ctx, sale(string(rune('a'+i)), time.Now(), map[string]int{"teh": 1}))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	sold := 0
+	for err := range errs {
+		if err == nil {
+			sold++
+		} else if !errors.Is(err, models.ErrInsufficientStock) {
+			t.Errorf("Checkout error = %v", err)
+		}
+	}
+	if sold != 2 {
+		t.Errorf("sold %d, want 2", sold)
+	}
+	if got := stockOf(t, repos, "teh"); got != 0 {
+		t.Errorf("teh stock = %d, want 0", got)
+	}
+}
+
+func TestMemoryWatchSeesCheckout(t *testing.T) {
+	ctx := context.Background()
+	repos := newTestRepositories(t)
+
+	var mu sync.Mutex
+	var latest []models.Product
+	stop, err := repos.Products.Watch(ctx, func(products []models.Product, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		latest = products
+	})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	defer stop()
+
+	if err := repos.Transactions.Checkout(ctx, sale("t1", time.Now(), map[string]int{"teh": 2})); err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, product := range latest {
+		if product.ProductID == "teh" && product.Stock != 0 {
+			t.Errorf("watched teh stock = %d, want 0", product.Stock)
+		}
+	}
+}
+
+func TestMemoryListTransactionsPages(t *testing.T) {
+	ctx := context.Background()
+	repos := newTestRepositories(t)
+	repos.Products.Update(ctx, &models.Product{ProductID: "kopi", Stock: 100})
+
+	start := time.Date(2024, 5, 1, 8, 0, 0, 0, time.Local)
+	for i := 0; i < 5; i++ {
+		transaction := sale(string(rune('a'+i)), start.Add(time.Duration(i)*time.Hour), map[string]int{"kopi": 1})
+		transaction.ShiftID = "s1"
+		if i == 4 {
+			transaction.ShiftID = "s2"
+		}
+		if err := repos.Transactions.Checkout(ctx, transaction); err != nil {
+			t.Fatalf("Checkout: %v", err)
+		}
+	}
+
+	var got []string
+	query := TransactionQuery{Limit: 2}
+	for {
+		page, err := repos.Transactions.List(ctx, query)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		for _, transaction := range page.Transactions {
+			got = append(got, transaction.TransID)
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		query.PageToken = page.NextPageToken
+	}
+	if want := "edcba"; joinIDs(got) != want {
+		t.Errorf("paged IDs = %s, want %s", joinIDs(got), want)
+	}
+
+	page, err := repos.Transactions.List(ctx, TransactionQuery{
+		From:    start.Add(time.Hour),
+		To:      start.Add(4 * time.Hour),
+		ShiftID: "s1",
+	})
+	if err != nil {
+		t.Fatalf("List filtered: %v", err)
+	}
+	got = got[:0]
+	for _, transaction := range page.Transactions {
+		got = append(got, transaction.TransID)
+	}
+	if want := "dcb"; joinIDs(got) != want {
+		t.Errorf("filtered IDs = %s, want %s", joinIDs(got), want)
+	}
+
+	if _, err := repos.Transactions.List(ctx, TransactionQuery{PageToken: "bogus"}); err == nil {
+		t.Error("List with an unknown page token succeeded")
+	}
+}
+
+func joinIDs(ids []string) string {
+	joined := ""
+	for _, id := range ids {
+		joined += id
+	}
+	return joined
+}
+
+func TestMemorySummary(t *testing.T) {
+	ctx := context.Background()
+	repos := newTestRepositories(t)
+
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)
+	for i, date := range []time.Time{day.Add(9 * time.Hour), day.Add(20 * time.Hour), day.AddDate(0, 0, 1)} {
+		transaction := sale(string(rune('a'+i)), date, map[string]int{"kopi": 1})
+		transaction.Total = 15000
+		if err := repos.Transactions.Checkout(ctx, transaction); err != nil {
+			t.Fatalf("Checkout: %v", err)
+		}
+	}
+
+	summary, err := repos.Transactions.Summary(ctx, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("Summary: %v", err)
+	}
+	if summary.Count != 2 || summary.Total != 30000 {
+		t.Errorf("Summary = %+v, want 2 sales of 30000", summary)
+	}
+}
+
+func TestMemoryShiftCurrent(t *testing.T) {
+	ctx := context.Background()
+	repos := NewMemoryRepositories()
+
+	if _, err := repos.Shifts.Current(ctx, "t1"); !errors.Is(err, models.ErrNoOpenShift) {
+		t.Fatalf("Current error = %v, want ErrNoOpenShift", err)
+	}
+
+	shift, err := models.NewShift("t1", "u1", "Ani", 200000)
+	if err != nil {
+		t.Fatalf("NewShift: %v", err)
+	}
+	if err := repos.Shifts.Save(ctx, shift); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	current, err := repos.Shifts.Current(ctx, "t1")
+	if err != nil || current.ShiftID != shift.ShiftID {
+		t.Fatalf("Current = %v, %v; want %s", current, err, shift.ShiftID)
+	}
+	if _, err := repos.Shifts.Current(ctx, "t2"); !errors.Is(err, models.ErrNoOpenShift) {
+		t.Errorf("Current on another terminal error = %v, want ErrNoOpenShift", err)
+	}
+
+	if err := shift.Close("u1", "Ani", nil, nil); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	repos.Shifts.Save(ctx, shift)
+	if _, err := repos.Shifts.Current(ctx, "t1"); !errors.Is(err, models.ErrNoOpenShift) {
+		t.Errorf("Current after close error = %v, want ErrNoOpenShift", err)
+	}
+}
@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"kasirnest/firebase"
+	"kasirnest/models"
+)
+
+// Collection names used by the Firestore-backed repositories
+const (
+	ProductsCollection     = "products"
+	TransactionsCollection = "transactions"
+	UsersCollection        = "users"
+	CategoriesCollection   = "categories"
+	ShiftsCollection       = "shifts"
+)
+
+// ProductRepository stores products
+type ProductRepository interface {
+	Get(ctx context.Context, productID string) (*models.Product, error)
+	List(ctx context.Context) ([]models.Product, error)
+	Create(ctx context.Context, product *models.Product) error
+	Update(ctx context.Context, product *models.Product) error
+	Delete(ctx context.Context, productID string) error
+	Count(ctx context.Context) (int, error)
+	// CountLowStock counts products with stock at or below threshold
+	CountLowStock(ctx context.Context, threshold int) (int, error)
+	// Watch calls onChange with every product now and whenever any product
+	// changes, until stop is called. onChange may run on any goroutine.
+	Watch(ctx context.Context, onChange func([]models.Product, error)) (stop func(), err error)
+}
+
+// TransactionRepository stores sale transactions
+type TransactionRepository interface {
+	Get(ctx context.Context, transID string) (*models.Transaction, error)
+	// List returns transactions matching query, most recent first
+	List(ctx context.Context, query TransactionQuery) (*TransactionPage, error)
+	// Checkout decrements product stock and stores the transaction atomically.
+	// It returns a *models.StockError when any product cannot be sold.
+	Checkout(ctx context.Context, transaction *models.Transaction) error
+	Count(ctx context.Context) (int, error)
+	// Summary counts and totals the transactions in [from, to)
+	Summary(ctx context.Context, from, to time.Time) (*SalesSummary, error)
+}
+
+// UserRepository stores user profiles
+type UserRepository interface {
+	Get(ctx context.Context, userID string) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	List(ctx context.Context) ([]models.User, error)
+	Save(ctx context.Context, user *models.User) error
+	Delete(ctx context.Context, userID string) error
+}
+
+// ShiftRepository stores cashier shifts
+type ShiftRepository interface {
+	Get(ctx context.Context, shiftID string) (*models.Shift, error)
+	// Current returns the open shift of a terminal, or models.ErrNoOpenShift
+	Current(ctx context.Context, terminalID string) (*models.Shift, error)
+	// Save creates or updates a shift
+	Save(ctx context.Context, shift *models.Shift) error
+	// List returns the shifts opened in [from, to), most recent first
+	List(ctx context.Context, from, to time.Time) ([]models.Shift, error)
+}
+
+// CategoryRepository stores product categories
+type CategoryRepository interface {
+	Get(ctx context.Context, categoryID string) (*models.Category, error)
+	List(ctx context.Context) ([]models.Category, error)
+	Save(ctx context.Context, category *models.Category) error
+	Delete(ctx context.Context, categoryID string) error
+}
+
+// TransactionQuery describes a page of transaction history
+type TransactionQuery struct {
+	From      time.Time // inclusive, zero for no lower bound
+	To        time.Time // exclusive, zero for no upper bound
+	ShiftID   string    // only transactions of this shift when set
+	Limit     int       // zero for all matching transactions
+	PageToken string    // opaque cursor from a previous page
+}
+
+// TransactionPage is a single page of transactions
+type TransactionPage struct {
+	Transactions  []models.Transaction
+	NextPageToken string // empty when there are no more results
+}
+
+// SalesSummary is the number and total value of sales in a period
+type SalesSummary struct {
+	Count int
+	Total float64
+}
+
+// Repositories groups the repositories used by the application
+type Repositories struct {
+	Products     ProductRepository
+	Transactions TransactionRepository
+	Users        UserRepository
+	Categories   CategoryRepository
+	Shifts       ShiftRepository
+}
+
+// StaleError is returned with results read from the local copy on this
+// terminal because Firestore could not be reached. The results are usable
+// but may miss changes made on other terminals.
+type StaleError struct {
+	Err error
+}
+
+func (e *StaleError) Error() string {
+	return "showing local data: " + e.Err.Error()
+}
+
+func (e *StaleError) Unwrap() error {
+	return e.Err
+}
+
+// IsStale reports whether the results returned with err come from the
+// local copy instead of Firestore
+func IsStale(err error) bool {
+	var stale *StaleError
+	return errors.As(err, &stale)
+}
+
+// IsPartial reports whether the results returned with err are usable but
+// may be incomplete, either because some records could not be decoded or
+// because they were read from the local copy
+func IsPartial(err error) bool {
+	return firebase.IsDecodeError(err) || IsStale(err)
+}
+
+// SummarizeTransactions computes the summary of transactions in [from, to)
+// the way the Firestore repository does
+func SummarizeTransactions(transactions []models.Transaction, from, to time.Time) *SalesSummary {
+	summary := &SalesSummary{}
+	for _, transaction := range transactions {
+		if transaction.Date.Before(from) || !transaction.Date.Before(to) {
+			continue
+		}
+		summary.Count++
+		summary.Total += transaction.Total
+	}
+	return summary
+}
+
+// SortShifts orders shifts the way ShiftRepository.List returns them, most
+// recently opened first
+func SortShifts(shifts []models.Shift) {
+	sort.Slice(shifts, func(i, j int) bool {
+		if shifts[i].OpenedAt.Equal(shifts[j].OpenedAt) {
+			return shifts[i].ShiftID > shifts[j].ShiftID
+		}
+		return shifts[i].OpenedAt.After(shifts[j].OpenedAt)
+	})
+}
+
+// PageTransactions applies query to an unordered set of transactions the way
+// the Firestore repository does: filtered by date and shift, most recent
+// first, paged by a token for the last transaction on the previous page
+func PageTransactions(transactions []models.Transaction, query TransactionQuery) (*TransactionPage, error) {
+	matches := make([]models.Transaction, 0, len(transactions))
+	for _, transaction := range transactions {
+		if !query.From.IsZero() && transaction.Date.Before(query.From) {
+			continue
+		}
+		if !query.To.IsZero() && !transaction.Date.Before(query.To) {
+			continue
+		}
+		if query.ShiftID != "" && transaction.ShiftID != query.ShiftID {
+			continue
+		}
+		matches = append(matches, transaction)
+	}
+
+	// Ties are broken by ID to keep pages stable
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Date.Equal(matches[j].Date) {
+			return matches[i].TransID > matches[j].TransID
+		}
+		return matches[i].Date.After(matches[j].Date)
+	})
+
+	if query.PageToken != "" {
+		transID, err := firebase.DecodePageToken(query.PageToken)
+		if err != nil {
+			return nil, err
+		}
+		start := -1
+		for i, transaction := range matches {
+			if transaction.TransID == transID {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return nil, errors.New("invalid page token")
+		}
+		matches = matches[start:]
+	}
+
+	page := &TransactionPage{Transactions: matches}
+	if query.Limit > 0 && len(matches) > query.Limit {
+		page.Transactions = matches[:query.Limit]
+		page.NextPageToken = firebase.EncodePageToken(matches[query.Limit-1].TransID)
+	}
+
+	return page, nil
+}
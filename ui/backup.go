@@ -0,0 +1,311 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"kasirnest/backup"
+	"kasirnest/models"
+	"kasirnest/utils"
+)
+
+// BackupScreen shows the backup history and lets the user take a backup
+type BackupScreen struct {
+	window      fyne.Window
+	container   *fyne.Container
+	manager     *backup.Manager
+	ctx         context.Context // cancelled by Close
+	cancel      context.CancelFunc
+	statusLabel *widget.Label
+	backupBtn   *widget.Button
+	restoreBtn  *widget.Button
+	historyList *widget.Table
+
+	// Data, replaced by the history loading goroutine
+	mu       sync.RWMutex
+	entries  []backup.Entry
+	selected int // row of entries chosen for restore, -1 when none
+}
+
+// NewBackupScreen creates a new backup screen.
+// manager may be nil when backups are not available.
+func NewBackupScreen(w fyne.Window, manager *backup.Manager) *BackupScreen {
+	ctx, cancel := context.WithCancel(context.Background())
+	screen := &BackupScreen{
+		window:   w,
+		manager:  manager,
+		ctx:      ctx,
+		cancel:   cancel,
+		selected: -1,
+	}
+
+	screen.setupUI()
+	return screen
+}
+
+// setupUI sets up the backup interface
+func (b *BackupScreen) setupUI() {
+	if b.manager == nil {
+		b.container = container.NewVBox(widget.NewLabel("Backup tidak tersedia, periksa encryption_key dan backup_dir di app.ini"))
+		return
+	}
+
+	schedule := "Backup otomatis: nonaktif"
+	if b.manager.Scheduled() {
+		schedule = fmt.Sprintf("Backup otomatis: setiap %d jam", int(b.manager.Interval().Hours()))
+	}
+
+	b.statusLabel = widget.NewLabel("")
+	b.backupBtn = widget.NewButtonWithIcon("Backup Sekarang", theme.UploadIcon(), func() {
+		b.startBackup()
+	})
+	b.restoreBtn = widget.NewButtonWithIcon("Pulihkan", theme.DownloadIcon(), func() {
+		b.startRestore()
+	})
+	b.restoreBtn.Disable()
+	b.createHistoryList()
+
+	b.container = container.NewBorder(
+		container.NewVBox(
+			widget.NewLabel(schedule),
+			container.NewHBox(b.backupBtn, b.restoreBtn, b.statusLabel),
+			widget.NewSeparator(),
+			widget.NewLabel("Riwayat Backup:"),
+		),
+		nil, nil, nil,
+		b.historyList,
+	)
+
+	b.manager.OnStatusChange(func(status backup.Status) {
+		if b.ctx.Err() != nil {
+			return
+		}
+		b.showStatus(status)
+		if !status.Running {
+			b.loadHistory()
+		}
+	})
+}
+
+// createHistoryList creates the table of backups on disk
+func (b *BackupScreen) createHistoryList() {
+	b.historyList = widget.NewTable(
+		func() (int, int) {
+			b.mu.RLock()
+			defer b.mu.RUnlock()
+			return len(b.entries) + 1, 3 // +1 for header
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("Cell")
+		},
+		func(id widget.TableCellID, cell fyne.CanvasObject) {
+			label := cell.(*widget.Label)
+
+			if id.Row == 0 {
+				headers := []string{"Tanggal", "Ukuran", "File"}
+				label.SetText(headers[id.Col])
+				label.TextStyle = fyne.TextStyle{Bold: true}
+				return
+			}
+
+			label.TextStyle = fyne.TextStyle{}
+			b.mu.RLock()
+			defer b.mu.RUnlock()
+			if id.Row-1 >= len(b.entries) {
+				label.SetText("")
+				return
+			}
+
+			entry := b.entries[id.Row-1]
+			switch id.Col {
+			case 0:
+				label.SetText(utils.FormatDateTime(entry.CreatedAt))
+			case 1:
+				label.SetText(utils.FormatFileSize(entry.Size))
+			case 2:
+				label.SetText(entry.Name)
+			}
+		},
+	)
+	b.historyList.OnSelected = func(id widget.TableCellID) {
+		b.mu.Lock()
+		b.selected = -1
+		if id.Row > 0 && id.Row-1 < len(b.entries) {
+			b.selected = id.Row - 1
+		}
+		selected := b.selected
+		b.mu.Unlock()
+
+		if selected >= 0 {
+			b.restoreBtn.Enable()
+		} else {
+			b.restoreBtn.Disable()
+		}
+	}
+	b.historyList.SetColumnWidth(0, 200)
+	b.historyList.SetColumnWidth(1, 100)
+	b.historyList.SetColumnWidth(2, 260)
+}
+
+// loadHistory reads the backups on disk
+func (b *BackupScreen) loadHistory() {
+	entries, err := b.manager.History()
+	if err != nil {
+		log.Printf("Failed to read backup history: %v", err)
+		return
+	}
+
+	b.mu.Lock()
+	b.entries = entries
+	b.selected = -1
+	b.mu.Unlock()
+	b.historyList.UnselectAll()
+	b.restoreBtn.Disable()
+	b.historyList.Refresh()
+}
+
+// startBackup takes a backup in the background. The backup keeps running
+// when the screen is closed, only the result is no longer shown.
+func (b *BackupScreen) startBackup() {
+	go func() {
+		entry, err := b.manager.Backup(context.Background())
+		if b.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("backup gagal: %s", models.UserMessage(err)), b.window)
+			return
+		}
+		dialog.ShowInformation("Backup", fmt.Sprintf("Backup tersimpan: %s", entry.Name), b.window)
+	}()
+}
+
+// selectedEntry returns the backup chosen in the history
+func (b *BackupScreen) selectedEntry() (backup.Entry, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.selected < 0 || b.selected >= len(b.entries) {
+		return backup.Entry{}, false
+	}
+	return b.entries[b.selected], true
+}
+
+// startRestore compares the selected backup with Firestore and shows the
+// changes before anything is written
+func (b *BackupScreen) startRestore() {
+	entry, ok := b.selectedEntry()
+	if !ok {
+		return
+	}
+
+	b.statusLabel.SetText("Membandingkan backup dengan data saat ini...")
+	go func() {
+		plan, err := b.planRestore(entry)
+		if b.ctx.Err() != nil {
+			return
+		}
+		b.statusLabel.SetText("")
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("gagal membaca backup: %s", models.UserMessage(err)), b.window)
+			return
+		}
+		b.showRestorePlan(entry, plan)
+	}()
+}
+
+// planRestore reads a backup and compares it with Firestore
+func (b *BackupScreen) planRestore(entry backup.Entry) (*backup.Plan, error) {
+	archive, err := b.manager.Open(entry)
+	if err != nil {
+		return nil, err
+	}
+	return b.manager.PlanRestore(b.ctx, archive)
+}
+
+// showRestorePlan shows the documents a restore would create, overwrite
+// and delete per collection and asks for confirmation
+func (b *BackupScreen) showRestorePlan(entry backup.Entry, plan *backup.Plan) {
+	if plan.Changes() == 0 {
+		dialog.ShowInformation("Pulihkan Backup", "Data saat ini sudah sama dengan backup ini.", b.window)
+		return
+	}
+
+	grid := container.NewGridWithColumns(5)
+	for _, header := range []string{"Koleksi", "Baru", "Ditimpa", "Dihapus", "Sama"} {
+		grid.Add(widget.NewLabelWithStyle(header, fyne.TextAlignLeading, fyne.TextStyle{Bold: true}))
+	}
+	for _, collection := range plan.Collections {
+		grid.Add(widget.NewLabel(collection.Name))
+		grid.Add(widget.NewLabel(fmt.Sprintf("%d", len(collection.Create))))
+		grid.Add(widget.NewLabel(fmt.Sprintf("%d", len(collection.Overwrite))))
+		grid.Add(widget.NewLabel(fmt.Sprintf("%d", len(collection.Delete))))
+		grid.Add(widget.NewLabel(fmt.Sprintf("%d", collection.Unchanged)))
+	}
+
+	content := container.NewVBox(
+		widget.NewLabel(fmt.Sprintf("Backup %s (%s)", utils.FormatDateTime(entry.CreatedAt), entry.Name)),
+		grid,
+		widget.NewLabel("Data saat ini akan dibackup terlebih dahulu sebelum dipulihkan."),
+	)
+
+	dialog.ShowCustomConfirm("Pulihkan Backup", "Pulihkan", "Batal", content, func(confirm bool) {
+		if confirm {
+			b.restore(plan)
+		}
+	}, b.window)
+}
+
+// restore applies plan while showing its progress. Like a backup, the
+// restore keeps running when the screen is closed.
+func (b *BackupScreen) restore(plan *backup.Plan) {
+	progress := dialog.NewProgress("Pulihkan Backup", "Memulihkan data...", b.window)
+	progress.Show()
+
+	go func() {
+		err := b.manager.Restore(context.Background(), plan, func(done, total int) {
+			progress.SetValue(float64(done) / float64(total))
+		})
+		progress.Hide()
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("gagal memulihkan backup: %s", models.UserMessage(err)), b.window)
+			return
+		}
+		dialog.ShowInformation("Pulihkan Backup", fmt.Sprintf("%d dokumen berhasil dipulihkan.", plan.Changes()), b.window)
+	}()
+}
+
+// showStatus shows the state of the last backup run
+func (b *BackupScreen) showStatus(status backup.Status) {
+	switch {
+	case status.Running:
+		b.backupBtn.Disable()
+		b.statusLabel.SetText("Sedang membuat backup...")
+	case status.LastError != "":
+		b.backupBtn.Enable()
+		b.statusLabel.SetText("Backup terakhir gagal: " + status.LastError)
+	case !status.LastRun.IsZero():
+		b.backupBtn.Enable()
+		b.statusLabel.SetText("Backup terakhir: " + utils.FormatTime(status.LastRun))
+	default:
+		b.backupBtn.Enable()
+		b.statusLabel.SetText("")
+	}
+}
+
+// Close stops updating the screen
+func (b *BackupScreen) Close() {
+	b.cancel()
+}
+
+// GetContainer returns the backup container
+func (b *BackupScreen) GetContainer() *fyne.Container {
+	return b.container
+}
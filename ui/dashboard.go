@@ -1,8 +1,11 @@
 package ui
 
 import (
+	"context"
 	"fmt"
 	"image/color"
+	"log"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -10,27 +13,59 @@ import (
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 
+	"kasirnest/accounts"
+	"kasirnest/backup"
 	"kasirnest/firebase"
+	"kasirnest/images"
+	"kasirnest/models"
+	"kasirnest/offline"
+	"kasirnest/repository"
+	"kasirnest/utils"
 )
 
 // DashboardScreen represents the main dashboard
 type DashboardScreen struct {
 	window             fyne.Window
+	user               *models.User // the role decides which tabs and actions show
 	container          *fyne.Container
 	content            *container.DocTabs
 	firebaseClient     *firebase.Client
-	firestoreService   *firebase.FirestoreService
+	authService        *firebase.AuthService
+	repositories       *repository.Repositories
+	cashiers           *accounts.Cashiers
+	syncer             *offline.Syncer
+	stopSyncStatus     func() // removes the status bar listener, nil without one
+	backups            *backup.Manager
+	files              firebase.FileStorage
+	imageCache         *images.Cache
+	ctx                context.Context // cancelled by Close
+	cancel             context.CancelFunc
 	productsScreen     *ProductsScreen
 	transactionsScreen *TransactionsScreen
 	reportsScreen      *ReportsScreen
+	usersScreen        *UsersScreen // nil for users who may not manage users
+	onLock             func()       // locks the screen, set by the main app
 }
 
-// NewDashboardScreen creates a new dashboard screen
-func NewDashboardScreen(w fyne.Window, fbClient *firebase.Client) *DashboardScreen {
+// NewDashboardScreen creates a new dashboard screen for user.
+// authService, cashiers, syncer, backups, files and imageCache may be nil
+// when Firebase Auth, PINs, the offline store, backups, image storage or
+// the image cache are not available.
+func NewDashboardScreen(w fyne.Window, user *models.User, fbClient *firebase.Client, authService *firebase.AuthService, repos *repository.Repositories, cashiers *accounts.Cashiers, syncer *offline.Syncer, backups *backup.Manager, files firebase.FileStorage, imageCache *images.Cache) *DashboardScreen {
+	ctx, cancel := context.WithCancel(context.Background())
 	dashboard := &DashboardScreen{
-		window:           w,
-		firebaseClient:   fbClient,
-		firestoreService: firebase.NewFirestoreService(fbClient),
+		window:         w,
+		user:           user,
+		ctx:            ctx,
+		cancel:         cancel,
+		firebaseClient: fbClient,
+		authService:    authService,
+		repositories:   repos,
+		cashiers:       cashiers,
+		syncer:         syncer,
+		backups:        backups,
+		files:          files,
+		imageCache:     imageCache,
 	}
 
 	dashboard.setupUI()
@@ -58,13 +93,22 @@ func (d *DashboardScreen) setupUI() {
 	d.content = container.NewDocTabs()
 
 	// Create and add screens
-	d.productsScreen = NewProductsScreen(d.window, d.firebaseClient)
-	d.transactionsScreen = NewTransactionsScreen(d.window, d.firebaseClient)
-	d.reportsScreen = NewReportsScreen(d.window, d.firebaseClient)
+	d.productsScreen = NewProductsScreen(d.window, d.user, d.files, d.repositories.Products)
+	d.transactionsScreen = NewTransactionsScreen(d.window, d.user, d.repositories, d.imageCache)
+	if d.user.Can(models.PermReportView) {
+		d.reportsScreen = NewReportsScreen(d.window, d.repositories.Transactions)
+	}
+	if d.user.Can(models.PermUserManage) {
+		var manager *accounts.Manager
+		if d.authService != nil {
+			manager = accounts.NewManager(d.authService, d.repositories.Users, d.user)
+		}
+		d.usersScreen = NewUsersScreen(d.window, manager)
+	}
 
-	// Create simple container instead of tabs for now
+	// Home tab with welcome, stats and quick actions
 	dashboardContent := d.createDashboardContent()
-	d.container = container.NewBorder(
+	home := container.NewBorder(
 		topContainer,
 		nil,
 		nil,
@@ -72,19 +116,75 @@ func (d *DashboardScreen) setupUI() {
 		dashboardContent,
 	)
 
+	// Tab order must match the indices used by the quick actions
+	d.content.Append(container.NewTabItemWithIcon("Dashboard", theme.HomeIcon(), home))
+	d.content.Append(container.NewTabItemWithIcon("Produk", theme.StorageIcon(), d.productsScreen.GetContainer()))
+	d.content.Append(container.NewTabItemWithIcon("Transaksi", theme.ContentPasteIcon(), d.transactionsScreen.GetContainer()))
+	if d.reportsScreen != nil {
+		d.content.Append(container.NewTabItemWithIcon("Laporan", theme.DocumentIcon(), d.reportsScreen.GetContainer()))
+	}
+	if d.usersScreen != nil {
+		d.content.Append(container.NewTabItemWithIcon("Pengguna", theme.AccountIcon(), d.usersScreen.GetContainer()))
+	}
+	d.content.CloseIntercept = func(*container.TabItem) {} // tabs cannot be closed
+
 	// Create toolbar
 	toolbar := d.createToolbar()
 
 	// Create main container
 	d.container = container.NewBorder(
-		toolbar,   // top
-		nil,       // bottom
-		nil,       // left
-		nil,       // right
-		d.content, // center
+		toolbar,             // top
+		d.createStatusBar(), // bottom
+		nil,                 // left
+		nil,                 // right
+		d.content,           // center
 	)
 }
 
+// createStatusBar creates the bar showing the offline sync state
+func (d *DashboardScreen) createStatusBar() fyne.CanvasObject {
+	if d.syncer == nil {
+		return widget.NewLabel("Sinkronisasi: tidak tersedia (mode online saja)")
+	}
+
+	statusLabel := widget.NewLabel("Sinkronisasi: memeriksa...")
+	retryBtn := widget.NewButtonWithIcon("Coba Lagi", theme.ViewRefreshIcon(), func() {
+		if err := d.syncer.RetryFailed(); err != nil {
+			dialog.ShowError(err, d.window)
+		}
+	})
+	retryBtn.Hide()
+
+	// The bar is rebuilt with the layout, drop the listener of the old one
+	if d.stopSyncStatus != nil {
+		d.stopSyncStatus()
+	}
+	d.stopSyncStatus = d.syncer.OnStatusChange(func(status offline.SyncStatus) {
+		statusLabel.SetText(formatSyncStatus(status))
+		if status.Failed > 0 {
+			retryBtn.Show()
+		} else {
+			retryBtn.Hide()
+		}
+	})
+
+	return container.NewBorder(nil, nil, nil, retryBtn, statusLabel)
+}
+
+// formatSyncStatus formats the sync status for the status bar
+func formatSyncStatus(status offline.SyncStatus) string {
+	state := "Offline"
+	if status.Online {
+		state = "Online"
+	}
+
+	text := fmt.Sprintf("Sinkronisasi: %s · %d tertunda · %d gagal", state, status.Pending, status.Failed)
+	if !status.LastSync.IsZero() {
+		text += fmt.Sprintf(" · terakhir %s", status.LastSync.Format("15:04:05"))
+	}
+	return text
+}
+
 // createWelcomeCard creates the welcome card
 func (d *DashboardScreen) createWelcomeCard(name, email string) *widget.Card {
 	if name == "" {
@@ -110,17 +210,32 @@ func (d *DashboardScreen) createStatsCard() *widget.Card {
 	// Create stats labels
 	totalProductsLabel := widget.NewLabel("Loading...")
 	totalTransactionsLabel := widget.NewLabel("Loading...")
+	todaysTransactionsLabel := widget.NewLabel("Loading...")
 	todaysSalesLabel := widget.NewLabel("Loading...")
+	lowStockLabel := widget.NewLabel("Loading...")
 
-	// Load stats asynchronously
-	go d.loadStats(totalProductsLabel, totalTransactionsLabel, todaysSalesLabel)
-
+	labels := statsLabels{
+		products: totalProductsLabel,
+		lowStock: lowStockLabel,
+	}
 	content := container.NewVBox(
 		container.NewHBox(widget.NewLabel("Total Produk:"), totalProductsLabel),
-		container.NewHBox(widget.NewLabel("Total Transaksi:"), totalTransactionsLabel),
-		container.NewHBox(widget.NewLabel("Penjualan Hari Ini:"), todaysSalesLabel),
 	)
 
+	// Sales figures are reports
+	if d.user.Can(models.PermReportView) {
+		labels.transactions = totalTransactionsLabel
+		labels.todayTransactions = todaysTransactionsLabel
+		labels.todaySales = todaysSalesLabel
+		content.Add(container.NewHBox(widget.NewLabel("Total Transaksi:"), totalTransactionsLabel))
+		content.Add(container.NewHBox(widget.NewLabel("Transaksi Hari Ini:"), todaysTransactionsLabel))
+		content.Add(container.NewHBox(widget.NewLabel("Penjualan Hari Ini:"), todaysSalesLabel))
+	}
+	content.Add(container.NewHBox(widget.NewLabel("Stok Menipis:"), lowStockLabel))
+
+	// Load stats asynchronously
+	go d.loadStats(labels)
+
 	return widget.NewCard("Statistik Cepat", "", content)
 }
 
@@ -131,6 +246,11 @@ func (d *DashboardScreen) createToolbar() *widget.Toolbar {
 			d.showSettings()
 		}),
 		widget.NewToolbarSeparator(),
+		widget.NewToolbarAction(theme.VisibilityOffIcon(), func() {
+			if d.onLock != nil {
+				d.onLock()
+			}
+		}),
 		widget.NewToolbarAction(theme.LogoutIcon(), func() {
 			d.handleLogout()
 		}),
@@ -157,6 +277,13 @@ func (d *DashboardScreen) createDashboardContent() *fyne.Container {
 		d.content.SelectIndex(3) // Select reports tab
 	})
 
+	if !d.user.Can(models.PermProductEdit) {
+		addProductBtn.Hide()
+	}
+	if d.reportsScreen == nil {
+		viewReportsBtn.Hide()
+	}
+
 	// Create quick actions card
 	quickActionsCard := widget.NewCard("Aksi Cepat", "",
 		container.NewVBox(
@@ -175,26 +302,65 @@ func (d *DashboardScreen) createDashboardContent() *fyne.Container {
 	)
 }
 
-// loadStats loads statistics data
-func (d *DashboardScreen) loadStats(productsLabel, transactionsLabel, salesLabel *widget.Label) {
+// statsLabels holds the labels of the quick stats card. The sales labels
+// are nil for users who may not view reports.
+type statsLabels struct {
+	products          *widget.Label
+	transactions      *widget.Label
+	todayTransactions *widget.Label
+	todaySales        *widget.Label
+	lowStock          *widget.Label
+}
+
+// loadStats loads statistics data using aggregation queries
+func (d *DashboardScreen) loadStats(labels statsLabels) {
 	// Load product count
-	productCount, err := d.firestoreService.GetCollectionSize("products")
+	productCount, err := d.repositories.Products.Count(d.ctx)
 	if err != nil {
-		productsLabel.SetText("Error")
+		labels.products.SetText("Error")
 	} else {
-		productsLabel.SetText(fmt.Sprintf("%d", productCount))
+		labels.products.SetText(fmt.Sprintf("%d", productCount))
 	}
 
+	if labels.transactions != nil {
+		d.loadSalesStats(labels)
+	}
+
+	// Load low stock count
+	lowStockCount, err := d.repositories.Products.CountLowStock(d.ctx, models.LowStockThreshold)
+	if err != nil {
+		labels.lowStock.SetText("Error")
+	} else {
+		labels.lowStock.SetText(fmt.Sprintf("%d produk", lowStockCount))
+	}
+}
+
+// loadSalesStats loads the transaction count and today's sales
+func (d *DashboardScreen) loadSalesStats(labels statsLabels) {
 	// Load transaction count
-	transactionCount, err := d.firestoreService.GetCollectionSize("transactions")
+	transactionCount, err := d.repositories.Transactions.Count(d.ctx)
 	if err != nil {
-		transactionsLabel.SetText("Error")
+		labels.transactions.SetText("Error")
 	} else {
-		transactionsLabel.SetText(fmt.Sprintf("%d", transactionCount))
+		labels.transactions.SetText(fmt.Sprintf("%d", transactionCount))
 	}
 
-	// Load today's sales (placeholder)
-	salesLabel.SetText("Rp 0")
+	// Load today's sales
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	summary, err := d.repositories.Transactions.Summary(d.ctx, today, today.AddDate(0, 0, 1))
+	if err != nil && repository.IsPartial(err) {
+		log.Printf("Today's sales may be incomplete: %v", err)
+		err = nil
+	}
+	if err != nil {
+		log.Printf("Failed to load today's sales: %v", err)
+		labels.todayTransactions.SetText("Error")
+		labels.todaySales.SetText("Error")
+	} else {
+		labels.todayTransactions.SetText(fmt.Sprintf("%d", summary.Count))
+		labels.todaySales.SetText(utils.FormatCurrency(summary.Total))
+	}
 }
 
 // showSettings shows the settings dialog
@@ -213,13 +379,83 @@ func (d *DashboardScreen) showSettings() {
 		},
 	}
 
+	tabs := container.NewAppTabs(
+		container.NewTabItemWithIcon("Tampilan", theme.ColorPaletteIcon(), form),
+	)
+	if d.cashiers != nil {
+		tabs.Append(container.NewTabItemWithIcon("PIN", theme.AccountIcon(), d.createPINForm()))
+	}
+
+	// Backups and storage affect every user's data
+	var backupScreen *BackupScreen
+	var storageScreen *StorageScreen
+	if d.user.Can(models.PermSettingsManage) {
+		backupScreen = NewBackupScreen(d.window, d.backups)
+		storageScreen = NewStorageScreen(d.window, d.files, d.repositories.Products)
+		tabs.Append(container.NewTabItemWithIcon("Backup", theme.HistoryIcon(), backupScreen.GetContainer()))
+		tabs.Append(container.NewTabItemWithIcon("Penyimpanan", theme.StorageIcon(), storageScreen.GetContainer()))
+	}
+
 	// Show dialog
-	dialog.ShowForm("Pengaturan", "Simpan", "Batal", form.Items, func(confirm bool) {
+	settingsDialog := dialog.NewCustomConfirm("Pengaturan", "Simpan", "Batal", tabs, func(confirm bool) {
 		if confirm {
 			// Apply settings
 			d.applySettings(themeSelect.Selected, windowSizeEntry.Text)
 		}
 	}, d.window)
+	settingsDialog.SetOnClosed(func() {
+		if backupScreen != nil {
+			backupScreen.Close()
+			storageScreen.Close()
+		}
+	})
+	settingsDialog.Resize(fyne.NewSize(640, 480))
+	settingsDialog.Show()
+}
+
+// createPINForm creates the form where users set the PIN they switch in
+// with on the lock screen
+func (d *DashboardScreen) createPINForm() fyne.CanvasObject {
+	currentEntry := widget.NewPasswordEntry()
+	currentEntry.SetPlaceHolder("Kosongkan jika belum punya PIN")
+	pinEntry := widget.NewPasswordEntry()
+	pinEntry.SetPlaceHolder(fmt.Sprintf("%d-%d angka, kosongkan untuk menghapus PIN", models.MinPINLength, models.MaxPINLength))
+	confirmEntry := widget.NewPasswordEntry()
+
+	var saveButton *widget.Button
+	saveButton = widget.NewButton("Simpan PIN", func() {
+		if pinEntry.Text != confirmEntry.Text {
+			dialog.ShowError(fmt.Errorf("konfirmasi PIN tidak sama"), d.window)
+			return
+		}
+
+		saveButton.Disable()
+		go func() {
+			defer saveButton.Enable()
+			err := d.cashiers.ChangePIN(d.ctx, d.user, currentEntry.Text, pinEntry.Text)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("gagal menyimpan PIN: %s", models.UserMessage(err)), d.window)
+				return
+			}
+			currentEntry.SetText("")
+			pinEntry.SetText("")
+			confirmEntry.SetText("")
+			dialog.ShowInformation("PIN", "PIN berhasil disimpan", d.window)
+		}()
+	})
+
+	form := &widget.Form{
+		Items: []*widget.FormItem{
+			{Text: "PIN Saat Ini:", Widget: currentEntry},
+			{Text: "PIN Baru:", Widget: pinEntry},
+			{Text: "Ulangi PIN Baru:", Widget: confirmEntry},
+		},
+	}
+	return container.NewVBox(
+		widget.NewLabel("PIN dipakai untuk ganti kasir di layar kunci tanpa password."),
+		form,
+		saveButton,
+	)
 }
 
 // applySettings applies the settings
@@ -265,6 +501,33 @@ func (d *DashboardScreen) SetLogoutCallback(callback func()) {
 	logoutCallback = callback
 }
 
+// SetLockCallback sets the callback of the lock button, which hands the
+// terminal over to the lock screen
+func (d *DashboardScreen) SetLockCallback(callback func()) {
+	d.onLock = callback
+}
+
+// Close stops the live updates of the child screens and cancels any
+// requests still in flight
+func (d *DashboardScreen) Close() {
+	d.cancel()
+	if d.stopSyncStatus != nil {
+		d.stopSyncStatus()
+	}
+	if d.reportsScreen != nil {
+		d.reportsScreen.Close()
+	}
+	if d.usersScreen != nil {
+		d.usersScreen.Close()
+	}
+	if d.productsScreen != nil {
+		d.productsScreen.Close()
+	}
+	if d.transactionsScreen != nil {
+		d.transactionsScreen.Close()
+	}
+}
+
 // GetContainer returns the dashboard container
 func (d *DashboardScreen) GetContainer() *fyne.Container {
 	return d.container
@@ -282,6 +545,9 @@ func (d *DashboardScreen) Refresh() {
 	if d.reportsScreen != nil {
 		d.reportsScreen.Refresh()
 	}
+	if d.usersScreen != nil {
+		go d.usersScreen.Refresh()
+	}
 }
 
 // Simple theme implementations
@@ -0,0 +1,288 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image/color"
+	"log"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"kasirnest/accounts"
+	"kasirnest/firebase"
+	"kasirnest/models"
+)
+
+// lockMessages explains to the cashier why the screen was locked
+var lockMessages = map[LockReason]string{
+	LockManual:  "Layar dikunci. Pilih kasir dan masukkan PIN, atau login dengan password.",
+	LockIdle:    "Layar dikunci karena tidak ada aktivitas.",
+	LockExpired: "Sesi telah berakhir, masukkan password untuk melanjutkan.",
+}
+
+// cashiersTimeout bounds loading the cashiers shown on the lock screen
+const cashiersTimeout = 10 * time.Second
+
+// LockScreen hides the dashboard until a cashier enters their PIN or the
+// signed in user enters their password again
+type LockScreen struct {
+	window        fyne.Window
+	container     *fyne.Container
+	passwordEntry *widget.Entry
+	unlockButton  *widget.Button
+	authService   *firebase.AuthService
+	sessions      *SessionManager
+	cashiers      *accounts.Cashiers
+	reason        LockReason
+	uid           string
+	email         string
+	name          string
+	onUnlock      func(*firebase.Session)
+	onSwitch      func(*models.User)
+	onLogout      func()
+
+	// PIN switching, nil when the session expired
+	cashierGrid *fyne.Container
+	pinPad      *pinPad
+	pinLabel    *widget.Label
+	selected    *models.User
+}
+
+// NewLockScreen creates a lock screen for the terminal signed in with
+// sessions. onUnlock receives the session verified by the password of the
+// signed in user, onSwitch the cashier whose PIN was checked, or the signed
+// in user whose password was checked offline, and onLogout is called when
+// someone else wants to log in. cashiers may be nil, and PINs and offline
+// passwords are not accepted once the session expired.
+func NewLockScreen(w fyne.Window, authService *firebase.AuthService, sessions *SessionManager, cashiers *accounts.Cashiers, reason LockReason, onUnlock func(*firebase.Session), onSwitch func(*models.User), onLogout func()) *LockScreen {
+	uid, email, name := sessions.Owner()
+	lock := &LockScreen{
+		window:      w,
+		authService: authService,
+		sessions:    sessions,
+		cashiers:    cashiers,
+		reason:      reason,
+		uid:         uid,
+		email:       email,
+		name:        name,
+		onUnlock:    onUnlock,
+		onSwitch:    onSwitch,
+		onLogout:    onLogout,
+	}
+	if name == "" {
+		name = email
+	}
+
+	lock.setupUI(name, reason)
+	if lock.pinPad != nil {
+		go lock.loadCashiers()
+	}
+	return lock
+}
+
+// setupUI sets up the lock screen in the colors of the login screen
+func (l *LockScreen) setupUI(name string, reason LockReason) {
+	background := canvas.NewRectangle(color.NRGBA{R: 28, G: 42, B: 56, A: 255})
+
+	title := canvas.NewText("Terkunci", color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+	title.TextSize = 28
+	title.TextStyle = fyne.TextStyle{Bold: true}
+	title.Alignment = fyne.TextAlignCenter
+
+	message := widget.NewLabel(lockMessages[reason])
+	message.Alignment = fyne.TextAlignCenter
+
+	columns := container.NewHBox()
+	if l.cashiers != nil && reason != LockExpired {
+		columns.Add(l.createPINForm())
+		columns.Add(widget.NewSeparator())
+	}
+	columns.Add(l.createPasswordForm(name))
+
+	l.container = container.NewMax(
+		background,
+		container.NewCenter(container.NewPadded(container.NewVBox(
+			container.NewCenter(title),
+			message,
+			columns,
+		))),
+	)
+}
+
+// createPINForm creates the cashier buttons and the keypad
+func (l *LockScreen) createPINForm() fyne.CanvasObject {
+	l.cashierGrid = container.NewGridWrap(fyne.NewSize(140, 40), widget.NewLabel("Memuat kasir..."))
+	l.pinLabel = widget.NewLabel("Pilih kasir")
+	l.pinLabel.Alignment = fyne.TextAlignCenter
+	l.pinPad = newPINPad(l.handlePIN)
+	l.pinPad.SetEnabled(false)
+
+	return container.NewVBox(
+		widget.NewCard("Ganti Kasir", "", container.NewVBox(
+			l.cashierGrid,
+			l.pinLabel,
+			container.NewCenter(container.NewGridWrap(fyne.NewSize(240, 280), l.pinPad.GetContainer())),
+		)),
+	)
+}
+
+// createPasswordForm creates the password login of the signed in user
+func (l *LockScreen) createPasswordForm(name string) fyne.CanvasObject {
+	userText := canvas.NewText(name, color.NRGBA{R: 56, G: 189, B: 190, A: 255})
+	userText.TextSize = 18
+	userText.Alignment = fyne.TextAlignCenter
+
+	l.passwordEntry = widget.NewPasswordEntry()
+	l.passwordEntry.SetPlaceHolder("Password")
+	l.passwordEntry.OnSubmitted = func(string) {
+		l.handleUnlock()
+	}
+
+	l.unlockButton = widget.NewButton("Buka", l.handleUnlock)
+	l.unlockButton.Importance = widget.HighImportance
+
+	logoutButton := widget.NewButton("Keluar", func() {
+		dialog.ShowConfirm("Keluar", "Keluar dan login sebagai pengguna lain?", func(confirm bool) {
+			if confirm {
+				l.onLogout()
+			}
+		}, l.window)
+	})
+
+	return widget.NewCard("Login", "", container.NewGridWrap(fyne.NewSize(260, 200), container.NewVBox(
+		container.NewCenter(userText),
+		l.passwordEntry,
+		l.unlockButton,
+		logoutButton,
+	)))
+}
+
+// loadCashiers shows a button for each cashier with a PIN. Cashiers loaded
+// earlier are shown when the users cannot be loaded.
+func (l *LockScreen) loadCashiers() {
+	ctx, cancel := context.WithTimeout(context.Background(), cashiersTimeout)
+	defer cancel()
+
+	cashiers, err := l.cashiers.List(ctx)
+	if err != nil {
+		log.Printf("Failed to load cashiers: %v", err)
+	}
+
+	var buttons []fyne.CanvasObject
+	for i := range cashiers {
+		cashier := cashiers[i]
+		name := cashier.Name
+		if name == "" {
+			name = cashier.Email
+		}
+		var button *widget.Button
+		button = widget.NewButton(name, func() {
+			l.selectCashier(&cashier, button)
+		})
+		buttons = append(buttons, button)
+	}
+
+	switch {
+	case len(buttons) > 0:
+		l.cashierGrid.Objects = buttons
+	case err != nil:
+		l.cashierGrid.Objects = []fyne.CanvasObject{widget.NewLabel("Daftar kasir tidak dapat dimuat")}
+	default:
+		l.cashierGrid.Objects = []fyne.CanvasObject{widget.NewLabel("Belum ada kasir dengan PIN")}
+	}
+	l.cashierGrid.Refresh()
+}
+
+// selectCashier asks for the PIN of cashier, whose button is highlighted
+func (l *LockScreen) selectCashier(cashier *models.User, button *widget.Button) {
+	l.selected = cashier
+	for _, object := range l.cashierGrid.Objects {
+		if other, ok := object.(*widget.Button); ok {
+			other.Importance = widget.MediumImportance
+			other.Refresh()
+		}
+	}
+	button.Importance = widget.HighImportance
+	button.Refresh()
+
+	l.pinLabel.SetText("PIN untuk " + button.Text)
+	l.pinPad.Clear()
+	l.pinPad.SetEnabled(true)
+}
+
+// handlePIN checks the PIN entered for the selected cashier
+func (l *LockScreen) handlePIN(pin string) {
+	cashier := l.selected
+	if cashier == nil {
+		return
+	}
+
+	l.pinPad.SetEnabled(false)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cashiersTimeout)
+		defer cancel()
+
+		user, err := l.cashiers.Verify(ctx, cashier.UserID, pin)
+		l.pinPad.Clear()
+		l.pinPad.SetEnabled(true)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("gagal ganti kasir: %s", models.UserMessage(err)), l.window)
+			return
+		}
+
+		log.Printf("Cashier switched to %s", user.Email)
+		l.onSwitch(user)
+	}()
+}
+
+// handleUnlock checks the password with Firebase Auth, which also
+// re-validates the session with a freshly verified ID token. While
+// Firebase cannot be reached the password cached at the last online check
+// unlocks a session that has not expired, without extending it.
+func (l *LockScreen) handleUnlock() {
+	password := l.passwordEntry.Text
+	if password == "" {
+		return
+	}
+
+	l.unlockButton.Disable()
+	go func() {
+		session, err := l.authService.LoginWithEmailPassword(context.Background(), l.email, password)
+		if err == nil && session.UID != l.uid {
+			err = models.ErrInvalidCredentials
+		}
+		offline := errors.Is(err, models.ErrUnavailable) || errors.Is(err, models.ErrTimeout)
+		unlockedOffline := offline && l.reason != LockExpired && l.sessions.CheckPassword(password)
+		l.unlockButton.Enable()
+		l.passwordEntry.SetText("")
+		if unlockedOffline {
+			log.Printf("Screen unlocked offline by %s", l.email)
+			l.onSwitch(&models.User{UserID: l.uid, Email: l.email, Name: l.name})
+			return
+		}
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("gagal membuka kunci: %s", models.UserMessage(err)), l.window)
+			return
+		}
+
+		log.Printf("Screen unlocked by %s", session.Email)
+		l.sessions.RememberPassword(session.UID, password)
+		l.onUnlock(session)
+	}()
+}
+
+// Focus puts the cursor in the password field
+func (l *LockScreen) Focus() {
+	l.window.Canvas().Focus(l.passwordEntry)
+}
+
+// GetContainer returns the lock screen container
+func (l *LockScreen) GetContainer() *fyne.Container {
+	return l.container
+}
@@ -1,11 +1,10 @@
 package ui
 
 import (
+	"context"
 	"fmt"
 	"image/color"
 	"log"
-	"strconv"
-	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
@@ -15,6 +14,7 @@ import (
 	"fyne.io/fyne/v2/widget"
 
 	"kasirnest/firebase"
+	"kasirnest/models"
 	"kasirnest/utils"
 )
 
@@ -27,11 +27,12 @@ type LoginScreen struct {
 	loginButton   *widget.Button
 	loadingLabel  *widget.Label
 	authService   *firebase.AuthService
-	onLogin       func()
+	onLogin       func(*firebase.Session)
 }
 
-// NewLoginScreen creates a new login screen
-func NewLoginScreen(w fyne.Window, authService *firebase.AuthService, onLoginSuccess func()) *LoginScreen {
+// NewLoginScreen creates a new login screen. onLoginSuccess receives the
+// verified session of the user.
+func NewLoginScreen(w fyne.Window, authService *firebase.AuthService, onLoginSuccess func(*firebase.Session)) *LoginScreen {
 	login := &LoginScreen{
 		window:      w,
 		authService: authService,
@@ -219,37 +220,23 @@ func (l *LoginScreen) handleLogin() {
 		return
 	}
 
-	// Use password for authentication (placeholder for actual implementation)
-	_ = password // This will be used for actual Firebase client-side auth
-
 	// Show loading state
 	l.setLoading(true)
 
-	// Perform login (this is a simplified version)
-	// In a real application, you would use Firebase Auth SDK on client side
+	// The password is checked by Firebase Auth, the returned ID token is
+	// verified before the session is accepted
 	go func() {
-		// Simulate authentication
-		// Note: Server-side password verification is not supported by Firebase Admin SDK
-		// This should be done using Firebase Auth SDK on the client side
-
-		user, err := l.authService.GetUserByEmail(email)
+		session, err := l.authService.LoginWithEmailPassword(context.Background(), email, password)
+		l.setLoading(false)
 		if err != nil {
-			l.setLoading(false)
-			l.showError("Login gagal: " + err.Error())
-			return
-		}
-
-		if user == nil {
-			l.setLoading(false)
-			l.showError("User tidak ditemukan")
+			l.passwordEntry.SetText("")
+			l.showError("Login gagal: " + models.UserMessage(err))
 			return
 		}
 
-		// Store user session (simplified)
-		l.storeUserSession(user.UID, user.Email, user.DisplayName)
-
-		l.setLoading(false)
-		l.onLogin()
+		log.Printf("User logged in: %s (%s)", session.DisplayName, session.Email)
+		l.onLogin(session)
+		rememberPassword(session.UID, password) // after the session was started
 	}()
 }
 
@@ -279,52 +266,3 @@ func (l *LoginScreen) showInfo(title, message string) {
 func (l *LoginScreen) GetContainer() *fyne.Container {
 	return l.container
 }
-
-// storeUserSession stores user session data
-func (l *LoginScreen) storeUserSession(uid, email, name string) {
-	// Store session in preferences
-	prefs := fyne.CurrentApp().Preferences()
-	prefs.SetString("user_id", uid)
-	prefs.SetString("user_email", email)
-	prefs.SetString("user_name", name)
-	prefs.SetString("login_time", fmt.Sprintf("%d", time.Now().Unix()))
-
-	log.Printf("User logged in: %s (%s)", name, email)
-}
-
-// ValidateSession validates if user session is still valid
-func ValidateSession() bool {
-	prefs := fyne.CurrentApp().Preferences()
-	userID := prefs.String("user_id")
-	loginTimeStr := prefs.String("login_time")
-
-	if userID == "" || loginTimeStr == "" {
-		return false
-	}
-
-	// Check if session is expired (24 hours)
-	loginTime, err := strconv.ParseInt(loginTimeStr, 10, 64)
-	if err != nil {
-		return false
-	}
-
-	sessionDuration := time.Since(time.Unix(loginTime, 0))
-	maxSessionDuration := 24 * time.Hour
-
-	return sessionDuration < maxSessionDuration
-}
-
-// GetCurrentUser returns current logged-in user info
-func GetCurrentUser() (uid, email, name string) {
-	prefs := fyne.CurrentApp().Preferences()
-	return prefs.String("user_id"), prefs.String("user_email"), prefs.String("user_name")
-}
-
-// ClearSession clears user session
-func ClearSession() {
-	prefs := fyne.CurrentApp().Preferences()
-	prefs.RemoveValue("user_id")
-	prefs.RemoveValue("user_email")
-	prefs.RemoveValue("user_name")
-	prefs.RemoveValue("login_time")
-}
@@ -0,0 +1,106 @@
+package ui
+
+import (
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"kasirnest/models"
+)
+
+// pinPad is an on-screen keypad for entering a PIN on touch screens. The
+// digits entered are only shown as dots.
+type pinPad struct {
+	container *fyne.Container
+	display   *widget.Label
+	buttons   []*widget.Button
+	pin       string
+	onSubmit  func(pin string)
+}
+
+// newPINPad creates a keypad that calls onSubmit with the PIN when OK is
+// pressed
+func newPINPad(onSubmit func(pin string)) *pinPad {
+	p := &pinPad{onSubmit: onSubmit}
+
+	p.display = widget.NewLabel("")
+	p.display.Alignment = fyne.TextAlignCenter
+	p.display.TextStyle = fyne.TextStyle{Bold: true, Monospace: true}
+
+	keys := container.NewGridWithColumns(3)
+	for _, digit := range []int{1, 2, 3, 4, 5, 6, 7, 8, 9} {
+		keys.Add(p.digitButton(strconv.Itoa(digit)))
+	}
+	clearButton := widget.NewButtonWithIcon("", theme.ContentClearIcon(), p.Clear)
+	backButton := widget.NewButtonWithIcon("", theme.NavigateBackIcon(), p.backspace)
+	keys.Add(clearButton)
+	keys.Add(p.digitButton("0"))
+	keys.Add(backButton)
+
+	okButton := widget.NewButton("OK", func() {
+		if p.pin != "" {
+			p.onSubmit(p.pin)
+		}
+	})
+	okButton.Importance = widget.HighImportance
+	p.buttons = append(p.buttons, clearButton, backButton, okButton)
+
+	p.container = container.NewVBox(p.display, keys, okButton)
+	p.update()
+	return p
+}
+
+// digitButton creates the key of a digit
+func (p *pinPad) digitButton(digit string) *widget.Button {
+	button := widget.NewButton(digit, func() {
+		if len(p.pin) < models.MaxPINLength {
+			p.pin += digit
+			p.update()
+		}
+	})
+	p.buttons = append(p.buttons, button)
+	return button
+}
+
+// backspace removes the last digit
+func (p *pinPad) backspace() {
+	if p.pin != "" {
+		p.pin = p.pin[:len(p.pin)-1]
+		p.update()
+	}
+}
+
+// Clear removes the digits entered
+func (p *pinPad) Clear() {
+	p.pin = ""
+	p.update()
+}
+
+// update shows a dot for each digit entered
+func (p *pinPad) update() {
+	if p.pin == "" {
+		p.display.SetText("Masukkan PIN")
+		return
+	}
+	p.display.SetText(strings.Repeat("● ", len(p.pin)))
+}
+
+// SetEnabled enables or disables all keys
+func (p *pinPad) SetEnabled(enabled bool) {
+	for _, button := range p.buttons {
+		if enabled {
+			button.Enable()
+		} else {
+			button.Disable()
+		}
+	}
+}
+
+// GetContainer returns the keypad container
+func (p *pinPad) GetContainer() *fyne.Container {
+	return p.container
+}
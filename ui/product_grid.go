@@ -0,0 +1,135 @@
+package ui
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"kasirnest/images"
+	"kasirnest/models"
+	"kasirnest/utils"
+)
+
+// productGridLimit is the number of tiles shown, the search narrows the
+// rest down
+const productGridLimit = 60
+
+// productGrid shows products as tiles with their photo for the POS
+type productGrid struct {
+	container *container.Scroll
+	grid      *fyne.Container
+	cache     *images.Cache // nil shows products without photos
+	ctx       context.Context
+	onTap     func(models.Product)
+
+	// Loaded thumbnails by object name, shared by the tile rebuilds
+	mu      sync.Mutex
+	photos  map[string]fyne.Resource
+	loading map[string][]*canvas.Image // photos waiting for a load
+}
+
+// newProductGrid creates an empty product grid. onTap is called with the
+// product whose tile was tapped.
+func newProductGrid(ctx context.Context, cache *images.Cache, onTap func(models.Product)) *productGrid {
+	g := &productGrid{
+		grid:    container.NewGridWrap(fyne.NewSize(140, 170)),
+		cache:   cache,
+		ctx:     ctx,
+		onTap:   onTap,
+		photos:  make(map[string]fyne.Resource),
+		loading: make(map[string][]*canvas.Image),
+	}
+	g.container = container.NewVScroll(g.grid)
+	g.container.SetMinSize(fyne.NewSize(0, 360))
+	return g
+}
+
+// SetProducts replaces the tiles with the given products
+func (g *productGrid) SetProducts(products []models.Product) {
+	if len(products) > productGridLimit {
+		products = products[:productGridLimit]
+	}
+
+	tiles := make([]fyne.CanvasObject, len(products))
+	for i, product := range products {
+		tiles[i] = g.tile(product)
+	}
+	g.grid.Objects = tiles
+	g.grid.Refresh()
+}
+
+// tile creates the tile of one product
+func (g *productGrid) tile(product models.Product) fyne.CanvasObject {
+	photo := canvas.NewImageFromResource(theme.FileImageIcon())
+	photo.FillMode = canvas.ImageFillContain
+	photo.SetMinSize(fyne.NewSize(96, 96))
+	g.loadPhoto(product.ThumbnailPath, photo)
+
+	name := widget.NewLabelWithStyle(product.Name, fyne.TextAlignCenter, fyne.TextStyle{Bold: true})
+	name.Wrapping = fyne.TextTruncate
+	price := widget.NewLabelWithStyle(utils.FormatCurrency(product.Price), fyne.TextAlignCenter, fyne.TextStyle{})
+
+	button := widget.NewButton("", func() {
+		g.onTap(product)
+	})
+	if !product.IsInStock() {
+		button.Disable()
+	}
+
+	return container.NewMax(button, container.NewVBox(photo, name, price))
+}
+
+// loadPhoto shows the named thumbnail in photo, loading it through the
+// image cache in the background the first time
+func (g *productGrid) loadPhoto(name string, photo *canvas.Image) {
+	if name == "" || g.cache == nil {
+		return
+	}
+
+	g.mu.Lock()
+	resource, loaded := g.photos[name]
+	waiting, loading := g.loading[name]
+	if !loaded {
+		// Tiles rebuilt while the photo loads wait for the same load
+		g.loading[name] = append(waiting, photo)
+	}
+	g.mu.Unlock()
+
+	if loaded {
+		photo.Resource = resource
+		return
+	}
+	if loading {
+		return
+	}
+
+	go func() {
+		data, err := g.cache.Load(g.ctx, name)
+
+		g.mu.Lock()
+		waiting := g.loading[name]
+		delete(g.loading, name)
+		if err == nil {
+			resource = fyne.NewStaticResource(name, data)
+			g.photos[name] = resource
+		}
+		g.mu.Unlock()
+
+		if err != nil {
+			if g.ctx.Err() == nil {
+				log.Printf("Failed to load product photo %s: %v", name, err)
+			}
+			return
+		}
+		for _, photo := range waiting {
+			photo.Resource = resource
+			photo.Refresh()
+		}
+	}()
+}
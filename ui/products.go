@@ -1,66 +1,120 @@
 package ui
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"strconv"
+	"sync"
 	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
 	"fyne.io/fyne/v2/widget"
 
 	"kasirnest/firebase"
+	"kasirnest/images"
 	"kasirnest/models"
+	"kasirnest/repository"
 	"kasirnest/utils"
 )
 
 // ProductsScreen represents the products management interface
 type ProductsScreen struct {
-	window           fyne.Window
-	container        *fyne.Container
-	firebaseClient   *firebase.Client
-	firestoreService *firebase.FirestoreService
-	storageService   *firebase.StorageService
-	table            *widget.Table
-	searchEntry      *widget.Entry
-	categoryFilter   *widget.Select
+	window         fyne.Window
+	user           *models.User
+	container      *fyne.Container
+	productRepo    repository.ProductRepository
+	files          firebase.FileStorage // nil when image storage is unavailable
+	table          *widget.Table
+	searchEntry    *widget.Entry
+	categoryFilter *widget.Select
+	selectedRows   []int // Track selected rows manually
+	stopWatch      func()
+	ctx            context.Context // cancelled by Close
+	cancel         context.CancelFunc
+
+	// Product lists are replaced by the snapshot listener goroutine and
+	// read by the table callbacks, so they are guarded by mu. The filter
+	// is copied from the widgets by their callbacks, the listener never
+	// reads the widgets itself.
+	mu               sync.RWMutex
 	products         []models.Product
 	filteredProducts []models.Product
-	selectedRows     []int // Track selected rows manually
+	searchText       string
+	category         string
 }
 
-// NewProductsScreen creates a new products screen
-func NewProductsScreen(w fyne.Window, fbClient *firebase.Client) *ProductsScreen {
+// NewProductsScreen creates a new products screen offering the actions
+// the role of user permits
+func NewProductsScreen(w fyne.Window, user *models.User, files firebase.FileStorage, productRepo repository.ProductRepository) *ProductsScreen {
+	ctx, cancel := context.WithCancel(context.Background())
 	screen := &ProductsScreen{
 		window:           w,
-		firebaseClient:   fbClient,
-		firestoreService: firebase.NewFirestoreService(fbClient),
+		user:             user,
+		ctx:              ctx,
+		cancel:           cancel,
+		files:            files,
+		productRepo:      productRepo,
 		products:         make([]models.Product, 0),
 		filteredProducts: make([]models.Product, 0),
 	}
 
-	// Initialize storage service if available
-	if fbClient.Storage != nil {
-		screen.storageService = firebase.NewStorageService(fbClient, "your-bucket-name") // Will be configured
-	}
-
 	screen.setupUI()
-	screen.loadProducts()
+	screen.watchProducts()
 	return screen
 }
 
+// watchProducts keeps the product list up to date with changes made on
+// any terminal. It falls back to a one-off load when watching fails.
+func (p *ProductsScreen) watchProducts() {
+	stop, err := p.productRepo.Watch(p.ctx, func(products []models.Product, err error) {
+		if err != nil {
+			if !repository.IsPartial(err) {
+				log.Printf("Product updates interrupted: %v", err)
+				return
+			}
+			log.Printf("Some products could not be loaded: %v", err)
+		}
+		p.setProducts(products)
+	})
+	if err != nil {
+		log.Printf("Live product updates unavailable: %v", err)
+		p.loadProducts()
+		return
+	}
+	p.stopWatch = stop
+}
+
+// Close stops live product updates and cancels pending requests
+func (p *ProductsScreen) Close() {
+	p.cancel()
+	if p.stopWatch != nil {
+		p.stopWatch()
+		p.stopWatch = nil
+	}
+}
+
 // setupUI sets up the products interface
 func (p *ProductsScreen) setupUI() {
 	// Create search and filter controls
 	p.searchEntry = widget.NewEntry()
 	p.searchEntry.SetPlaceHolder("Cari produk...")
 	p.searchEntry.OnChanged = func(text string) {
+		noteActivity()
+		p.mu.Lock()
+		p.searchText = text
+		p.mu.Unlock()
 		p.filterProducts()
 	}
 
 	categories := []string{"Semua", "Makanan", "Elektronik", "Fashion", "Kesehatan", "Rumah Tangga", "Alat Tulis", "Lainnya"}
 	p.categoryFilter = widget.NewSelect(categories, func(value string) {
+		p.mu.Lock()
+		p.category = value
+		p.mu.Unlock()
 		p.filterProducts()
 	})
 	p.categoryFilter.SetSelected("Semua")
@@ -75,6 +129,13 @@ func (p *ProductsScreen) setupUI() {
 		p.showEditProductDialog()
 	})
 
+	imageButton := widget.NewButton("Gambar", func() {
+		p.showImageDialog()
+	})
+	if p.files == nil {
+		imageButton.Disable()
+	}
+
 	deleteButton := widget.NewButton("Hapus", func() {
 		p.showDeleteProductDialog()
 	})
@@ -84,6 +145,15 @@ func (p *ProductsScreen) setupUI() {
 		p.Refresh()
 	})
 
+	if !p.user.Can(models.PermProductEdit) {
+		addButton.Hide()
+		editButton.Hide()
+		imageButton.Hide()
+	}
+	if !p.user.Can(models.PermProductDelete) {
+		deleteButton.Hide()
+	}
+
 	// Create controls container
 	controls := container.NewHBox(
 		widget.NewLabel("Cari:"),
@@ -93,6 +163,7 @@ func (p *ProductsScreen) setupUI() {
 		widget.NewSeparator(),
 		addButton,
 		editButton,
+		imageButton,
 		deleteButton,
 		refreshButton,
 	)
@@ -112,6 +183,8 @@ func (p *ProductsScreen) setupUI() {
 func (p *ProductsScreen) createTable() {
 	p.table = widget.NewTable(
 		func() (int, int) {
+			p.mu.RLock()
+			defer p.mu.RUnlock()
 			return len(p.filteredProducts) + 1, 7 // +1 for header, 7 columns
 		},
 		func() fyne.CanvasObject {
@@ -129,8 +202,8 @@ func (p *ProductsScreen) createTable() {
 				}
 			} else {
 				// Data rows
-				if id.Row-1 < len(p.filteredProducts) {
-					product := p.filteredProducts[id.Row-1]
+				product, ok := p.productAt(id.Row - 1)
+				if ok {
 					switch id.Col {
 					case 0:
 						label.SetText(product.ProductID)
@@ -166,6 +239,17 @@ func (p *ProductsScreen) createTable() {
 	p.table.SetColumnWidth(6, 80)  // Status
 }
 
+// productAt returns a copy of the filtered product at index
+func (p *ProductsScreen) productAt(index int) (models.Product, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if index < 0 || index >= len(p.filteredProducts) {
+		return models.Product{}, false
+	}
+	return p.filteredProducts[index], true
+}
+
 // ShowAddProductDialog shows the add product dialog
 func (p *ProductsScreen) ShowAddProductDialog() {
 	p.showProductDialog(nil)
@@ -178,13 +262,12 @@ func (p *ProductsScreen) showEditProductDialog() {
 		return
 	}
 
-	selectedRow := p.selectedRows[0] - 1 // -1 for header
-	if selectedRow < 0 || selectedRow >= len(p.filteredProducts) {
+	product, ok := p.productAt(p.selectedRows[0] - 1) // -1 for header
+	if !ok {
 		return
 	}
 
-	product := &p.filteredProducts[selectedRow]
-	p.showProductDialog(product)
+	p.showProductDialog(&product)
 }
 
 // showDeleteProductDialog shows the delete product confirmation
@@ -194,13 +277,11 @@ func (p *ProductsScreen) showDeleteProductDialog() {
 		return
 	}
 
-	selectedRow := p.selectedRows[0] - 1 // -1 for header
-	if selectedRow < 0 || selectedRow >= len(p.filteredProducts) {
+	product, ok := p.productAt(p.selectedRows[0] - 1) // -1 for header
+	if !ok {
 		return
 	}
 
-	product := p.filteredProducts[selectedRow]
-
 	dialog.ShowConfirm("Hapus Produk",
 		fmt.Sprintf("Apakah Anda yakin ingin menghapus produk '%s'?", product.Name),
 		func(confirm bool) {
@@ -210,6 +291,70 @@ func (p *ProductsScreen) showDeleteProductDialog() {
 		}, p.window)
 }
 
+// showImageDialog lets the user pick a new image for the selected product
+func (p *ProductsScreen) showImageDialog() {
+	if len(p.selectedRows) == 0 {
+		dialog.ShowInformation("Pilih Produk", "Silakan pilih produk yang ingin diberi gambar", p.window)
+		return
+	}
+
+	product, ok := p.productAt(p.selectedRows[0] - 1) // -1 for header
+	if !ok {
+		return
+	}
+
+	fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, p.window)
+			return
+		}
+		if reader == nil { // cancelled
+			return
+		}
+		p.setProductImage(product, reader)
+	}, p.window)
+	fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".jpg", ".jpeg", ".png", ".webp"}))
+	fileDialog.Show()
+}
+
+// setProductImage resizes and uploads an image with its thumbnail in the
+// background, then stores their URLs on the product. The previous image
+// files are deleted once the product points at the new ones.
+func (p *ProductsScreen) setProductImage(product models.Product, reader fyne.URIReadCloser) {
+	progress := dialog.NewProgressInfinite("Gambar Produk", "Mengunggah gambar...", p.window)
+	progress.Show()
+
+	go func() {
+		defer reader.Close()
+
+		uploaded, err := images.UploadProductImage(p.ctx, p.files, product.ProductID, reader)
+		if err != nil {
+			progress.Hide()
+			dialog.ShowError(fmt.Errorf("gagal mengunggah gambar: %s", models.UserMessage(err)), p.window)
+			return
+		}
+
+		oldPaths := []string{product.ImagePath, product.ThumbnailPath}
+		product.ImageURL = uploaded.URL
+		product.ImagePath = uploaded.Path
+		product.ThumbnailURL = uploaded.ThumbnailURL
+		product.ThumbnailPath = uploaded.ThumbnailPath
+		product.UpdatedAt = time.Now()
+
+		err = p.productRepo.Update(p.ctx, &product)
+		progress.Hide()
+		if err != nil {
+			images.RemoveProductImage(context.Background(), p.files, uploaded.Path, uploaded.ThumbnailPath)
+			dialog.ShowError(fmt.Errorf("gagal menyimpan gambar produk: %s", models.UserMessage(err)), p.window)
+			return
+		}
+		images.RemoveProductImage(context.Background(), p.files, oldPaths...)
+
+		dialog.ShowInformation("Sukses", "Gambar produk berhasil disimpan", p.window)
+		p.Refresh()
+	}()
+}
+
 // showProductDialog shows add/edit product dialog
 func (p *ProductsScreen) showProductDialog(product *models.Product) {
 	isEdit := product != nil
@@ -304,9 +449,9 @@ func (p *ProductsScreen) addProduct(name, priceStr, stockStr, category, barcode
 	}
 
 	// Save to Firestore
-	err = p.firestoreService.Create("products", product.ProductID, product)
+	err = p.productRepo.Create(p.ctx, &product)
 	if err != nil {
-		dialog.ShowError(fmt.Errorf("gagal menambah produk: %v", err), p.window)
+		dialog.ShowError(fmt.Errorf("gagal menambah produk: %s", models.UserMessage(err)), p.window)
 		return
 	}
 
@@ -343,9 +488,9 @@ func (p *ProductsScreen) updateProduct(product *models.Product, name, priceStr,
 	product.UpdatedAt = time.Now()
 
 	// Save to Firestore
-	err = p.firestoreService.Update("products", product.ProductID, *product)
+	err = p.productRepo.Update(p.ctx, product)
 	if err != nil {
-		dialog.ShowError(fmt.Errorf("gagal mengupdate produk: %v", err), p.window)
+		dialog.ShowError(fmt.Errorf("gagal mengupdate produk: %s", models.UserMessage(err)), p.window)
 		return
 	}
 
@@ -355,9 +500,9 @@ func (p *ProductsScreen) updateProduct(product *models.Product, name, priceStr,
 
 // deleteProduct deletes a product
 func (p *ProductsScreen) deleteProduct(productID string) {
-	err := p.firestoreService.Delete("products", productID)
+	err := p.productRepo.Delete(p.ctx, productID)
 	if err != nil {
-		dialog.ShowError(fmt.Errorf("gagal menghapus produk: %v", err), p.window)
+		dialog.ShowError(fmt.Errorf("gagal menghapus produk: %s", models.UserMessage(err)), p.window)
 		return
 	}
 
@@ -367,18 +512,34 @@ func (p *ProductsScreen) deleteProduct(productID string) {
 
 // loadProducts loads products from Firestore
 func (p *ProductsScreen) loadProducts() {
-	// This is a simplified implementation
-	// In a real app, you'd implement proper Firestore querying
-	p.products = make([]models.Product, 0)
-	p.filteredProducts = p.products
-	p.table.Refresh()
+	products, err := p.productRepo.List(p.ctx)
+	if err != nil {
+		if !repository.IsPartial(err) {
+			dialog.ShowError(fmt.Errorf("gagal memuat produk: %s", models.UserMessage(err)), p.window)
+			return
+		}
+		// Show the products that could be read, but keep a record of the rest
+		log.Printf("Some products could not be loaded: %v", err)
+	}
+
+	p.setProducts(products)
 }
 
-// filterProducts filters products based on search and category
-func (p *ProductsScreen) filterProducts() {
-	searchText := p.searchEntry.Text
-	selectedCategory := p.categoryFilter.Selected
+// setProducts replaces the product list and reapplies the filters
+func (p *ProductsScreen) setProducts(products []models.Product) {
+	p.mu.Lock()
+	p.products = products
+	p.mu.Unlock()
 
+	p.filterProducts()
+}
+
+// filterProducts filters products based on search and category. It may
+// run on the listener goroutine.
+func (p *ProductsScreen) filterProducts() {
+	p.mu.Lock()
+	searchText := p.searchText
+	selectedCategory := p.category
 	p.filteredProducts = make([]models.Product, 0)
 
 	for _, product := range p.products {
@@ -390,13 +551,15 @@ func (p *ProductsScreen) filterProducts() {
 		}
 
 		// Filter by category
-		if selectedCategory != "Semua" && product.Category != selectedCategory {
+		if selectedCategory != "" && selectedCategory != "Semua" && product.Category != selectedCategory {
 			continue
 		}
 
 		p.filteredProducts = append(p.filteredProducts, product)
 	}
+	p.mu.Unlock()
 
+	// Fyne widgets may be refreshed from any goroutine
 	p.table.Refresh()
 }
 
@@ -1,47 +1,59 @@
 package ui
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"sync"
 	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
 
-	"kasirnest/firebase"
 	"kasirnest/models"
+	"kasirnest/repository"
 	"kasirnest/utils"
 )
 
 // ReportsScreen represents the reports interface
 type ReportsScreen struct {
-	window           fyne.Window
-	container        *fyne.Container
-	firebaseClient   *firebase.Client
-	firestoreService *firebase.FirestoreService
+	window          fyne.Window
+	container       *fyne.Container
+	transactionRepo repository.TransactionRepository
+	ctx             context.Context // cancelled by Close
+	cancel          context.CancelFunc
 
 	// Report filters
 	dateFromEntry    *widget.Entry
 	dateToEntry      *widget.Entry
 	reportTypeSelect *widget.Select
+	generateButton   *widget.Button
+	cancelButton     *widget.Button
+	statusLabel      *widget.Label
 
 	// Report display
 	summaryCard    *widget.Card
 	chartContainer *fyne.Container
 	detailsTable   *widget.Table
 
-	// Data
+	// Data, replaced by the report loading goroutine
+	mu            sync.RWMutex
 	currentReport *models.Report
-	transactions  []models.Transaction
+	cancelLoad    context.CancelFunc
+	loadID        int // identifies the latest load, older results are dropped
 }
 
 // NewReportsScreen creates a new reports screen
-func NewReportsScreen(w fyne.Window, fbClient *firebase.Client) *ReportsScreen {
+func NewReportsScreen(w fyne.Window, transactionRepo repository.TransactionRepository) *ReportsScreen {
+	ctx, cancel := context.WithCancel(context.Background())
 	screen := &ReportsScreen{
-		window:           w,
-		firebaseClient:   fbClient,
-		firestoreService: firebase.NewFirestoreService(fbClient),
-		transactions:     make([]models.Transaction, 0),
+		window:          w,
+		transactionRepo: transactionRepo,
+		ctx:             ctx,
+		cancel:          cancel,
 	}
 
 	screen.setupUI()
@@ -67,6 +79,15 @@ func (r *ReportsScreen) setupUI() {
 	r.createDetailsTable()
 
 	// Create main layout
+	r.generateButton = widget.NewButton("Generate", func() {
+		r.generateReport()
+	})
+	r.cancelButton = widget.NewButton("Batal", func() {
+		r.cancelReport()
+	})
+	r.cancelButton.Hide()
+	r.statusLabel = widget.NewLabel("")
+
 	filtersContainer := container.NewHBox(
 		widget.NewLabel("Dari:"),
 		r.dateFromEntry,
@@ -74,12 +95,12 @@ func (r *ReportsScreen) setupUI() {
 		r.dateToEntry,
 		widget.NewLabel("Jenis:"),
 		r.reportTypeSelect,
-		widget.NewButton("Generate", func() {
-			r.generateReport()
-		}),
+		r.generateButton,
+		r.cancelButton,
 		widget.NewButton("Export", func() {
 			r.exportReport()
 		}),
+		r.statusLabel,
 	)
 
 	// Create top section with summary and chart
@@ -153,10 +174,11 @@ func (r *ReportsScreen) createSummaryCard() {
 func (r *ReportsScreen) createDetailsTable() {
 	r.detailsTable = widget.NewTable(
 		func() (int, int) {
-			if r.currentReport == nil {
+			report := r.report()
+			if report == nil {
 				return 1, 4 // Header only
 			}
-			return len(r.currentReport.TopProducts) + 1, 4 // +1 for header
+			return len(report.TopProducts) + 1, 4 // +1 for header
 		},
 		func() fyne.CanvasObject {
 			return widget.NewLabel("Cell")
@@ -171,10 +193,10 @@ func (r *ReportsScreen) createDetailsTable() {
 					label.SetText(headers[id.Col])
 					label.TextStyle = fyne.TextStyle{Bold: true}
 				}
-			} else if r.currentReport != nil {
+			} else if report := r.report(); report != nil {
 				// Data rows
-				if id.Row-1 < len(r.currentReport.TopProducts) {
-					product := r.currentReport.TopProducts[id.Row-1]
+				if id.Row-1 < len(report.TopProducts) {
+					product := report.TopProducts[id.Row-1]
 					switch id.Col {
 					case 0:
 						label.SetText(product.Name)
@@ -184,8 +206,8 @@ func (r *ReportsScreen) createDetailsTable() {
 						label.SetText(utils.FormatCurrency(product.TotalRevenue))
 					case 3:
 						percentage := 0.0
-						if r.currentReport.TotalSales > 0 {
-							percentage = (product.TotalRevenue / r.currentReport.TotalSales) * 100
+						if report.TotalSales > 0 {
+							percentage = (product.TotalRevenue / report.TotalSales) * 100
 						}
 						label.SetText(utils.FormatPercentage(percentage))
 					}
@@ -216,85 +238,137 @@ func (r *ReportsScreen) generateReport() {
 		return
 	}
 
-	// Load transactions for the date range
-	r.loadTransactionsForDateRange(dateFrom, dateTo)
-
-	// Generate report
-	r.currentReport = models.NewDailyReport(dateFrom, r.transactions)
-
-	// Update UI
-	r.updateSummaryCard()
-	r.detailsTable.Refresh()
+	r.startReport(dateFrom, dateTo)
 }
 
 // generateTodayReport generates today's report
 func (r *ReportsScreen) generateTodayReport() {
 	today := time.Now()
-	r.loadTransactionsForDateRange(today, today)
-	r.currentReport = models.NewDailyReport(today, r.transactions)
-	r.updateSummaryCard()
-	r.detailsTable.Refresh()
+	r.startReport(today, today)
 }
 
-// updateSummaryCard updates the summary card with current report data
-func (r *ReportsScreen) updateSummaryCard() {
-	if r.currentReport == nil {
-		return
+// startReport loads the report for the date range in the background,
+// replacing any report that is still loading
+func (r *ReportsScreen) startReport(dateFrom, dateTo time.Time) {
+	ctx, cancel := context.WithCancel(r.ctx)
+
+	r.mu.Lock()
+	if r.cancelLoad != nil {
+		r.cancelLoad()
+	}
+	r.cancelLoad = cancel
+	r.loadID++
+	loadID := r.loadID
+	r.mu.Unlock()
+
+	r.setLoading(true)
+	go func() {
+		defer cancel()
+
+		transactions, err := r.loadTransactionsForDateRange(ctx, dateFrom, dateTo)
+
+		var report *models.Report
+		if err == nil {
+			report = models.NewDailyReport(dateFrom, transactions)
+		}
+
+		r.mu.Lock()
+		if loadID != r.loadID {
+			// Cancelled by the user or replaced by a newer report
+			r.mu.Unlock()
+			return
+		}
+		r.cancelLoad = nil
+		if report != nil {
+			r.currentReport = report
+		}
+		r.mu.Unlock()
+
+		r.setLoading(false)
+		if err != nil {
+			message := models.UserMessage(err)
+			if errors.Is(err, models.ErrTimeout) {
+				message = "waktu memuat laporan habis, coba rentang tanggal yang lebih pendek"
+			}
+			dialog.ShowError(fmt.Errorf("gagal memuat transaksi: %s", message), r.window)
+			return
+		}
+
+		r.updateSummaryCard(report)
+		r.detailsTable.Refresh()
+	}()
+}
+
+// cancelReport cancels the report that is loading
+func (r *ReportsScreen) cancelReport() {
+	r.mu.Lock()
+	if r.cancelLoad != nil {
+		r.cancelLoad()
+		r.cancelLoad = nil
 	}
+	r.loadID++
+	r.mu.Unlock()
 
+	r.setLoading(false)
+	r.statusLabel.SetText("Dibatalkan")
+}
+
+// setLoading shows or hides the report loading state
+func (r *ReportsScreen) setLoading(loading bool) {
+	if loading {
+		r.generateButton.Disable()
+		r.cancelButton.Show()
+		r.statusLabel.SetText("Memuat laporan...")
+	} else {
+		r.generateButton.Enable()
+		r.cancelButton.Hide()
+		r.statusLabel.SetText("")
+	}
+}
+
+// report returns the current report
+func (r *ReportsScreen) report() *models.Report {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.currentReport
+}
+
+// updateSummaryCard updates the summary card with report data
+func (r *ReportsScreen) updateSummaryCard(report *models.Report) {
 	avgPerTransaction := 0.0
-	if r.currentReport.TotalTransactions > 0 {
-		avgPerTransaction = r.currentReport.TotalSales / float64(r.currentReport.TotalTransactions)
+	if report.TotalTransactions > 0 {
+		avgPerTransaction = report.TotalSales / float64(report.TotalTransactions)
 	}
 
 	totalProductsSold := 0
-	for _, product := range r.currentReport.TopProducts {
+	for _, product := range report.TopProducts {
 		totalProductsSold += product.TotalSold
 	}
 
 	content := container.NewVBox(
-		widget.NewLabel(fmt.Sprintf("Total Penjualan: %s", utils.FormatCurrency(r.currentReport.TotalSales))),
-		widget.NewLabel(fmt.Sprintf("Jumlah Transaksi: %d", r.currentReport.TotalTransactions)),
+		widget.NewLabel(fmt.Sprintf("Total Penjualan: %s", utils.FormatCurrency(report.TotalSales))),
+		widget.NewLabel(fmt.Sprintf("Jumlah Transaksi: %d", report.TotalTransactions)),
 		widget.NewLabel(fmt.Sprintf("Rata-rata per Transaksi: %s", utils.FormatCurrency(avgPerTransaction))),
 		widget.NewLabel(fmt.Sprintf("Produk Terjual: %d", totalProductsSold)),
 	)
 
-	r.summaryCard = widget.NewCard("Ringkasan Penjualan", "", content)
+	r.summaryCard.SetContent(content)
 }
 
 // loadTransactionsForDateRange loads transactions for specified date range
-func (r *ReportsScreen) loadTransactionsForDateRange(dateFrom, dateTo time.Time) {
-	// This is a simplified implementation
-	// In a real app, you'd query Firestore with date filters
-	r.transactions = make([]models.Transaction, 0)
-
-	// Create some dummy data for demonstration
-	if dateFrom.Format("2006-01-02") == time.Now().Format("2006-01-02") {
-		// Create sample transaction for today
-		sampleTransaction := models.Transaction{
-			TransID:       "sample_001",
-			Date:          time.Now(),
-			Total:         50000,
-			PaymentMethod: models.PaymentCash,
-			Items: []models.TransactionItem{
-				{
-					ProductID: "prod_001",
-					Name:      "Produk Demo A",
-					Quantity:  2,
-					Price:     15000,
-					Subtotal:  30000,
-				},
-				{
-					ProductID: "prod_002",
-					Name:      "Produk Demo B",
-					Quantity:  1,
-					Price:     20000,
-					Subtotal:  20000,
-				},
-			},
+func (r *ReportsScreen) loadTransactionsForDateRange(ctx context.Context, dateFrom, dateTo time.Time) ([]models.Transaction, error) {
+	start := time.Date(dateFrom.Year(), dateFrom.Month(), dateFrom.Day(), 0, 0, 0, 0, time.Local)
+	end := time.Date(dateTo.Year(), dateTo.Month(), dateTo.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, 1)
+
+	page, err := r.transactionRepo.List(ctx, repository.TransactionQuery{From: start, To: end})
+	if err != nil {
+		if !repository.IsPartial(err) {
+			return nil, err
 		}
-		r.transactions = append(r.transactions, sampleTransaction)
+		log.Printf("Some transactions could not be loaded: %v", err)
 	}
+
+	return page.Transactions, nil
 }
 
 // parseDate parses date string in DD/MM/YYYY format
@@ -304,7 +378,7 @@ func (r *ReportsScreen) parseDate(dateStr string) (time.Time, error) {
 
 // exportReport exports the current report
 func (r *ReportsScreen) exportReport() {
-	if r.currentReport == nil {
+	if r.report() == nil {
 		widget.NewLabel("Tidak ada data untuk diekspor").Show()
 		return
 	}
@@ -319,6 +393,11 @@ func (r *ReportsScreen) GetContainer() *fyne.Container {
 	return r.container
 }
 
+// Close cancels any report that is still loading
+func (r *ReportsScreen) Close() {
+	r.cancel()
+}
+
 // Refresh refreshes the reports data
 func (r *ReportsScreen) Refresh() {
 	r.generateReport()
@@ -0,0 +1,498 @@
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/widget"
+
+	"kasirnest/firebase"
+	"kasirnest/models"
+	"kasirnest/utils"
+)
+
+// sessionPref is the preference holding the encrypted session
+const sessionPref = "session"
+
+// sessionAAD binds the encrypted session to its purpose, so data encrypted
+// with the same key for something else is not accepted as a session
+var sessionAAD = []byte("kasirnest/session")
+
+// legacySessionPrefs held the session in plain text in older versions
+var legacySessionPrefs = []string{"user_id", "user_email", "user_name", "login_time", "refresh_token"}
+
+// Intervals of the session manager
+const (
+	sessionCheckInterval = 10 * time.Second // how often timeouts are checked
+	activitySaveInterval = time.Minute      // how often activity is written to disk
+)
+
+// LockReason says why the screen was locked
+type LockReason int
+
+// Lock reasons
+const (
+	LockManual  LockReason = iota // the cashier locked the screen
+	LockIdle                      // nobody used the app for the idle timeout
+	LockExpired                   // the session is older than its lifetime
+)
+
+// storedSession is the session saved between runs, encrypted as a whole
+type storedSession struct {
+	UID          string `json:"uid"`
+	Email        string `json:"email"`
+	DisplayName  string `json:"name"`
+	RefreshToken string `json:"refresh_token"`
+	LoginTime    int64  `json:"login_time"`
+	LastActivity int64  `json:"last_activity"`
+
+	// PasswordHash lets the signed in user unlock the screen while Firebase
+	// cannot be reached. Set after each online password check.
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+// SessionManager keeps the signed in session encrypted in the preferences
+// and locks the screen after a period without activity or once the
+// session is older than its lifetime. Cashiers may switch in with their PIN
+// while the session of the user who signed the terminal in stays active.
+type SessionManager struct {
+	key      string
+	sealer   *utils.EnvelopeKey // derived from key once, saving runs often
+	lifetime time.Duration      // from login until the password is asked again, zero for none
+	idle     time.Duration      // without activity until the screen locks, zero for never
+
+	mu           sync.Mutex
+	stored       *storedSession
+	cashier      *models.User // working on the terminal, nil for the signed in user
+	lastActivity time.Time
+	lastSaved    time.Time // when lastActivity was last written
+	locked       bool
+	lockReason   LockReason
+}
+
+// activeSessions is the session manager of the app, read by GetCurrentUser
+var (
+	activeSessionsMu sync.Mutex
+	activeSessions   *SessionManager
+)
+
+// NewSessionManager loads the session saved with key. lifetime and idle
+// are the absolute and idle timeouts, zero disables them.
+func NewSessionManager(key string, lifetime, idle time.Duration) *SessionManager {
+	m := &SessionManager{
+		key:      key,
+		lifetime: lifetime,
+		idle:     idle,
+	}
+
+	// Deriving the key is slow on purpose, do it once before the UI runs
+	// rather than whenever activity is saved
+	sealer, err := utils.NewEnvelopeKey(key)
+	if err != nil {
+		log.Printf("Failed to derive session key: %v", err)
+	}
+	m.sealer = sealer
+
+	prefs := fyne.CurrentApp().Preferences()
+	for _, name := range legacySessionPrefs {
+		prefs.RemoveValue(name)
+	}
+	if data := prefs.String(sessionPref); data != "" {
+		if err := m.load(data); err != nil {
+			log.Printf("Stored session unreadable, logging in again: %v", err)
+			prefs.RemoveValue(sessionPref)
+		}
+	}
+
+	activeSessionsMu.Lock()
+	activeSessions = m
+	activeSessionsMu.Unlock()
+	return m
+}
+
+// load decrypts a session saved by save
+func (m *SessionManager) load(data string) error {
+	plain, err := utils.DecryptStringWithAAD(data, m.key, sessionAAD)
+	if err != nil {
+		return err
+	}
+	stored := &storedSession{}
+	if err := json.Unmarshal([]byte(plain), stored); err != nil {
+		return err
+	}
+	m.stored = stored
+	m.lastActivity = time.Unix(stored.LastActivity, 0)
+	m.lastSaved = m.lastActivity
+	return nil
+}
+
+// save encrypts the session into the preferences. Must be called with mu
+// held.
+func (m *SessionManager) save() error {
+	m.stored.LastActivity = m.lastActivity.Unix()
+	data, err := json.Marshal(m.stored)
+	if err != nil {
+		return err
+	}
+	if m.sealer == nil {
+		sealer, err := utils.NewEnvelopeKey(m.key)
+		if err != nil {
+			return err
+		}
+		m.sealer = sealer
+	}
+	encrypted, err := m.sealer.EncryptString(string(data), sessionAAD)
+	if err != nil {
+		return err
+	}
+	fyne.CurrentApp().Preferences().SetString(sessionPref, encrypted)
+	m.lastSaved = m.lastActivity
+	return nil
+}
+
+// Start saves the session of a user who just entered their password
+func (m *SessionManager) Start(session *firebase.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.stored = &storedSession{LoginTime: now.Unix()}
+	m.cashier = nil
+	m.lastActivity = now
+	m.locked = false
+	m.setSession(session)
+	return m.save()
+}
+
+// Update saves a refreshed session, keeping its login time
+func (m *SessionManager) Update(session *firebase.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stored == nil || m.stored.UID != session.UID {
+		return nil // logged out or another user in the meantime
+	}
+	m.setSession(session)
+	return m.save()
+}
+
+// setSession copies the user and refresh token of session. Must be called
+// with mu held.
+func (m *SessionManager) setSession(session *firebase.Session) {
+	m.stored.UID = session.UID
+	m.stored.RefreshToken = session.RefreshToken
+	if session.Email != "" {
+		m.stored.Email = session.Email
+		m.stored.DisplayName = session.DisplayName
+	}
+}
+
+// Stored returns the saved session to resume, with only the user and its
+// refresh token set. Sessions past their lifetime are cleared; sessions
+// left idle for too long are resumed locked.
+func (m *SessionManager) Stored() (*firebase.Session, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stored == nil || m.stored.RefreshToken == "" {
+		return nil, false
+	}
+	if m.expired() {
+		m.clear()
+		return nil, false
+	}
+	if m.idleFor() {
+		m.locked = true
+		m.lockReason = LockIdle
+	}
+
+	return &firebase.Session{
+		UID:          m.stored.UID,
+		Email:        m.stored.Email,
+		DisplayName:  m.stored.DisplayName,
+		RefreshToken: m.stored.RefreshToken,
+	}, true
+}
+
+// expired reports whether the session is past its lifetime. Must be
+// called with mu held.
+func (m *SessionManager) expired() bool {
+	return m.lifetime > 0 && time.Since(time.Unix(m.stored.LoginTime, 0)) >= m.lifetime
+}
+
+// idleFor reports whether the session was unused for the idle timeout.
+// Must be called with mu held.
+func (m *SessionManager) idleFor() bool {
+	return m.idle > 0 && time.Since(m.lastActivity) >= m.idle
+}
+
+// Clear removes the saved session
+func (m *SessionManager) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clear()
+}
+
+// clear removes the saved session. Must be called with mu held.
+func (m *SessionManager) clear() {
+	m.stored = nil
+	m.cashier = nil
+	m.locked = false
+	fyne.CurrentApp().Preferences().RemoveValue(sessionPref)
+}
+
+// Current returns the user working on the terminal: the cashier who
+// switched in last, or else the signed in user
+func (m *SessionManager) Current() (uid, email, name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stored == nil {
+		return "", "", ""
+	}
+	if m.cashier != nil {
+		return m.cashier.UserID, m.cashier.Email, m.cashier.Name
+	}
+	return m.stored.UID, m.stored.Email, m.stored.DisplayName
+}
+
+// Owner returns the user who signed the terminal in
+func (m *SessionManager) Owner() (uid, email, name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stored == nil {
+		return "", "", ""
+	}
+	return m.stored.UID, m.stored.Email, m.stored.DisplayName
+}
+
+// Touch records activity, postponing the idle lock
+func (m *SessionManager) Touch() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stored == nil || m.locked {
+		return
+	}
+
+	m.lastActivity = time.Now()
+	if m.lastActivity.Sub(m.lastSaved) >= activitySaveInterval {
+		if err := m.save(); err != nil {
+			log.Printf("Failed to save session activity: %v", err)
+		}
+	}
+}
+
+// Lock locks the session until Unlock is called. It returns false when it
+// was already locked.
+func (m *SessionManager) Lock(reason LockReason) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stored == nil || m.locked {
+		return false
+	}
+	m.locked = true
+	m.lockReason = reason
+	return true
+}
+
+// Locked reports whether the session is locked and why
+func (m *SessionManager) Locked() (LockReason, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lockReason, m.locked
+}
+
+// Unlock unlocks the session with a session verified by the password of
+// the signed in user, which starts a new session lifetime and hands the
+// terminal back to them
+func (m *SessionManager) Unlock(session *firebase.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stored == nil {
+		return nil
+	}
+
+	now := time.Now()
+	m.stored.LoginTime = now.Unix()
+	m.cashier = nil
+	m.lastActivity = now
+	m.locked = false
+	m.setSession(session)
+	return m.save()
+}
+
+// RememberPassword caches a hash of the password of uid, just verified by
+// Firebase Auth, for CheckPassword
+func (m *SessionManager) RememberPassword(uid, password string) {
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		log.Printf("Failed to hash password for offline unlock: %v", err)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stored == nil || m.stored.UID != uid {
+		return
+	}
+	m.stored.PasswordHash = hash
+	if err := m.save(); err != nil {
+		log.Printf("Failed to save session: %v", err)
+	}
+}
+
+// CheckPassword checks a password of the signed in user against the hash
+// cached by RememberPassword, for unlocking while offline
+func (m *SessionManager) CheckPassword(password string) bool {
+	m.mu.Lock()
+	if m.stored == nil || m.stored.PasswordHash == "" {
+		m.mu.Unlock()
+		return false
+	}
+	uid, hash := m.stored.UID, m.stored.PasswordHash
+	m.mu.Unlock()
+
+	match, rehash := utils.VerifyPassword(password, hash)
+	if match && rehash {
+		m.RememberPassword(uid, password)
+	}
+	return match
+}
+
+// SwitchUser unlocks the session for a cashier whose PIN was checked. The
+// session lifetime is not extended, only a password does that.
+func (m *SessionManager) SwitchUser(cashier *models.User) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stored == nil {
+		return
+	}
+
+	m.cashier = cashier
+	if cashier.UserID == m.stored.UID {
+		m.cashier = nil
+	}
+	m.lastActivity = time.Now()
+	m.locked = false
+}
+
+// Watch calls onLock from a background goroutine whenever the idle
+// timeout or the session lifetime runs out, until ctx is cancelled
+func (m *SessionManager) Watch(ctx context.Context, onLock func(LockReason)) {
+	ticker := time.NewTicker(sessionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		m.mu.Lock()
+		var reason LockReason
+		lock := false
+		if m.stored != nil && !m.locked {
+			switch {
+			case m.expired():
+				reason, lock = LockExpired, true
+			case m.idleFor():
+				reason, lock = LockIdle, true
+			}
+		}
+		if lock {
+			m.locked = true
+			m.lockReason = reason
+		}
+		m.mu.Unlock()
+
+		if lock {
+			onLock(reason)
+		}
+	}
+}
+
+// TrackActivity returns content wrapped so that moving the mouse over it
+// counts as activity
+func (m *SessionManager) TrackActivity(content fyne.CanvasObject) fyne.CanvasObject {
+	return newActivityArea(content, m.Touch)
+}
+
+// activityArea reports mouse movement over its content. Hover events go to
+// the innermost hoverable object, so it only sees movement over parts of
+// the content that do not react to the mouse themselves, which is enough
+// to notice someone is using the app.
+type activityArea struct {
+	widget.BaseWidget
+	content    fyne.CanvasObject
+	onActivity func()
+}
+
+var _ desktop.Hoverable = (*activityArea)(nil)
+
+// newActivityArea creates an activity area around content
+func newActivityArea(content fyne.CanvasObject, onActivity func()) *activityArea {
+	area := &activityArea{content: content, onActivity: onActivity}
+	area.ExtendBaseWidget(area)
+	return area
+}
+
+// CreateRenderer implements fyne.Widget
+func (a *activityArea) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(a.content)
+}
+
+// MouseIn implements desktop.Hoverable
+func (a *activityArea) MouseIn(*desktop.MouseEvent) { a.onActivity() }
+
+// MouseMoved implements desktop.Hoverable
+func (a *activityArea) MouseMoved(*desktop.MouseEvent) { a.onActivity() }
+
+// MouseOut implements desktop.Hoverable
+func (a *activityArea) MouseOut() {}
+
+// noteActivity records activity in screens where cashiers mostly type or
+// scan, which the activity area does not see
+func noteActivity() {
+	activeSessionsMu.Lock()
+	m := activeSessions
+	activeSessionsMu.Unlock()
+	if m != nil {
+		m.Touch()
+	}
+}
+
+// rememberPassword caches the password of a user who just logged in
+func rememberPassword(uid, password string) {
+	activeSessionsMu.Lock()
+	m := activeSessions
+	activeSessionsMu.Unlock()
+	if m != nil {
+		m.RememberPassword(uid, password)
+	}
+}
+
+// GetCurrentUser returns current logged-in user info
+func GetCurrentUser() (uid, email, name string) {
+	activeSessionsMu.Lock()
+	m := activeSessions
+	activeSessionsMu.Unlock()
+	if m == nil {
+		return "", "", ""
+	}
+	return m.Current()
+}
+
+// ClearSession clears user session
+func ClearSession() {
+	activeSessionsMu.Lock()
+	m := activeSessions
+	activeSessionsMu.Unlock()
+	if m != nil {
+		m.Clear()
+	}
+}
@@ -0,0 +1,521 @@
+package ui
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"kasirnest/models"
+	"kasirnest/repository"
+	"kasirnest/utils"
+)
+
+// terminalPref stores the ID that tells the shifts of this terminal apart
+const terminalPref = "terminal_id"
+
+// shiftHistoryDays is how far back the shift history goes
+const shiftHistoryDays = 30
+
+// paymentLabels names the payment methods on the shift summary
+var paymentLabels = map[string]string{
+	models.PaymentCash:    "Tunai",
+	models.PaymentCard:    "Kartu",
+	models.PaymentDigital: "Digital",
+}
+
+// TerminalID returns the ID of this terminal, creating it on first use
+func TerminalID() string {
+	prefs := fyne.CurrentApp().Preferences()
+	if id := prefs.String(terminalPref); id != "" {
+		return id
+	}
+
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		log.Printf("Failed to generate terminal ID: %v", err)
+		return "terminal"
+	}
+	id := hex.EncodeToString(buf)
+	prefs.SetString(terminalPref, id)
+	return id
+}
+
+// ShiftScreen opens and closes the cashier shift of this terminal
+type ShiftScreen struct {
+	window          fyne.Window
+	container       *fyne.Container
+	user            *models.User
+	shiftRepo       repository.ShiftRepository
+	transactionRepo repository.TransactionRepository
+	terminalID      string
+	onChange        func(*models.Shift)
+	ctx             context.Context // cancelled by Close
+	cancel          context.CancelFunc
+
+	statusLabel  *widget.Label
+	openButton   *widget.Button
+	closeButton  *widget.Button
+	historyList  *widget.List
+	mu           sync.Mutex
+	current      *models.Shift // nil while no shift is open
+	history      []models.Shift
+	historyShown bool
+}
+
+// NewShiftScreen creates the shift screen of this terminal. onChange is
+// called with the open shift, or nil, whenever it changes.
+func NewShiftScreen(w fyne.Window, user *models.User, repos *repository.Repositories, onChange func(*models.Shift)) *ShiftScreen {
+	ctx, cancel := context.WithCancel(context.Background())
+	screen := &ShiftScreen{
+		window:          w,
+		user:            user,
+		shiftRepo:       repos.Shifts,
+		transactionRepo: repos.Transactions,
+		terminalID:      TerminalID(),
+		onChange:        onChange,
+		ctx:             ctx,
+		cancel:          cancel,
+		historyShown:    user.Can(models.PermReportView),
+	}
+
+	screen.setupUI()
+	go screen.Refresh()
+	return screen
+}
+
+// setupUI sets up the shift interface
+func (s *ShiftScreen) setupUI() {
+	s.statusLabel = widget.NewLabel("Memuat shift...")
+	s.statusLabel.Wrapping = fyne.TextWrapWord
+
+	s.openButton = widget.NewButtonWithIcon("Buka Shift", theme.ContentAddIcon(), s.showOpenDialog)
+	s.openButton.Importance = widget.HighImportance
+	s.closeButton = widget.NewButtonWithIcon("Tutup Shift", theme.ConfirmIcon(), s.showCloseDialog)
+	s.openButton.Disable()
+	s.closeButton.Disable()
+
+	status := widget.NewCard("Shift Saat Ini", "Kasir "+s.terminalID, container.NewVBox(
+		s.statusLabel,
+		container.NewHBox(s.openButton, s.closeButton),
+	))
+
+	if !s.historyShown {
+		s.container = container.NewVBox(status)
+		return
+	}
+
+	s.historyList = widget.NewList(
+		func() int {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return len(s.history)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("Shift")
+		},
+		func(id widget.ListItemID, object fyne.CanvasObject) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if id < len(s.history) {
+				object.(*widget.Label).SetText(shiftLine(&s.history[id]))
+			}
+		},
+	)
+	s.historyList.OnSelected = func(id widget.ListItemID) {
+		s.historyList.Unselect(id)
+		s.mu.Lock()
+		if id >= len(s.history) {
+			s.mu.Unlock()
+			return
+		}
+		shift := s.history[id]
+		s.mu.Unlock()
+		s.showSummary(&shift)
+	}
+
+	s.container = container.NewBorder(
+		container.NewVBox(status, widget.NewLabel(fmt.Sprintf("Riwayat Shift (%d hari terakhir):", shiftHistoryDays))),
+		nil, nil, nil,
+		s.historyList,
+	)
+}
+
+// Refresh loads the open shift of this terminal and the shift history
+func (s *ShiftScreen) Refresh() {
+	shift, err := s.shiftRepo.Current(s.ctx, s.terminalID)
+	if s.ctx.Err() != nil {
+		return
+	}
+	if err != nil && !errors.Is(err, models.ErrNoOpenShift) {
+		log.Printf("Failed to load current shift: %v", err)
+	}
+	s.setCurrent(shift)
+
+	if !s.historyShown {
+		return
+	}
+	to := time.Now().Add(time.Minute)
+	history, err := s.shiftRepo.List(s.ctx, to.AddDate(0, 0, -shiftHistoryDays), to)
+	if s.ctx.Err() != nil {
+		return
+	}
+	if err != nil && !repository.IsPartial(err) {
+		log.Printf("Failed to load shift history: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	s.history = history
+	s.mu.Unlock()
+	s.historyList.Refresh()
+}
+
+// Current returns the open shift of this terminal, or nil
+func (s *ShiftScreen) Current() *models.Shift {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == nil {
+		return nil
+	}
+	shift := *s.current
+	return &shift
+}
+
+// setCurrent shows the open shift and tells the POS about it
+func (s *ShiftScreen) setCurrent(shift *models.Shift) {
+	s.mu.Lock()
+	s.current = shift
+	s.mu.Unlock()
+
+	if shift == nil {
+		s.statusLabel.SetText("Belum ada shift yang dibuka di kasir ini.")
+		s.openButton.Enable()
+		s.closeButton.Disable()
+	} else {
+		s.statusLabel.SetText(fmt.Sprintf("Dibuka %s oleh %s\nModal awal: %s",
+			utils.FormatDateTimeShort(shift.OpenedAt), shiftUser(shift.OpenedByName, shift.OpenedBy), utils.FormatCurrency(shift.OpeningCash)))
+		s.openButton.Disable()
+		s.closeButton.Enable()
+	}
+
+	if s.onChange != nil {
+		s.onChange(shift)
+	}
+}
+
+// showOpenDialog asks for the cash in the drawer and opens a shift
+func (s *ShiftScreen) showOpenDialog() {
+	if s.Current() != nil {
+		dialog.ShowError(errors.New(models.UserMessage(models.ErrShiftOpen)), s.window)
+		return
+	}
+
+	cashEntry := widget.NewEntry()
+	cashEntry.SetPlaceHolder("0")
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Modal Awal (Rp)", cashEntry),
+	}
+	dialog.ShowForm("Buka Shift", "Buka", "Batal", items, func(confirm bool) {
+		if !confirm {
+			return
+		}
+
+		openingCash := 0.0
+		if text := strings.TrimSpace(cashEntry.Text); text != "" {
+			amount, err := utils.ParseCurrency(text)
+			if err != nil {
+				dialog.ShowError(errors.New(models.UserMessage(models.ErrInvalidAmount)), s.window)
+				return
+			}
+			openingCash = amount
+		}
+		go s.openShift(openingCash)
+	}, s.window)
+}
+
+// openShift opens a shift for the cashier working on the terminal
+func (s *ShiftScreen) openShift(openingCash float64) {
+	userID, _, userName := GetCurrentUser()
+	shift, err := models.NewShift(s.terminalID, userID, userName, openingCash)
+	if err == nil {
+		err = s.shiftRepo.Save(s.ctx, shift)
+	}
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("gagal membuka shift: %s", models.UserMessage(err)), s.window)
+		return
+	}
+
+	log.Printf("Shift %s opened on terminal %s", shift.ShiftID, s.terminalID)
+	s.setCurrent(shift)
+	s.Refresh()
+}
+
+// showCloseDialog asks for the notes and coins counted in the drawer
+func (s *ShiftScreen) showCloseDialog() {
+	if s.Current() == nil {
+		dialog.ShowError(errors.New(models.UserMessage(models.ErrNoOpenShift)), s.window)
+		return
+	}
+
+	totalLabel := widget.NewLabel("Total dihitung: Rp 0")
+	totalLabel.TextStyle = fyne.TextStyle{Bold: true}
+
+	entries := make([]*widget.Entry, len(models.Denominations))
+	grid := container.NewGridWithColumns(2)
+	for i, denomination := range models.Denominations {
+		entry := widget.NewEntry()
+		entry.SetPlaceHolder("0")
+		entry.OnChanged = func(string) {
+			counts, err := cashCounts(entries)
+			if err != nil {
+				totalLabel.SetText("Total dihitung: -")
+				return
+			}
+			totalLabel.SetText("Total dihitung: " + utils.FormatCurrency(models.TotalCash(counts)))
+		}
+		entries[i] = entry
+		grid.Add(widget.NewLabel(utils.FormatCurrency(float64(denomination))))
+		grid.Add(entry)
+	}
+
+	content := container.NewVBox(
+		widget.NewLabel("Hitung uang di laci, isi jumlah lembar atau keping:"),
+		grid,
+		widget.NewSeparator(),
+		totalLabel,
+	)
+	closeDialog := dialog.NewCustomConfirm("Tutup Shift", "Tutup Shift", "Batal", container.NewVScroll(content), func(confirm bool) {
+		if !confirm {
+			return
+		}
+
+		counts, err := cashCounts(entries)
+		if err != nil {
+			dialog.ShowError(errors.New(models.UserMessage(err)), s.window)
+			return
+		}
+		go s.closeShift(counts)
+	}, s.window)
+	closeDialog.Resize(fyne.NewSize(400, 560))
+	closeDialog.Show()
+}
+
+// cashCounts reads the counted notes and coins, one entry per denomination
+func cashCounts(entries []*widget.Entry) ([]models.CashCount, error) {
+	counts := make([]models.CashCount, 0, len(entries))
+	for i, entry := range entries {
+		text := strings.TrimSpace(entry.Text)
+		if text == "" {
+			continue
+		}
+		count, err := strconv.Atoi(text)
+		if err != nil || count < 0 {
+			return nil, models.ErrInvalidAmount
+		}
+		if count > 0 {
+			counts = append(counts, models.CashCount{Denomination: models.Denominations[i], Count: count})
+		}
+	}
+	return counts, nil
+}
+
+// closeShift closes the open shift with the counted cash and shows its
+// summary
+func (s *ShiftScreen) closeShift(counts []models.CashCount) {
+	shift := s.Current()
+	if shift == nil {
+		return
+	}
+
+	progress := dialog.NewProgressInfinite("Tutup Shift", "Menghitung penjualan shift...", s.window)
+	progress.Show()
+
+	sales, err := s.shiftSales(shift.ShiftID)
+	if err == nil {
+		userID, _, userName := GetCurrentUser()
+		err = shift.Close(userID, userName, counts, sales)
+	}
+	if err == nil {
+		err = s.shiftRepo.Save(s.ctx, shift)
+	}
+	progress.Hide()
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("gagal menutup shift: %s", models.UserMessage(err)), s.window)
+		return
+	}
+
+	log.Printf("Shift %s closed, variance %.2f", shift.ShiftID, shift.Variance)
+	s.setCurrent(nil)
+	s.showSummary(shift)
+	s.Refresh()
+}
+
+// shiftSales loads every transaction recorded in a shift
+func (s *ShiftScreen) shiftSales(shiftID string) ([]models.Transaction, error) {
+	sales := make([]models.Transaction, 0)
+	query := repository.TransactionQuery{ShiftID: shiftID, Limit: historyPageSize}
+	for {
+		page, err := s.transactionRepo.List(s.ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		sales = append(sales, page.Transactions...)
+		if page.NextPageToken == "" {
+			return sales, nil
+		}
+		query.PageToken = page.NextPageToken
+	}
+}
+
+// showSummary shows the printable summary of a shift
+func (s *ShiftScreen) showSummary(shift *models.Shift) {
+	report := shiftReport(shift)
+
+	text := widget.NewLabel(report)
+	text.TextStyle = fyne.TextStyle{Monospace: true}
+
+	copyButton := widget.NewButtonWithIcon("Salin", theme.ContentCopyIcon(), func() {
+		s.window.Clipboard().SetContent(report)
+	})
+	saveButton := widget.NewButtonWithIcon("Simpan untuk Dicetak", theme.DocumentSaveIcon(), func() {
+		s.saveReport(shift.ShiftID, report)
+	})
+
+	content := container.NewBorder(nil, container.NewHBox(copyButton, saveButton), nil, nil, container.NewVScroll(text))
+	summaryDialog := dialog.NewCustom("Ringkasan Shift", "Tutup", content, s.window)
+	summaryDialog.Resize(fyne.NewSize(520, 600))
+	summaryDialog.Show()
+}
+
+// saveReport writes the shift summary to a text file for printing
+func (s *ShiftScreen) saveReport(shiftID, report string) {
+	saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, s.window)
+			return
+		}
+		if writer == nil { // cancelled
+			return
+		}
+		defer writer.Close()
+
+		if _, err := writer.Write([]byte(report)); err != nil {
+			dialog.ShowError(fmt.Errorf("gagal menyimpan ringkasan: %v", err), s.window)
+		}
+	}, s.window)
+	saveDialog.SetFileName(shiftID + ".txt")
+	saveDialog.SetFilter(storage.NewExtensionFileFilter([]string{".txt"}))
+	saveDialog.Show()
+}
+
+// shiftLine describes a shift in the history list
+func shiftLine(shift *models.Shift) string {
+	if shift.IsOpen() {
+		return fmt.Sprintf("%s  %s  masih dibuka", utils.FormatDateTimeShort(shift.OpenedAt), shift.TerminalID)
+	}
+	return fmt.Sprintf("%s - %s  %s  %d transaksi  %s  selisih %s",
+		utils.FormatDateTimeShort(shift.OpenedAt), utils.FormatTime(shift.ClosedAt), shift.TerminalID,
+		shift.SalesCount, utils.FormatCurrency(shift.SalesTotal), formatVariance(shift.Variance))
+}
+
+// shiftUser returns the name of a user stored on a shift, or their ID for
+// shifts saved before names were kept
+func shiftUser(name, userID string) string {
+	if name != "" {
+		return name
+	}
+	return userID
+}
+
+// shiftReport formats a closed shift as plain text for printing
+func shiftReport(shift *models.Shift) string {
+	const width = 42
+	var b strings.Builder
+	line := func(label, value string) {
+		fmt.Fprintf(&b, "%-*s%s\n", width-len(value), label, value)
+	}
+	rule := strings.Repeat("-", width) + "\n"
+
+	b.WriteString("RINGKASAN SHIFT\n")
+	b.WriteString(rule)
+	line("Shift", shift.ShiftID)
+	line("Kasir", shift.TerminalID)
+	line("Dibuka", utils.FormatDateTimeShort(shift.OpenedAt))
+	line("Oleh", shiftUser(shift.OpenedByName, shift.OpenedBy))
+	if shift.IsOpen() {
+		b.WriteString(rule)
+		line("Modal awal", utils.FormatCurrency(shift.OpeningCash))
+		b.WriteString("Shift masih dibuka.\n")
+		return b.String()
+	}
+	line("Ditutup", utils.FormatDateTimeShort(shift.ClosedAt))
+	line("Oleh", shiftUser(shift.ClosedByName, shift.ClosedBy))
+
+	b.WriteString(rule)
+	b.WriteString("PENJUALAN PER METODE BAYAR\n")
+	for _, payment := range shift.Payments {
+		label := paymentLabels[payment.Method]
+		if label == "" {
+			label = payment.Method
+		}
+		line(fmt.Sprintf("%-10s %4d trx", label, payment.Count), utils.FormatCurrency(payment.Total))
+	}
+	line(fmt.Sprintf("%-10s %4d trx", "Total", shift.SalesCount), utils.FormatCurrency(shift.SalesTotal))
+
+	b.WriteString(rule)
+	b.WriteString("KAS\n")
+	line("Modal awal", utils.FormatCurrency(shift.OpeningCash))
+	line("Penjualan tunai", utils.FormatCurrency(shift.ExpectedCash-shift.OpeningCash))
+	line("Kas seharusnya", utils.FormatCurrency(shift.ExpectedCash))
+	line("Kas dihitung", utils.FormatCurrency(shift.CountedCash))
+	line("Selisih", formatVariance(shift.Variance))
+
+	if len(shift.CashCounts) > 0 {
+		b.WriteString(rule)
+		b.WriteString("RINCIAN UANG\n")
+		for _, count := range shift.CashCounts {
+			line(fmt.Sprintf("%s x %d", utils.FormatCurrency(float64(count.Denomination)), count.Count),
+				utils.FormatCurrency(float64(count.Denomination)*float64(count.Count)))
+		}
+	}
+	b.WriteString(rule)
+	return b.String()
+}
+
+// formatVariance formats the difference between counted and expected cash
+func formatVariance(variance float64) string {
+	switch {
+	case variance > 0:
+		return "+" + utils.FormatCurrency(variance) + " (lebih)"
+	case variance < 0:
+		return "-" + utils.FormatCurrency(math.Abs(variance)) + " (kurang)"
+	default:
+		return utils.FormatCurrency(0)
+	}
+}
+
+// GetContainer returns the shift container
+func (s *ShiftScreen) GetContainer() *fyne.Container {
+	return s.container
+}
+
+// Close cancels pending requests
+func (s *ShiftScreen) Close() {
+	s.cancel()
+}
@@ -0,0 +1,232 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"kasirnest/firebase"
+	"kasirnest/images"
+	"kasirnest/models"
+	"kasirnest/repository"
+	"kasirnest/utils"
+)
+
+// StorageScreen finds product images no product uses and deletes them
+type StorageScreen struct {
+	window      fyne.Window
+	container   *fyne.Container
+	files       firebase.FileStorage
+	productRepo repository.ProductRepository
+	ctx         context.Context // cancelled by Close
+	cancel      context.CancelFunc
+	statusLabel *widget.Label
+	scanBtn     *widget.Button
+	deleteBtn   *widget.Button
+	orphanList  *widget.Table
+
+	// Result of the last scan, replaced by the scanning goroutine
+	mu     sync.RWMutex
+	report *images.OrphanReport
+}
+
+// NewStorageScreen creates a new storage screen.
+// files may be nil when image storage is not available.
+func NewStorageScreen(w fyne.Window, files firebase.FileStorage, productRepo repository.ProductRepository) *StorageScreen {
+	ctx, cancel := context.WithCancel(context.Background())
+	screen := &StorageScreen{
+		window:      w,
+		files:       files,
+		productRepo: productRepo,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+
+	screen.setupUI()
+	return screen
+}
+
+// setupUI sets up the storage interface
+func (s *StorageScreen) setupUI() {
+	if s.files == nil {
+		s.container = container.NewVBox(widget.NewLabel("Penyimpanan gambar tidak tersedia, periksa bagian [storage] di app.ini"))
+		return
+	}
+
+	s.statusLabel = widget.NewLabel("Pindai untuk mencari gambar produk yang tidak terpakai.")
+	s.scanBtn = widget.NewButtonWithIcon("Pindai", theme.SearchIcon(), func() {
+		s.scan()
+	})
+	s.deleteBtn = widget.NewButtonWithIcon("Hapus Semua", theme.DeleteIcon(), func() {
+		s.confirmDelete()
+	})
+	s.deleteBtn.Importance = widget.DangerImportance
+	s.deleteBtn.Disable()
+	s.createOrphanList()
+
+	s.container = container.NewBorder(
+		container.NewVBox(
+			container.NewHBox(s.scanBtn, s.deleteBtn),
+			s.statusLabel,
+			widget.NewSeparator(),
+		),
+		nil, nil, nil,
+		s.orphanList,
+	)
+}
+
+// createOrphanList creates the table of unused images
+func (s *StorageScreen) createOrphanList() {
+	s.orphanList = widget.NewTable(
+		func() (int, int) {
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+			if s.report == nil {
+				return 1, 2
+			}
+			return len(s.report.Orphans) + 1, 2 // +1 for header
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("Cell")
+		},
+		func(id widget.TableCellID, cell fyne.CanvasObject) {
+			label := cell.(*widget.Label)
+
+			if id.Row == 0 {
+				headers := []string{"File", "Ukuran"}
+				label.SetText(headers[id.Col])
+				label.TextStyle = fyne.TextStyle{Bold: true}
+				return
+			}
+
+			label.TextStyle = fyne.TextStyle{}
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+			if s.report == nil || id.Row-1 >= len(s.report.Orphans) {
+				label.SetText("")
+				return
+			}
+
+			orphan := s.report.Orphans[id.Row-1]
+			switch id.Col {
+			case 0:
+				label.SetText(orphan.Path)
+			case 1:
+				label.SetText(utils.FormatFileSize(orphan.Size))
+			}
+		},
+	)
+	s.orphanList.SetColumnWidth(0, 420)
+	s.orphanList.SetColumnWidth(1, 100)
+}
+
+// scan compares the stored images with the products in the background
+func (s *StorageScreen) scan() {
+	s.scanBtn.Disable()
+	s.deleteBtn.Disable()
+	s.statusLabel.SetText("Memindai gambar produk...")
+
+	go func() {
+		report, err := s.findOrphans()
+		if s.ctx.Err() != nil {
+			return
+		}
+		s.scanBtn.Enable()
+		if err != nil {
+			s.statusLabel.SetText("")
+			dialog.ShowError(fmt.Errorf("gagal memindai gambar: %s", models.UserMessage(err)), s.window)
+			return
+		}
+		s.showReport(report)
+	}()
+}
+
+// findOrphans loads every product and lists the images none of them uses
+func (s *StorageScreen) findOrphans() (*images.OrphanReport, error) {
+	products, err := s.productRepo.List(s.ctx)
+	if err != nil {
+		// With products missing their images would look unused
+		if repository.IsPartial(err) {
+			return nil, fmt.Errorf("tidak semua produk dapat dimuat, coba lagi nanti")
+		}
+		return nil, err
+	}
+	return images.FindOrphans(s.ctx, s.files, products)
+}
+
+// showReport shows the result of a scan
+func (s *StorageScreen) showReport(report *images.OrphanReport) {
+	s.mu.Lock()
+	s.report = report
+	s.mu.Unlock()
+	s.orphanList.Refresh()
+
+	if len(report.Orphans) == 0 {
+		s.deleteBtn.Disable()
+		s.statusLabel.SetText(fmt.Sprintf("%d file diperiksa, tidak ada gambar yang tidak terpakai.", report.Scanned))
+		return
+	}
+	s.deleteBtn.Enable()
+	s.statusLabel.SetText(fmt.Sprintf("%d dari %d file tidak terpakai (%s).",
+		len(report.Orphans), report.Scanned, utils.FormatFileSize(report.Bytes())))
+}
+
+// confirmDelete asks before deleting the images found by the last scan
+func (s *StorageScreen) confirmDelete() {
+	s.mu.RLock()
+	report := s.report
+	s.mu.RUnlock()
+	if report == nil || len(report.Orphans) == 0 {
+		return
+	}
+
+	dialog.ShowConfirm("Hapus Gambar",
+		fmt.Sprintf("Hapus %d gambar tidak terpakai (%s)? Tindakan ini tidak dapat dibatalkan.",
+			len(report.Orphans), utils.FormatFileSize(report.Bytes())),
+		func(confirm bool) {
+			if confirm {
+				s.delete(report)
+			}
+		}, s.window)
+}
+
+// delete removes the images of report in the background
+func (s *StorageScreen) delete(report *images.OrphanReport) {
+	s.scanBtn.Disable()
+	s.deleteBtn.Disable()
+	s.statusLabel.SetText("Menghapus gambar...")
+
+	go func() {
+		deleted, err := images.DeleteOrphans(s.ctx, s.files, report)
+		if s.ctx.Err() != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.report = nil
+		s.mu.Unlock()
+		s.orphanList.Refresh()
+		s.scanBtn.Enable()
+		s.statusLabel.SetText(fmt.Sprintf("%d gambar dihapus.", deleted))
+
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("sebagian gambar gagal dihapus: %s", models.UserMessage(err)), s.window)
+		}
+	}()
+}
+
+// Close stops updating the screen and cancels a running scan
+func (s *StorageScreen) Close() {
+	s.cancel()
+}
+
+// GetContainer returns the storage container
+func (s *StorageScreen) GetContainer() *fyne.Container {
+	return s.container
+}
@@ -1,7 +1,12 @@
 package ui
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"fyne.io/fyne/v2"
@@ -9,46 +14,107 @@ import (
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
 
-	"kasirnest/firebase"
+	"kasirnest/images"
 	"kasirnest/models"
+	"kasirnest/repository"
 	"kasirnest/utils"
 )
 
 // TransactionsScreen represents the transactions interface
 type TransactionsScreen struct {
-	window           fyne.Window
-	container        *fyne.Container
-	firebaseClient   *firebase.Client
-	firestoreService *firebase.FirestoreService
-	tabs             *container.DocTabs
+	window          fyne.Window
+	container       *fyne.Container
+	productRepo     repository.ProductRepository
+	transactionRepo repository.TransactionRepository
+	tabs            *container.DocTabs
+	ctx             context.Context // cancelled by Close
+	cancel          context.CancelFunc
+
+	// Shift tab, sales are only recorded while a shift is open
+	shiftScreen *ShiftScreen
+	shiftLabel  *widget.Label
 
 	// POS (New Transaction) tab
 	posContainer       *fyne.Container
 	productSearch      *widget.Entry
+	productGrid        *productGrid
 	cartTable          *widget.Table
 	totalLabel         *widget.Label
 	currentTransaction *models.Transaction
+	productsMu         sync.RWMutex
+	products           []models.Product // kept current by the product listener
+	searchText         string           // copied from productSearch, read by the listener
+	stopWatch          func()
 
 	// Transaction History tab
 	historyContainer *fyne.Container
 	historyTable     *widget.Table
+	historyMu        sync.Mutex
 	transactions     []models.Transaction
+	historyFrom      time.Time
+	historyTo        time.Time
+	nextPageToken    string
+	loadingHistory   bool
 }
 
-// NewTransactionsScreen creates a new transactions screen
-func NewTransactionsScreen(w fyne.Window, fbClient *firebase.Client) *TransactionsScreen {
+// historyPageSize is the number of transactions loaded per history page
+const historyPageSize = 50
+
+// NewTransactionsScreen creates a new transactions screen for user.
+// imageCache may be nil, products are then shown without photos.
+func NewTransactionsScreen(w fyne.Window, user *models.User, repos *repository.Repositories, imageCache *images.Cache) *TransactionsScreen {
+	ctx, cancel := context.WithCancel(context.Background())
 	screen := &TransactionsScreen{
-		window:           w,
-		firebaseClient:   fbClient,
-		firestoreService: firebase.NewFirestoreService(fbClient),
-		transactions:     make([]models.Transaction, 0),
+		window:          w,
+		ctx:             ctx,
+		cancel:          cancel,
+		productRepo:     repos.Products,
+		transactionRepo: repos.Transactions,
+		transactions:    make([]models.Transaction, 0),
 	}
+	screen.productGrid = newProductGrid(ctx, imageCache, func(product models.Product) {
+		screen.addToCart(product)
+	})
+	screen.shiftLabel = widget.NewLabel("Memuat shift...")
+	screen.shiftScreen = NewShiftScreen(w, user, repos, screen.showShift)
 
 	screen.setupUI()
+	screen.watchProducts()
 	screen.loadTransactions()
 	return screen
 }
 
+// watchProducts keeps the POS product cache in sync with stock and price
+// changes made on any terminal
+func (t *TransactionsScreen) watchProducts() {
+	stop, err := t.productRepo.Watch(t.ctx, func(products []models.Product, err error) {
+		if err != nil {
+			if !repository.IsPartial(err) {
+				log.Printf("Product updates interrupted: %v", err)
+				return
+			}
+			log.Printf("Some products could not be loaded: %v", err)
+		}
+		t.setProducts(products)
+	})
+	if err != nil {
+		log.Printf("Live product updates unavailable: %v", err)
+		t.loadProducts()
+		return
+	}
+	t.stopWatch = stop
+}
+
+// Close stops live product updates and cancels pending requests
+func (t *TransactionsScreen) Close() {
+	t.cancel()
+	t.shiftScreen.Close()
+	if t.stopWatch != nil {
+		t.stopWatch()
+		t.stopWatch = nil
+	}
+}
+
 // setupUI sets up the transactions interface
 func (t *TransactionsScreen) setupUI() {
 	// Create tabs
@@ -60,15 +126,18 @@ func (t *TransactionsScreen) setupUI() {
 	// Create history tab
 	t.setupHistoryTab()
 
-	// Create simple container instead of tabs
-	t.container = container.NewBorder(nil, nil, nil, nil, t.posContainer)
+	t.tabs.Append(container.NewTabItem("Kasir", t.posContainer))
+	t.tabs.Append(container.NewTabItem("Riwayat", t.historyContainer))
+	t.tabs.Append(container.NewTabItem("Shift", t.shiftScreen.GetContainer()))
+
+	t.container = container.NewBorder(nil, nil, nil, nil, t.tabs)
 }
 
 // setupPOSTab sets up the POS (Point of Sale) tab
 func (t *TransactionsScreen) setupPOSTab() {
 	// Initialize new transaction
 	t.currentTransaction = &models.Transaction{
-		TransID:       fmt.Sprintf("trans_%d", time.Now().Unix()),
+		TransID:       models.NewTransactionID(),
 		UserID:        "",
 		Date:          time.Now(),
 		Total:         0,
@@ -84,8 +153,16 @@ func (t *TransactionsScreen) setupPOSTab() {
 	t.productSearch = widget.NewEntry()
 	t.productSearch.SetPlaceHolder("Cari produk atau scan barcode...")
 	t.productSearch.OnSubmitted = func(text string) {
+		noteActivity()
 		t.searchAndAddProduct(text)
 	}
+	t.productSearch.OnChanged = func(text string) {
+		noteActivity() // scanning only types, the mouse stays still
+		t.productsMu.Lock()
+		t.searchText = text
+		t.productsMu.Unlock()
+		t.refreshProductGrid()
+	}
 
 	searchButton := widget.NewButton("Cari", func() {
 		t.searchAndAddProduct(t.productSearch.Text)
@@ -133,7 +210,9 @@ func (t *TransactionsScreen) setupPOSTab() {
 
 	// Create POS container
 	t.posContainer = container.NewVBox(
+		t.shiftLabel,
 		searchContainer,
+		t.productGrid.container,
 		widget.NewSeparator(),
 		widget.NewLabel("Keranjang Belanja:"),
 		t.cartTable,
@@ -174,9 +253,11 @@ func (t *TransactionsScreen) setupHistoryTab() {
 	t.createHistoryTable()
 
 	// Create history container
-	t.historyContainer = container.NewVBox(
-		filterContainer,
-		widget.NewSeparator(),
+	t.historyContainer = container.NewBorder(
+		container.NewVBox(filterContainer, widget.NewSeparator()),
+		nil,
+		nil,
+		nil,
 		t.historyTable,
 	)
 }
@@ -238,6 +319,8 @@ func (t *TransactionsScreen) createCartTable() {
 func (t *TransactionsScreen) createHistoryTable() {
 	t.historyTable = widget.NewTable(
 		func() (int, int) {
+			t.historyMu.Lock()
+			defer t.historyMu.Unlock()
 			return len(t.transactions) + 1, 5 // +1 for header, 5 columns
 		},
 		func() fyne.CanvasObject {
@@ -254,9 +337,21 @@ func (t *TransactionsScreen) createHistoryTable() {
 					label.TextStyle = fyne.TextStyle{Bold: true}
 				}
 			} else {
+				t.historyMu.Lock()
+				rows := len(t.transactions)
+				var trans models.Transaction
+				if id.Row-1 < rows {
+					trans = t.transactions[id.Row-1]
+				}
+				t.historyMu.Unlock()
+
+				// Load the next page once the last row scrolls into view
+				if id.Row == rows && id.Col == 0 {
+					t.loadMoreTransactions()
+				}
+
 				// Data rows
-				if id.Row-1 < len(t.transactions) {
-					trans := t.transactions[id.Row-1]
+				if id.Row-1 < rows {
 					switch id.Col {
 					case 0:
 						label.SetText(trans.TransID)
@@ -288,27 +383,92 @@ func (t *TransactionsScreen) searchAndAddProduct(query string) {
 		return
 	}
 
-	// This is a simplified implementation
-	// In a real app, you'd search products from Firestore
-	// For now, we'll create a dummy product
-	product := &models.Product{
-		ProductID: "dummy",
-		Name:      "Produk Demo - " + query,
-		Price:     10000,
-		Stock:     100,
-		Category:  "Lainnya",
+	product := t.findProduct(query)
+	if product == nil {
+		dialog.ShowInformation("Produk Tidak Ditemukan",
+			fmt.Sprintf("Tidak ada produk yang cocok dengan '%s'", query), t.window)
+		return
+	}
+
+	if t.addToCart(*product) {
+		t.productSearch.SetText("")
 	}
+}
 
-	// Add to transaction
-	err := t.currentTransaction.AddItem(product, 1)
+// addToCart adds one of product to the current transaction
+func (t *TransactionsScreen) addToCart(product models.Product) bool {
+	noteActivity()
+	err := t.currentTransaction.AddItem(&product, 1)
 	if err != nil {
 		dialog.ShowError(err, t.window)
-		return
+		return false
 	}
 
-	// Update UI
 	t.updateCartUI()
-	t.productSearch.SetText("")
+	return true
+}
+
+// findProduct finds a product by exact barcode/ID or by name.
+// It returns a copy so later cache updates do not change it.
+func (t *TransactionsScreen) findProduct(query string) *models.Product {
+	t.productsMu.RLock()
+	defer t.productsMu.RUnlock()
+
+	query = strings.TrimSpace(query)
+	for _, product := range t.products {
+		if product.Barcode == query || product.ProductID == query {
+			return &product
+		}
+	}
+
+	lowerQuery := strings.ToLower(query)
+	for _, product := range t.products {
+		if strings.Contains(strings.ToLower(product.Name), lowerQuery) {
+			return &product
+		}
+	}
+
+	return nil
+}
+
+// loadProducts loads the product cache used by the POS search
+func (t *TransactionsScreen) loadProducts() {
+	products, err := t.productRepo.List(t.ctx)
+	if err != nil {
+		if !repository.IsPartial(err) {
+			dialog.ShowError(fmt.Errorf("gagal memuat produk: %s", models.UserMessage(err)), t.window)
+			return
+		}
+		log.Printf("Some products could not be loaded: %v", err)
+	}
+
+	t.setProducts(products)
+}
+
+// setProducts replaces the product cache
+func (t *TransactionsScreen) setProducts(products []models.Product) {
+	t.productsMu.Lock()
+	t.products = products
+	t.productsMu.Unlock()
+
+	t.refreshProductGrid()
+}
+
+// refreshProductGrid shows the products matching the search text as tiles.
+// It may run on the listener goroutine.
+func (t *TransactionsScreen) refreshProductGrid() {
+	t.productsMu.RLock()
+	query := strings.ToLower(strings.TrimSpace(t.searchText))
+	matches := make([]models.Product, 0, len(t.products))
+	for _, product := range t.products {
+		if query == "" || strings.Contains(strings.ToLower(product.Name), query) ||
+			product.Barcode == query {
+			matches = append(matches, product)
+		}
+	}
+	t.productsMu.RUnlock()
+
+	t.productGrid.SetProducts(matches)
 }
 
 // updateCartUI updates the cart UI
@@ -330,10 +490,19 @@ func (t *TransactionsScreen) clearTransaction() {
 
 // processPayment processes the payment
 func (t *TransactionsScreen) processPayment() {
+	noteActivity()
 	if len(t.currentTransaction.Items) == 0 {
 		dialog.ShowInformation("Keranjang Kosong", "Tidak ada item dalam keranjang", t.window)
 		return
 	}
+	if t.shiftScreen.Current() == nil {
+		dialog.ShowConfirm("Shift Belum Dibuka", "Belum ada shift yang dibuka di kasir ini.\nBuka shift sekarang?", func(confirm bool) {
+			if confirm {
+				t.shiftScreen.showOpenDialog()
+			}
+		}, t.window)
+		return
+	}
 
 	// Show payment confirmation
 	message := fmt.Sprintf("Total: %s\nMetode: %s\nProses pembayaran?",
@@ -349,10 +518,29 @@ func (t *TransactionsScreen) processPayment() {
 
 // saveTransaction saves the transaction
 func (t *TransactionsScreen) saveTransaction() {
-	// Save to Firestore
-	err := t.firestoreService.Create("transactions", t.currentTransaction.TransID, *t.currentTransaction)
+	// Record the cashier working on the terminal, not who signed it in
+	t.currentTransaction.UserID, _, _ = GetCurrentUser()
+	shift := t.shiftScreen.Current()
+	if shift == nil {
+		dialog.ShowError(errors.New(models.UserMessage(models.ErrNoOpenShift)), t.window)
+		return
+	}
+	t.currentTransaction.ShiftID = shift.ShiftID
+
+	// Decrement stock and save to Firestore atomically
+	err := t.transactionRepo.Checkout(t.ctx, t.currentTransaction)
 	if err != nil {
-		dialog.ShowError(fmt.Errorf("gagal menyimpan transaksi: %v", err), t.window)
+		var stockErr *models.StockError
+		if errors.As(err, &stockErr) {
+			dialog.ShowError(fmt.Errorf("stok tidak mencukupi untuk produk: %s",
+				t.itemNames(stockErr.ProductIDs)), t.window)
+			return
+		}
+		if errors.Is(err, models.ErrTransactionConflict) {
+			// The ID belongs to another sale, trying again needs a new one
+			t.currentTransaction.TransID = models.NewTransactionID()
+		}
+		dialog.ShowError(fmt.Errorf("gagal menyimpan transaksi: %s", models.UserMessage(err)), t.window)
 		return
 	}
 
@@ -361,15 +549,34 @@ func (t *TransactionsScreen) saveTransaction() {
 	// Reset transaction
 	t.StartNewTransaction()
 
-	// Refresh history
+	// Stock is refreshed by the product listener when it is running
+	if t.stopWatch == nil {
+		t.loadProducts()
+	}
 	t.loadTransactions()
 }
 
+// itemNames returns the cart item names for the given product IDs
+func (t *TransactionsScreen) itemNames(productIDs []string) string {
+	names := make([]string, 0, len(productIDs))
+	for _, productID := range productIDs {
+		name := productID
+		for _, item := range t.currentTransaction.Items {
+			if item.ProductID == productID {
+				name = item.Name
+				break
+			}
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
+
 // StartNewTransaction starts a new transaction
 func (t *TransactionsScreen) StartNewTransaction() {
 	userID, _, _ := GetCurrentUser()
 	t.currentTransaction = &models.Transaction{
-		TransID:       fmt.Sprintf("trans_%d", time.Now().Unix()),
+		TransID:       models.NewTransactionID(),
 		UserID:        userID,
 		Date:          time.Now(),
 		Total:         0,
@@ -379,21 +586,104 @@ func (t *TransactionsScreen) StartNewTransaction() {
 	t.updateCartUI()
 }
 
-// loadTransactions loads transaction history
+// loadTransactions loads the first page of transaction history
 func (t *TransactionsScreen) loadTransactions() {
-	// This is a simplified implementation
-	// In a real app, you'd load transactions from Firestore
-	t.transactions = make([]models.Transaction, 0)
+	t.historyMu.Lock()
+	query := t.historyQuery("")
+	t.historyMu.Unlock()
+
+	page, err := t.transactionRepo.List(t.ctx, query)
+	if err != nil {
+		if !repository.IsPartial(err) {
+			dialog.ShowError(fmt.Errorf("gagal memuat transaksi: %s", models.UserMessage(err)), t.window)
+			return
+		}
+		log.Printf("Some transactions could not be loaded: %v", err)
+	}
+
+	t.historyMu.Lock()
+	t.transactions = page.Transactions
+	t.nextPageToken = page.NextPageToken
+	t.historyMu.Unlock()
 
 	if t.historyTable != nil {
 		t.historyTable.Refresh()
 	}
 }
 
+// loadMoreTransactions appends the next page of transaction history
+func (t *TransactionsScreen) loadMoreTransactions() {
+	t.historyMu.Lock()
+	if t.loadingHistory || t.nextPageToken == "" {
+		t.historyMu.Unlock()
+		return
+	}
+	t.loadingHistory = true
+	query := t.historyQuery(t.nextPageToken)
+	t.historyMu.Unlock()
+
+	go func() {
+		page, err := t.transactionRepo.List(t.ctx, query)
+
+		t.historyMu.Lock()
+		t.loadingHistory = false
+		if err != nil && !repository.IsPartial(err) {
+			t.historyMu.Unlock()
+			dialog.ShowError(fmt.Errorf("gagal memuat transaksi: %s", models.UserMessage(err)), t.window)
+			return
+		}
+		if err != nil {
+			log.Printf("Some transactions could not be loaded: %v", err)
+		}
+		// Ignore pages from a query that was replaced by a refresh or filter
+		if query.PageToken == t.nextPageToken {
+			t.transactions = append(t.transactions, page.Transactions...)
+			t.nextPageToken = page.NextPageToken
+		}
+		t.historyMu.Unlock()
+
+		t.historyTable.Refresh()
+	}()
+}
+
+// historyQuery builds the query for a page of the most recent transactions.
+// Callers must hold historyMu.
+func (t *TransactionsScreen) historyQuery(pageToken string) repository.TransactionQuery {
+	return repository.TransactionQuery{
+		From:      t.historyFrom,
+		To:        t.historyTo,
+		Limit:     historyPageSize,
+		PageToken: pageToken,
+	}
+}
+
 // filterTransactions filters transactions by date range
 func (t *TransactionsScreen) filterTransactions(dateFrom, dateTo string) {
-	// Implement date filtering logic
-	// For now, just reload all transactions
+	var from, to time.Time
+
+	if dateFrom != "" {
+		parsed, err := time.ParseInLocation("02/01/2006", dateFrom, time.Local)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("format tanggal tidak valid: %s", dateFrom), t.window)
+			return
+		}
+		from = parsed
+	}
+
+	if dateTo != "" {
+		parsed, err := time.ParseInLocation("02/01/2006", dateTo, time.Local)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("format tanggal tidak valid: %s", dateTo), t.window)
+			return
+		}
+		to = parsed.AddDate(0, 0, 1)
+	}
+
+	t.historyMu.Lock()
+	t.historyFrom = from
+	t.historyTo = to
+	t.historyMu.Unlock()
+
 	t.loadTransactions()
 }
 
@@ -402,7 +692,19 @@ func (t *TransactionsScreen) GetContainer() *fyne.Container {
 	return t.container
 }
 
+// showShift shows the open shift above the cart
+func (t *TransactionsScreen) showShift(shift *models.Shift) {
+	if shift == nil {
+		t.shiftLabel.SetText("Shift belum dibuka, buka shift di tab Shift sebelum berjualan.")
+		return
+	}
+	t.shiftLabel.SetText(fmt.Sprintf("Shift dibuka %s, modal awal %s",
+		utils.FormatDateTimeShort(shift.OpenedAt), utils.FormatCurrency(shift.OpeningCash)))
+}
+
 // Refresh refreshes the transactions data
 func (t *TransactionsScreen) Refresh() {
+	t.loadProducts()
 	t.loadTransactions()
+	go t.shiftScreen.Refresh()
 }
@@ -0,0 +1,577 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"kasirnest/accounts"
+	"kasirnest/firebase"
+	"kasirnest/models"
+	"kasirnest/utils"
+)
+
+// usersPageSize is the number of accounts loaded at a time
+const usersPageSize = 25
+
+// roleOptions are the roles offered by the user dialogs
+var roleOptions = []string{models.RoleKasir, models.RoleAdmin}
+
+// UsersScreen lets admins manage the staff accounts
+type UsersScreen struct {
+	window      fyne.Window
+	container   *fyne.Container
+	manager     *accounts.Manager
+	ctx         context.Context // cancelled by Close
+	cancel      context.CancelFunc
+	table       *widget.Table
+	statusLabel *widget.Label
+	moreBtn     *widget.Button
+	disableBtn  *widget.Button
+
+	// Loaded accounts, appended to by the page loading goroutines
+	mu            sync.RWMutex
+	filter        firebase.UserQuery // role and status shown
+	users         []models.User
+	nextPageToken string
+	loading       bool
+	selected      int // row of users, -1 when none
+}
+
+// NewUsersScreen creates a new users screen.
+// manager may be nil when Firebase Auth is not available.
+func NewUsersScreen(w fyne.Window, manager *accounts.Manager) *UsersScreen {
+	ctx, cancel := context.WithCancel(context.Background())
+	screen := &UsersScreen{
+		window:   w,
+		manager:  manager,
+		ctx:      ctx,
+		cancel:   cancel,
+		selected: -1,
+	}
+
+	screen.setupUI()
+	if manager != nil {
+		go screen.Refresh()
+	}
+	return screen
+}
+
+// setupUI sets up the users interface
+func (u *UsersScreen) setupUI() {
+	if u.manager == nil {
+		u.container = container.NewVBox(widget.NewLabel("Manajemen pengguna tidak tersedia, periksa bagian [firebase] di app.ini"))
+		return
+	}
+
+	addBtn := widget.NewButtonWithIcon("Tambah Pengguna", theme.ContentAddIcon(), func() {
+		u.showAddDialog()
+	})
+	addBtn.Importance = widget.HighImportance
+
+	roleBtn := widget.NewButton("Ubah Peran", func() {
+		u.showRoleDialog()
+	})
+	passwordBtn := widget.NewButton("Reset Password", func() {
+		u.showPasswordDialog()
+	})
+	pinBtn := widget.NewButton("Atur PIN", func() {
+		u.showPINDialog()
+	})
+	u.disableBtn = widget.NewButton("Nonaktifkan", func() {
+		u.toggleDisabled()
+	})
+	logoutBtn := widget.NewButton("Paksa Keluar", func() {
+		u.confirmForceLogout()
+	})
+	refreshBtn := widget.NewButtonWithIcon("Refresh", theme.ViewRefreshIcon(), func() {
+		go u.Refresh()
+	})
+
+	// Filters are set before their callbacks so the first load runs once
+	roleFilter := widget.NewSelect([]string{"Semua Peran", models.RoleKasir, models.RoleAdmin}, nil)
+	roleFilter.SetSelectedIndex(0)
+	roleFilter.OnChanged = func(value string) {
+		u.mu.Lock()
+		u.filter.Role = value
+		if value == "Semua Peran" {
+			u.filter.Role = ""
+		}
+		u.mu.Unlock()
+		go u.Refresh()
+	}
+	statusFilter := widget.NewSelect([]string{"Semua Status", "Aktif", "Nonaktif"}, nil)
+	statusFilter.SetSelectedIndex(0)
+	statusFilter.OnChanged = func(value string) {
+		u.mu.Lock()
+		switch value {
+		case "Aktif":
+			u.filter.Status = firebase.ActiveUsers
+		case "Nonaktif":
+			u.filter.Status = firebase.DisabledUsers
+		default:
+			u.filter.Status = firebase.AnyStatus
+		}
+		u.mu.Unlock()
+		go u.Refresh()
+	}
+
+	u.statusLabel = widget.NewLabel("Memuat pengguna...")
+	u.moreBtn = widget.NewButton("Muat Lagi", func() {
+		u.loadMore()
+	})
+	u.moreBtn.Hide()
+	u.createTable()
+
+	u.container = container.NewBorder(
+		container.NewVBox(
+			container.NewHBox(addBtn, roleBtn, passwordBtn, pinBtn, u.disableBtn, logoutBtn, refreshBtn),
+			container.NewHBox(widget.NewLabel("Peran:"), roleFilter, widget.NewLabel("Status:"), statusFilter),
+			widget.NewSeparator(),
+		),
+		container.NewHBox(u.statusLabel, u.moreBtn),
+		nil, nil,
+		u.table,
+	)
+}
+
+// createTable creates the table of accounts
+func (u *UsersScreen) createTable() {
+	u.table = widget.NewTable(
+		func() (int, int) {
+			u.mu.RLock()
+			defer u.mu.RUnlock()
+			return len(u.users) + 1, 5 // +1 for header
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("Cell")
+		},
+		func(id widget.TableCellID, cell fyne.CanvasObject) {
+			label := cell.(*widget.Label)
+
+			if id.Row == 0 {
+				headers := []string{"Nama", "Email", "Peran", "Status", "Login Terakhir"}
+				label.SetText(headers[id.Col])
+				label.TextStyle = fyne.TextStyle{Bold: true}
+				return
+			}
+
+			label.TextStyle = fyne.TextStyle{}
+			user, ok := u.userAt(id.Row - 1)
+			if !ok {
+				label.SetText("")
+				return
+			}
+
+			switch id.Col {
+			case 0:
+				label.SetText(user.Name)
+			case 1:
+				label.SetText(user.Email)
+			case 2:
+				label.SetText(user.Role)
+			case 3:
+				if user.Disabled {
+					label.SetText("Nonaktif")
+				} else {
+					label.SetText("Aktif")
+				}
+			case 4:
+				if user.LastLogin.IsZero() {
+					label.SetText("-")
+				} else {
+					label.SetText(utils.FormatDateTimeShort(user.LastLogin))
+				}
+			}
+		},
+	)
+	u.table.OnSelected = func(id widget.TableCellID) {
+		u.mu.Lock()
+		u.selected = -1
+		if id.Row > 0 && id.Row-1 < len(u.users) {
+			u.selected = id.Row - 1
+		}
+		u.mu.Unlock()
+
+		if user, ok := u.selectedUser(); ok && user.Disabled {
+			u.disableBtn.SetText("Aktifkan")
+		} else {
+			u.disableBtn.SetText("Nonaktifkan")
+		}
+	}
+	u.table.SetColumnWidth(0, 180)
+	u.table.SetColumnWidth(1, 240)
+	u.table.SetColumnWidth(2, 80)
+	u.table.SetColumnWidth(3, 90)
+	u.table.SetColumnWidth(4, 140)
+}
+
+// userAt returns a copy of the loaded account at index
+func (u *UsersScreen) userAt(index int) (models.User, bool) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	if index < 0 || index >= len(u.users) {
+		return models.User{}, false
+	}
+	return u.users[index], true
+}
+
+// selectedUser returns the account chosen in the table
+func (u *UsersScreen) selectedUser() (models.User, bool) {
+	u.mu.RLock()
+	selected := u.selected
+	u.mu.RUnlock()
+	return u.userAt(selected)
+}
+
+// requireSelection returns the chosen account or asks the admin to choose
+// one
+func (u *UsersScreen) requireSelection() (models.User, bool) {
+	user, ok := u.selectedUser()
+	if !ok {
+		dialog.ShowInformation("Pilih Pengguna", "Silakan pilih pengguna terlebih dahulu", u.window)
+	}
+	return user, ok
+}
+
+// Refresh reloads the first page of accounts
+func (u *UsersScreen) Refresh() {
+	if u.manager == nil {
+		return
+	}
+
+	u.mu.Lock()
+	u.loading = true
+	query := u.filter
+	u.mu.Unlock()
+
+	query.Limit = usersPageSize
+	page, err := u.manager.List(u.ctx, query)
+	if u.ctx.Err() != nil {
+		return
+	}
+
+	u.mu.Lock()
+	u.loading = false
+	// A filter changed while loading is shown by the refresh it started
+	if err == nil && query.Role == u.filter.Role && query.Status == u.filter.Status {
+		u.users = page.Users
+		u.nextPageToken = page.NextPageToken
+		u.selected = -1
+	}
+	u.mu.Unlock()
+
+	if err != nil {
+		u.statusLabel.SetText("")
+		dialog.ShowError(fmt.Errorf("gagal memuat pengguna: %s", models.UserMessage(err)), u.window)
+		return
+	}
+	u.table.UnselectAll()
+	u.showPageState()
+}
+
+// loadMore appends the next page of accounts
+func (u *UsersScreen) loadMore() {
+	u.mu.Lock()
+	if u.loading || u.nextPageToken == "" {
+		u.mu.Unlock()
+		return
+	}
+	u.loading = true
+	query := u.filter
+	query.Limit = usersPageSize
+	query.PageToken = u.nextPageToken
+	u.mu.Unlock()
+
+	u.moreBtn.Disable()
+	go func() {
+		page, err := u.manager.List(u.ctx, query)
+		if u.ctx.Err() != nil {
+			return
+		}
+
+		u.mu.Lock()
+		u.loading = false
+		// Ignore pages of a list that was replaced by a refresh
+		if err == nil && query.PageToken == u.nextPageToken {
+			u.users = append(u.users, page.Users...)
+			u.nextPageToken = page.NextPageToken
+		}
+		u.mu.Unlock()
+
+		u.moreBtn.Enable()
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("gagal memuat pengguna: %s", models.UserMessage(err)), u.window)
+			return
+		}
+		u.showPageState()
+	}()
+}
+
+// showPageState refreshes the table, the count and the load more button
+func (u *UsersScreen) showPageState() {
+	u.mu.RLock()
+	count := len(u.users)
+	more := u.nextPageToken != ""
+	u.mu.RUnlock()
+
+	u.table.Refresh()
+	if more {
+		u.statusLabel.SetText(fmt.Sprintf("%d pengguna dimuat", count))
+		u.moreBtn.Show()
+	} else {
+		u.statusLabel.SetText(fmt.Sprintf("%d pengguna", count))
+		u.moreBtn.Hide()
+	}
+}
+
+// showAddDialog asks for the details of a new account
+func (u *UsersScreen) showAddDialog() {
+	nameEntry := widget.NewEntry()
+	nameEntry.SetPlaceHolder("Nama lengkap")
+
+	emailEntry := widget.NewEntry()
+	emailEntry.SetPlaceHolder("email@toko.com")
+
+	passwordEntry := widget.NewPasswordEntry()
+	passwordEntry.SetPlaceHolder("Kosongkan untuk mengirim undangan")
+
+	roleSelect := widget.NewSelect(roleOptions, nil)
+	roleSelect.SetSelected(models.RoleKasir)
+
+	items := []*widget.FormItem{
+		{Text: "Nama:", Widget: nameEntry},
+		{Text: "Email:", Widget: emailEntry},
+		{Text: "Password:", Widget: passwordEntry},
+		{Text: "Peran:", Widget: roleSelect},
+	}
+	dialog.ShowForm("Tambah Pengguna", "Simpan", "Batal", items, func(confirm bool) {
+		if !confirm {
+			return
+		}
+		if !utils.ValidateEmail(emailEntry.Text) {
+			dialog.ShowError(fmt.Errorf("format email tidak valid"), u.window)
+			return
+		}
+		if passwordEntry.Text != "" && !utils.ValidatePasswordStrength(passwordEntry.Text) {
+			dialog.ShowError(fmt.Errorf("password minimal 6 karakter dengan huruf besar, huruf kecil dan angka"), u.window)
+			return
+		}
+		u.addUser(emailEntry.Text, nameEntry.Text, passwordEntry.Text, roleSelect.Selected)
+	}, u.window)
+}
+
+// addUser creates an account in the background. Invited users get a link
+// to choose their own password.
+func (u *UsersScreen) addUser(email, name, password, role string) {
+	progress := dialog.NewProgressInfinite("Tambah Pengguna", "Membuat akun...", u.window)
+	progress.Show()
+
+	go func() {
+		invite, err := u.manager.Create(u.ctx, email, name, password, role)
+		progress.Hide()
+		if u.ctx.Err() != nil {
+			return
+		}
+		if invite == nil {
+			if errors.Is(err, models.ErrAlreadyExists) {
+				err = fmt.Errorf("email %s sudah terdaftar", email)
+			}
+			dialog.ShowError(fmt.Errorf("gagal membuat akun: %s", models.UserMessage(err)), u.window)
+			return
+		}
+		go u.Refresh()
+
+		switch {
+		case err != nil:
+			dialog.ShowError(fmt.Errorf("akun dibuat, tetapi belum selesai disiapkan: %s", models.UserMessage(err)), u.window)
+		case invite.Link != "":
+			u.showInviteLink(invite)
+		default:
+			dialog.ShowInformation("Sukses", "Pengguna berhasil ditambahkan", u.window)
+		}
+	}()
+}
+
+// showInviteLink shows the link an invited user opens to set a password
+func (u *UsersScreen) showInviteLink(invite *accounts.Invite) {
+	linkEntry := widget.NewEntry()
+	linkEntry.SetText(invite.Link)
+
+	copyBtn := widget.NewButtonWithIcon("Salin", theme.ContentCopyIcon(), func() {
+		u.window.Clipboard().SetContent(invite.Link)
+	})
+
+	content := container.NewVBox(
+		widget.NewLabel(fmt.Sprintf("Kirim tautan ini ke %s untuk membuat password:", invite.User.Email)),
+		container.NewBorder(nil, nil, nil, copyBtn, linkEntry),
+	)
+	linkDialog := dialog.NewCustom("Undangan Pengguna", "Tutup", content, u.window)
+	linkDialog.Resize(fyne.NewSize(560, 160))
+	linkDialog.Show()
+}
+
+// showRoleDialog changes the role of the chosen account
+func (u *UsersScreen) showRoleDialog() {
+	user, ok := u.requireSelection()
+	if !ok {
+		return
+	}
+
+	roleSelect := widget.NewSelect(roleOptions, nil)
+	roleSelect.SetSelected(user.Role)
+
+	items := []*widget.FormItem{
+		{Text: "Peran:", Widget: roleSelect},
+	}
+	dialog.ShowForm(fmt.Sprintf("Peran %s", user.Email), "Simpan", "Batal", items, func(confirm bool) {
+		if !confirm || roleSelect.Selected == user.Role {
+			return
+		}
+		u.run("Peran diubah, berlaku saat sesi pengguna diperbarui", func(ctx context.Context) error {
+			return u.manager.SetRole(ctx, user.UserID, roleSelect.Selected)
+		})
+	}, u.window)
+}
+
+// showPasswordDialog sets a new password for the chosen account
+func (u *UsersScreen) showPasswordDialog() {
+	user, ok := u.requireSelection()
+	if !ok {
+		return
+	}
+
+	passwordEntry := widget.NewPasswordEntry()
+	confirmEntry := widget.NewPasswordEntry()
+
+	items := []*widget.FormItem{
+		{Text: "Password Baru:", Widget: passwordEntry},
+		{Text: "Ulangi Password:", Widget: confirmEntry},
+	}
+	dialog.ShowForm(fmt.Sprintf("Reset Password %s", user.Email), "Simpan", "Batal", items, func(confirm bool) {
+		if !confirm {
+			return
+		}
+		if !utils.ValidatePasswordStrength(passwordEntry.Text) {
+			dialog.ShowError(fmt.Errorf("password minimal 6 karakter dengan huruf besar, huruf kecil dan angka"), u.window)
+			return
+		}
+		if passwordEntry.Text != confirmEntry.Text {
+			dialog.ShowError(fmt.Errorf("password tidak sama"), u.window)
+			return
+		}
+		u.run("Password diubah, pengguna harus login kembali", func(ctx context.Context) error {
+			return u.manager.ResetPassword(ctx, user.UserID, passwordEntry.Text)
+		})
+	}, u.window)
+}
+
+// showPINDialog sets or removes the PIN the chosen user switches in with
+func (u *UsersScreen) showPINDialog() {
+	user, ok := u.requireSelection()
+	if !ok {
+		return
+	}
+
+	pinEntry := widget.NewPasswordEntry()
+	pinEntry.SetPlaceHolder("Kosongkan untuk menghapus PIN")
+	confirmEntry := widget.NewPasswordEntry()
+
+	items := []*widget.FormItem{
+		{Text: "PIN Baru:", Widget: pinEntry},
+		{Text: "Ulangi PIN:", Widget: confirmEntry},
+	}
+	dialog.ShowForm(fmt.Sprintf("Atur PIN %s", user.Email), "Simpan", "Batal", items, func(confirm bool) {
+		if !confirm {
+			return
+		}
+		if pinEntry.Text != confirmEntry.Text {
+			dialog.ShowError(fmt.Errorf("PIN tidak sama"), u.window)
+			return
+		}
+		success := "PIN disimpan"
+		if pinEntry.Text == "" {
+			success = "PIN dihapus"
+		}
+		u.run(success, func(ctx context.Context) error {
+			return u.manager.SetPIN(ctx, user.UserID, pinEntry.Text)
+		})
+	}, u.window)
+}
+
+// toggleDisabled disables or enables the chosen account
+func (u *UsersScreen) toggleDisabled() {
+	user, ok := u.requireSelection()
+	if !ok {
+		return
+	}
+
+	if user.Disabled {
+		u.run("Akun diaktifkan kembali", func(ctx context.Context) error {
+			return u.manager.SetDisabled(ctx, user.UserID, false)
+		})
+		return
+	}
+
+	dialog.ShowConfirm("Nonaktifkan Akun",
+		fmt.Sprintf("Nonaktifkan akun %s? Pengguna tidak dapat login dan akan dikeluarkan dari semua kasir.", user.Email),
+		func(confirm bool) {
+			if confirm {
+				u.run("Akun dinonaktifkan", func(ctx context.Context) error {
+					return u.manager.SetDisabled(ctx, user.UserID, true)
+				})
+			}
+		}, u.window)
+}
+
+// confirmForceLogout ends every session of the chosen account
+func (u *UsersScreen) confirmForceLogout() {
+	user, ok := u.requireSelection()
+	if !ok {
+		return
+	}
+
+	dialog.ShowConfirm("Paksa Keluar",
+		fmt.Sprintf("Keluarkan %s dari semua kasir? Sesi berakhir paling lambat dalam satu jam.", user.Email),
+		func(confirm bool) {
+			if confirm {
+				u.run("Sesi pengguna dicabut", func(ctx context.Context) error {
+					return u.manager.ForceLogout(ctx, user.UserID)
+				})
+			}
+		}, u.window)
+}
+
+// run performs an account change in the background, then reports success
+// and reloads the list
+func (u *UsersScreen) run(success string, change func(ctx context.Context) error) {
+	go func() {
+		err := change(u.ctx)
+		if u.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("gagal mengubah akun: %s", models.UserMessage(err)), u.window)
+			return
+		}
+		dialog.ShowInformation("Sukses", success, u.window)
+		u.Refresh()
+	}()
+}
+
+// Close cancels pending requests
+func (u *UsersScreen) Close() {
+	u.cancel()
+}
+
+// GetContainer returns the users container
+func (u *UsersScreen) GetContainer() *fyne.Container {
+	return u.container
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
@@ -9,65 +10,221 @@ import (
 	"errors"
 	"io"
 	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypted data is an envelope that names how it was encrypted, so the
+// key derivation can be strengthened later without losing old data:
+//
+//	magic "KNE" | version | algorithm | log2 N | r | p | salt (16) | nonce (12) | ciphertext
+//
+// The key is derived from the passphrase with scrypt and a random salt per
+// envelope, and data is sealed with AES-256-GCM. The header is
+// authenticated along with the caller's associated data. Data without the
+// magic was encrypted by older versions and is the nonce followed by the
+// ciphertext, with the key a bare SHA-256 of the passphrase; it is still
+// decrypted.
+const (
+	envelopeVersion    = 1
+	algScryptAES256GCM = 1
+
+	scryptLogN    = 15
+	scryptR       = 8
+	scryptP       = 1
+	scryptSaltLen = 16
+	gcmNonceLen   = 12
+
+	// Upper bounds for parameters read from an envelope, so tampered data
+	// cannot make decryption exhaust the machine
+	scryptMaxLogN = 20
+	scryptMaxR    = 16
+	scryptMaxP    = 4
 )
 
-// EncryptString encrypts a string using AES encryption with a given key
+// envelopeMagic starts every envelope
+var envelopeMagic = []byte("KNE")
+
+// envelopeHeaderLen is the length of the envelope before the ciphertext
+var envelopeHeaderLen = len(envelopeMagic) + 5 + scryptSaltLen + gcmNonceLen
+
+// ErrDecrypt is returned when data cannot be decrypted with the key
+var ErrDecrypt = errors.New("data cannot be decrypted with this key")
+
+// EncryptString encrypts a string with a passphrase, encoded as base64
 func EncryptString(plaintext, key string) (string, error) {
-	// Create hash of key to ensure it's 32 bytes for AES-256
-	hash := sha256.Sum256([]byte(key))
+	return EncryptStringWithAAD(plaintext, key, nil)
+}
 
-	// Create AES cipher
-	block, err := aes.NewCipher(hash[:])
+// EncryptStringWithAAD encrypts a string like EncryptString, binding it to
+// associatedData, which must be given again to decrypt it
+func EncryptStringWithAAD(plaintext, key string, associatedData []byte) (string, error) {
+	ciphertext, err := EncryptBytesWithAAD([]byte(plaintext), key, associatedData)
 	if err != nil {
 		return "", err
 	}
 
-	// Create GCM mode
-	gcm, err := cipher.NewGCM(block)
+	// Encode to base64
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// DecryptString decrypts a string produced by EncryptString
+func DecryptString(ciphertext, key string) (string, error) {
+	return DecryptStringWithAAD(ciphertext, key, nil)
+}
+
+// DecryptStringWithAAD decrypts a string produced by EncryptStringWithAAD
+func DecryptStringWithAAD(ciphertext, key string, associatedData []byte) (string, error) {
+	// Decode from base64
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
 	if err != nil {
 		return "", err
 	}
 
-	// Create nonce
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+	plaintext, err := DecryptBytesWithAAD(data, key, associatedData)
+	if err != nil {
 		return "", err
 	}
 
+	return string(plaintext), nil
+}
+
+// EncryptBytes encrypts data with a passphrase into an envelope
+func EncryptBytes(plaintext []byte, key string) ([]byte, error) {
+	return EncryptBytesWithAAD(plaintext, key, nil)
+}
+
+// EncryptBytesWithAAD encrypts data like EncryptBytes, binding it to
+// associatedData, which must be given again to decrypt it
+func EncryptBytesWithAAD(plaintext []byte, key string, associatedData []byte) ([]byte, error) {
+	envelopeKey, err := NewEnvelopeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return envelopeKey.Encrypt(plaintext, associatedData)
+}
+
+// EnvelopeKey is a key derived from a passphrase with a random salt. Data
+// encrypted often with the same passphrase keeps one, so scrypt only runs
+// once; every envelope still gets its own nonce.
+type EnvelopeKey struct {
+	salt []byte
+	gcm  cipher.AEAD
+}
+
+// NewEnvelopeKey derives a key from a passphrase with a new random salt
+func NewEnvelopeKey(passphrase string) (*EnvelopeKey, error) {
+	salt := make([]byte, scryptSaltLen)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	gcm, err := scryptGCM(passphrase, salt, scryptLogN, scryptR, scryptP)
+	if err != nil {
+		return nil, err
+	}
+	return &EnvelopeKey{salt: salt, gcm: gcm}, nil
+}
+
+// Encrypt encrypts data into an envelope like EncryptBytesWithAAD
+func (k *EnvelopeKey) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	header := make([]byte, 0, envelopeHeaderLen)
+	header = append(header, envelopeMagic...)
+	header = append(header, envelopeVersion, algScryptAES256GCM, scryptLogN, scryptR, scryptP)
+	header = append(header, k.salt...)
+
+	// Random nonce
+	nonce := make([]byte, gcmNonceLen)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	header = append(header, nonce...)
+
 	// Encrypt
-	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return k.gcm.Seal(header, nonce, plaintext, envelopeAAD(header, associatedData)), nil
+}
 
-	// Encode to base64
+// EncryptString encrypts a string like EncryptStringWithAAD
+func (k *EnvelopeKey) EncryptString(plaintext string, associatedData []byte) (string, error) {
+	ciphertext, err := k.Encrypt([]byte(plaintext), associatedData)
+	if err != nil {
+		return "", err
+	}
 	return base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
-// DecryptString decrypts an encrypted string using AES decryption with a given key
-func DecryptString(ciphertext, key string) (string, error) {
-	// Decode from base64
-	data, err := base64.StdEncoding.DecodeString(ciphertext)
+// DecryptBytes decrypts data produced by EncryptBytes, or by older versions
+func DecryptBytes(data []byte, key string) ([]byte, error) {
+	return DecryptBytesWithAAD(data, key, nil)
+}
+
+// DecryptBytesWithAAD decrypts data produced by EncryptBytesWithAAD. Data
+// from older versions carries no associated data and is decrypted
+// regardless of associatedData.
+func DecryptBytesWithAAD(data []byte, key string, associatedData []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, envelopeMagic) {
+		return decryptLegacy(data, key)
+	}
+	return openEnvelope(data, key, associatedData)
+}
+
+// openEnvelope decrypts an envelope. A damaged or tampered envelope is
+// never retried as older data, it returns ErrDecrypt.
+func openEnvelope(data []byte, key string, associatedData []byte) ([]byte, error) {
+	if len(data) < envelopeHeaderLen {
+		return nil, ErrDecrypt
+	}
+
+	params := data[len(envelopeMagic):]
+	version, alg, logN, r, p := params[0], params[1], params[2], int(params[3]), int(params[4])
+	if version != envelopeVersion || alg != algScryptAES256GCM ||
+		logN == 0 || logN > scryptMaxLogN || r == 0 || r > scryptMaxR || p == 0 || p > scryptMaxP {
+		return nil, ErrDecrypt
+	}
+
+	header := data[:envelopeHeaderLen]
+	salt := header[envelopeHeaderLen-gcmNonceLen-scryptSaltLen : envelopeHeaderLen-gcmNonceLen]
+	nonce := header[envelopeHeaderLen-gcmNonceLen:]
+
+	gcm, err := scryptGCM(key, salt, logN, r, p)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, nonce, data[envelopeHeaderLen:], envelopeAAD(header, associatedData))
+	if err != nil {
+		return nil, ErrDecrypt
 	}
+	return plaintext, nil
+}
 
-	// Create hash of key to ensure it's 32 bytes for AES-256
-	hash := sha256.Sum256([]byte(key))
+// envelopeAAD authenticates the envelope header with the caller's data
+func envelopeAAD(header, associatedData []byte) []byte {
+	aad := make([]byte, 0, len(header)+len(associatedData))
+	return append(append(aad, header...), associatedData...)
+}
 
-	// Create AES cipher
-	block, err := aes.NewCipher(hash[:])
+// scryptGCM creates an AES-256-GCM cipher with a key derived by scrypt
+func scryptGCM(key string, salt []byte, logN byte, r, p int) (cipher.AEAD, error) {
+	derived, err := scrypt.Key([]byte(key), salt, 1<<logN, r, p, 32)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	return newGCM(derived)
+}
 
-	// Create GCM mode
-	gcm, err := cipher.NewGCM(block)
+// decryptLegacy decrypts data encrypted by older versions
+func decryptLegacy(data []byte, key string) ([]byte, error) {
+	// The key was a bare hash of the passphrase
+	hash := sha256.Sum256([]byte(key))
+	gcm, err := newGCM(hash[:])
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// Get nonce size
 	nonceSize := gcm.NonceSize()
 	if len(data) < nonceSize {
-		return "", errors.New("ciphertext too short")
+		return nil, errors.New("ciphertext too short")
 	}
 
 	// Split nonce and ciphertext
@@ -76,10 +233,21 @@ func DecryptString(ciphertext, key string) (string, error) {
 	// Decrypt
 	plaintext, err := gcm.Open(nil, nonce, ciphertextBytes, nil)
 	if err != nil {
-		return "", err
+		return nil, ErrDecrypt
 	}
+	return plaintext, nil
+}
 
-	return string(plaintext), nil
+// newGCM creates an AES-256-GCM cipher from a 32 byte key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	// Create AES cipher
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create GCM mode
+	return cipher.NewGCM(block)
 }
 
 // GenerateRandomKey generates a random key for encryption
@@ -92,18 +260,6 @@ func GenerateRandomKey(length int) (string, error) {
 	return base64.StdEncoding.EncodeToString(bytes), nil
 }
 
-// HashPassword creates a simple hash of password (for demo purposes)
-// In production, use proper password hashing like bcrypt
-func HashPassword(password string) string {
-	hash := sha256.Sum256([]byte(password))
-	return base64.StdEncoding.EncodeToString(hash[:])
-}
-
-// VerifyPassword verifies a password against its hash
-func VerifyPassword(password, hash string) bool {
-	return HashPassword(password) == hash
-}
-
 // ObfuscateAPIKey obfuscates API key for display purposes
 func ObfuscateAPIKey(apiKey string) string {
 	if len(apiKey) <= 8 {
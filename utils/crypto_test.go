@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+// legacyFixture is "sesi versi lama" encrypted by an older version with the
+// passphrase "kunci-lama": a 12 byte nonce followed by AES-256-GCM
+// ciphertext, the key being the SHA-256 of the passphrase
+const legacyFixture = "MDEyMzQ1Njc4OWFio7cSmvsIq8t4nt9upiYaMIPnpiBVtIllaJ+Jv3va6A=="
+
+func TestEncryptBytesRoundTrip(t *testing.T) {
+	plaintext := []byte("data rahasia kasir")
+
+	for name, aad := range map[string][]byte{
+		"without aad": nil,
+		"with aad":    []byte("kasirnest/test"),
+	} {
+		ciphertext, err := EncryptBytesWithAAD(plaintext, "kunci", aad)
+		if err != nil {
+			t.Fatalf("%s: EncryptBytesWithAAD: %v", name, err)
+		}
+		if !bytes.HasPrefix(ciphertext, envelopeMagic) {
+			t.Errorf("%s: ciphertext is not an envelope", name)
+		}
+
+		decrypted, err := DecryptBytesWithAAD(ciphertext, "kunci", aad)
+		if err != nil {
+			t.Fatalf("%s: DecryptBytesWithAAD: %v", name, err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("%s: decrypted %q, want %q", name, decrypted, plaintext)
+		}
+
+		if _, err := DecryptBytesWithAAD(ciphertext, "kunci lain", aad); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("%s: decrypt with wrong key = %v, want ErrDecrypt", name, err)
+		}
+	}
+}
+
+func TestEncryptStringRoundTrip(t *testing.T) {
+	ciphertext, err := EncryptString("halo", "kunci")
+	if err != nil {
+		t.Fatalf("EncryptString: %v", err)
+	}
+	plaintext, err := DecryptString(ciphertext, "kunci")
+	if err != nil || plaintext != "halo" {
+		t.Errorf("DecryptString = %q, %v, want halo", plaintext, err)
+	}
+}
+
+func TestEnvelopeKeyReusesSalt(t *testing.T) {
+	key, err := NewEnvelopeKey("kunci")
+	if err != nil {
+		t.Fatalf("NewEnvelopeKey: %v", err)
+	}
+	aad := []byte("kasirnest/session")
+
+	first, err := key.EncryptString("satu", aad)
+	if err != nil {
+		t.Fatalf("EncryptString: %v", err)
+	}
+	second, err := key.EncryptString("satu", aad)
+	if err != nil {
+		t.Fatalf("EncryptString: %v", err)
+	}
+	if first == second {
+		t.Error("two envelopes from one key are equal, nonce reused")
+	}
+
+	for _, ciphertext := range []string{first, second} {
+		plaintext, err := DecryptStringWithAAD(ciphertext, "kunci", aad)
+		if err != nil || plaintext != "satu" {
+			t.Errorf("DecryptStringWithAAD = %q, %v, want satu", plaintext, err)
+		}
+	}
+}
+
+func TestDecryptAADMismatch(t *testing.T) {
+	ciphertext, err := EncryptBytesWithAAD([]byte("sesi"), "kunci", []byte("kasirnest/session"))
+	if err != nil {
+		t.Fatalf("EncryptBytesWithAAD: %v", err)
+	}
+
+	for name, aad := range map[string][]byte{
+		"none":  nil,
+		"other": []byte("kasirnest/backup"),
+	} {
+		if _, err := DecryptBytesWithAAD(ciphertext, "kunci", aad); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("%s: DecryptBytesWithAAD = %v, want ErrDecrypt", name, err)
+		}
+	}
+}
+
+func TestDecryptTamperedHeader(t *testing.T) {
+	ciphertext, err := EncryptBytes([]byte("sesi"), "kunci")
+	if err != nil {
+		t.Fatalf("EncryptBytes: %v", err)
+	}
+
+	// Flip the version, a scrypt parameter, a salt byte and a nonce byte
+	for _, i := range []int{3, 7, len(envelopeMagic) + 5, envelopeHeaderLen - 1} {
+		tampered := append([]byte(nil), ciphertext...)
+		tampered[i] ^= 0x01
+		if _, err := DecryptBytes(tampered, "kunci"); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("flipped byte %d: DecryptBytes = %v, want ErrDecrypt", i, err)
+		}
+	}
+
+	if _, err := DecryptBytes(ciphertext[:envelopeHeaderLen-1], "kunci"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("truncated envelope: DecryptBytes = %v, want ErrDecrypt", err)
+	}
+}
+
+func TestDecryptLegacyFixture(t *testing.T) {
+	data, err := base64.StdEncoding.DecodeString(legacyFixture)
+	if err != nil {
+		t.Fatalf("decode fixture: %v", err)
+	}
+
+	plaintext, err := DecryptBytesWithAAD(data, "kunci-lama", []byte("kasirnest/session"))
+	if err != nil {
+		t.Fatalf("DecryptBytesWithAAD(legacy): %v", err)
+	}
+	if string(plaintext) != "sesi versi lama" {
+		t.Errorf("legacy plaintext = %q, want %q", plaintext, "sesi versi lama")
+	}
+
+	if _, err := DecryptBytes(data, "kunci-salah"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("legacy with wrong key = %v, want ErrDecrypt", err)
+	}
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Passwords and PINs are hashed with argon2id and stored in the PHC string
+// format, so every hash carries its algorithm, parameters and salt:
+//
+//	$argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>
+//
+// Hashes made by older versions are an unsalted base64 SHA-256 digest.
+// They still verify, but should be replaced as soon as the password is
+// known.
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024 // KiB
+	argon2Threads = 4
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+
+	// Upper bounds for parameters read from a stored hash, so a tampered
+	// hash cannot make verification exhaust the machine
+	argon2MaxTime   = 16
+	argon2MaxMemory = 1024 * 1024 // KiB
+)
+
+// argon2Prefix starts every argon2id hash
+const argon2Prefix = "$argon2id$"
+
+// argon2Params are the cost parameters of an argon2id hash
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+// currentArgon2 are the parameters new hashes are made with
+var currentArgon2 = argon2Params{time: argon2Time, memory: argon2Memory, threads: argon2Threads}
+
+// HashPassword hashes a password or PIN with argon2id and a random salt
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	p := currentArgon2
+	key := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, argon2KeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2Prefix, argon2.Version,
+		p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword checks a password against a hash made by HashPassword or
+// an older version, in constant time. rehash is only set when the password
+// matched a legacy or weaker hash, which should be replaced by a new
+// HashPassword of the same password.
+func VerifyPassword(password, hash string) (match, rehash bool) {
+	if !strings.HasPrefix(hash, argon2Prefix) {
+		match = verifyLegacy(password, hash)
+		return match, match
+	}
+
+	p, salt, key, ok := parseArgon2(hash)
+	if !ok {
+		return false, false
+	}
+	computed := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(computed, key) != 1 {
+		return false, false
+	}
+	return true, p != currentArgon2 || len(key) != argon2KeyLen
+}
+
+// parseArgon2 splits an argon2id hash into its parameters, salt and key
+func parseArgon2(hash string) (p argon2Params, salt, key []byte, ok bool) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, false
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, false
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, nil, nil, false
+	}
+	if p.time == 0 || p.time > argon2MaxTime || p.memory == 0 || p.memory > argon2MaxMemory || p.threads == 0 {
+		return p, nil, nil, false
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, false
+	}
+	key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, false
+	}
+	return p, salt, key, true
+}
+
+// verifyLegacy checks a password against an unsalted SHA-256 hash
+func verifyLegacy(password, hash string) bool {
+	stored, err := base64.StdEncoding.DecodeString(hash)
+	if err != nil || len(stored) != sha256.Size {
+		return false
+	}
+	computed := sha256.Sum256([]byte(password))
+	return subtle.ConstantTimeCompare(computed[:], stored) == 1
+}
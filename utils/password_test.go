@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestHashPasswordRoundTrip(t *testing.T) {
+	hash, err := HashPassword("rahasia123")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=4$") {
+		t.Errorf("hash = %q, want PHC argon2id with current parameters", hash)
+	}
+
+	match, rehash := VerifyPassword("rahasia123", hash)
+	if !match || rehash {
+		t.Errorf("VerifyPassword(correct) = %v, %v, want true, false", match, rehash)
+	}
+
+	// Every hash has its own salt
+	other, err := HashPassword("rahasia123")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if other == hash {
+		t.Error("two hashes of the same password are equal")
+	}
+}
+
+func TestVerifyPasswordWrong(t *testing.T) {
+	hash, err := HashPassword("1234")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if match, rehash := VerifyPassword("4321", hash); match || rehash {
+		t.Errorf("VerifyPassword(wrong) = %v, %v, want false, false", match, rehash)
+	}
+}
+
+func TestVerifyPasswordLegacy(t *testing.T) {
+	sum := sha256.Sum256([]byte("1234"))
+	legacy := base64.StdEncoding.EncodeToString(sum[:])
+
+	if match, rehash := VerifyPassword("1234", legacy); !match || !rehash {
+		t.Errorf("VerifyPassword(legacy) = %v, %v, want true, true", match, rehash)
+	}
+	if match, rehash := VerifyPassword("4321", legacy); match || rehash {
+		t.Errorf("VerifyPassword(legacy, wrong) = %v, %v, want false, false", match, rehash)
+	}
+}
+
+func TestVerifyPasswordWeakerParams(t *testing.T) {
+	previous := currentArgon2
+	currentArgon2 = argon2Params{time: 1, memory: 8 * 1024, threads: 1}
+	hash, err := HashPassword("1234")
+	currentArgon2 = previous
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+
+	if match, rehash := VerifyPassword("1234", hash); !match || !rehash {
+		t.Errorf("VerifyPassword(weaker) = %v, %v, want true, true", match, rehash)
+	}
+	if match, rehash := VerifyPassword("4321", hash); match || rehash {
+		t.Errorf("VerifyPassword(weaker, wrong) = %v, %v, want false, false", match, rehash)
+	}
+}
+
+func TestVerifyPasswordMalformed(t *testing.T) {
+	const salt = "c2FsdHNhbHRzYWx0c2FsdA"
+	const key = "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+
+	for name, hash := range map[string]string{
+		"empty":          "",
+		"missing parts":  "$argon2id$v=19$m=65536,t=3,p=4$" + salt,
+		"wrong version":  "$argon2id$v=16$m=65536,t=3,p=4$" + salt + "$" + key,
+		"bad params":     "$argon2id$v=19$m=x,t=3,p=4$" + salt + "$" + key,
+		"zero time":      "$argon2id$v=19$m=65536,t=0,p=4$" + salt + "$" + key,
+		"zero threads":   "$argon2id$v=19$m=65536,t=3,p=0$" + salt + "$" + key,
+		"huge memory":    "$argon2id$v=19$m=4194304,t=3,p=4$" + salt + "$" + key,
+		"huge time":      "$argon2id$v=19$m=65536,t=1000,p=4$" + salt + "$" + key,
+		"bad salt":       "$argon2id$v=19$m=65536,t=3,p=4$!!!$" + key,
+		"empty key":      "$argon2id$v=19$m=65536,t=3,p=4$" + salt + "$",
+		"legacy garbage": "not-base64!",
+	} {
+		if match, rehash := VerifyPassword("1234", hash); match || rehash {
+			t.Errorf("%s: VerifyPassword = %v, %v, want false, false", name, match, rehash)
+		}
+	}
+}